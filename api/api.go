@@ -6,6 +6,8 @@ import (
 
 	"github.com/BlockLucky/dwg-go/api/api_config"
 	"github.com/BlockLucky/dwg-go/api/api_handler"
+	"github.com/BlockLucky/dwg-go/api/api_job"
+	"github.com/BlockLucky/dwg-go/api/api_webhook"
 	"github.com/gorilla/mux"
 )
 
@@ -17,12 +19,17 @@ func StartAPIService(apiCfg *api_config.ApiConfig) {
 	}
 
 	api_config.CurrentApiConfig = apiCfg
+	api_webhook.DefaultDispatcher.AllowPrivate = apiCfg.WebhookAllowPrivate
+	api_job.RegisterMethods(api_job.DefaultManager)
 
 	go func() {
 		muxRouter := mux.NewRouter()
 		muxRouter.Use(api_handler.Middleware) // 使用中间件
 		muxRouter.HandleFunc("/", api_handler.HomeHandler).Methods("GET")
 		muxRouter.HandleFunc("/api/v1", api_handler.ApiHandler).Methods("POST")
+		muxRouter.HandleFunc("/api/v1/stream", api_handler.StreamHandler).Methods("POST")
+		muxRouter.HandleFunc("/api/v1/jobs/{id}/events", api_handler.JobEventsHandler).Methods("GET")
+		muxRouter.HandleFunc("/api/v1/ws", api_handler.WsHandler).Methods("GET")
 
 		addr := fmt.Sprintf("%s:%d", "0.0.0.0", apiCfg.Port)
 		fmt.Printf("API server Run On  [%s]", fmt.Sprintf("http://127.0.0.1:%d", apiCfg.Port))
@@ -1,18 +1,50 @@
 package api_config
 
+import (
+	"crypto/subtle"
+	"net/url"
+	"strings"
+)
+
+// AdminMethodPrefix 管理方法的前缀，没有配置 AuthTokens 时不允许调用
+const AdminMethodPrefix = "admin."
+
 type ApiConfig struct {
 	Enabled           bool     `yaml:"enabled" json:"enabled"`
 	Port              int      `yaml:"port" json:"port"`
 	UserAgentAllowed  []string `yaml:"user_agent_allowed" json:"user_agent_allowed"`
 	APIMethodsAllowed []string `yaml:"api_methods_allowed" json:"api_methods_allowed"`
+	// AuthTokens 非空时请求需携带 Authorization: Bearer <token>，token 为其中之一
+	AuthTokens []string `yaml:"auth_tokens" json:"auth_tokens"`
+	// MaxBodyMB 单个 HTTP 请求体与 WebSocket 消息的大小上限，0 时为 DefaultMaxBodyMB
+	MaxBodyMB int64 `yaml:"max_body_mb" json:"max_body_mb"`
+	// AllowedOrigins 允许建立 WebSocket 连接的浏览器 Origin（如 https://app.example.com），"*" 允许任意来源；
+	// 不带 Origin 的非浏览器客户端与同源页面始终允许
+	AllowedOrigins []string `yaml:"allowed_origins" json:"allowed_origins"`
+	// WebhookAllowPrivate 允许任务回调地址指向回环、链路本地与内网地址，默认拒绝
+	WebhookAllowPrivate bool `yaml:"webhook_allow_private" json:"webhook_allow_private"`
 }
 
+// DefaultMaxBodyMB 未配置 MaxBodyMB 时请求体的大小上限
+const DefaultMaxBodyMB = 16
+
 var (
 	CurrentApiConfig *ApiConfig
 )
 
-// CheckAllowedMethods 允许方法
+// MaxBodyBytes 单个请求体或 WebSocket 消息允许的字节数
+func MaxBodyBytes() int64 {
+	if CurrentApiConfig.MaxBodyMB > 0 {
+		return CurrentApiConfig.MaxBodyMB << 20
+	}
+	return DefaultMaxBodyMB << 20
+}
+
+// CheckAllowedMethods 允许方法；管理方法还要求配置了 AuthTokens，请求的 token 由 CheckAuthToken 校验
 func CheckAllowedMethods(method string) bool {
+	if strings.HasPrefix(method, AdminMethodPrefix) && len(CurrentApiConfig.AuthTokens) == 0 {
+		return false
+	}
 	for _, v := range CurrentApiConfig.APIMethodsAllowed {
 		if v == method {
 			return true
@@ -21,6 +53,27 @@ func CheckAllowedMethods(method string) bool {
 	return false
 }
 
+// CheckAllowedOrigin 检查 WebSocket 握手的 Origin 是否允许，host 为请求的 Host
+func CheckAllowedOrigin(origin, host string) bool {
+	if origin == "" {
+		return true
+	}
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, host) {
+		return true
+	}
+	for _, v := range CurrentApiConfig.AllowedOrigins {
+		if v == "*" || strings.EqualFold(strings.TrimSuffix(v, "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// AuthEnabled 是否配置了 AuthTokens；配置后请求以 token 认证，不再检查 UA 白名单
+func AuthEnabled() bool {
+	return len(CurrentApiConfig.AuthTokens) > 0
+}
+
 // CheckAllowedUserAgent 检查UA是否在白名单
 func CheckAllowedUserAgent(uaName string) bool {
 	for _, v := range CurrentApiConfig.UserAgentAllowed {
@@ -30,3 +83,17 @@ func CheckAllowedUserAgent(uaName string) bool {
 	}
 	return false
 }
+
+// CheckAuthToken 检查 token 是否有效，未配置 AuthTokens 时不校验
+func CheckAuthToken(token string) bool {
+	if len(CurrentApiConfig.AuthTokens) == 0 {
+		return true
+	}
+	ok := false
+	for _, v := range CurrentApiConfig.AuthTokens {
+		if v != "" && subtle.ConstantTimeCompare([]byte(v), []byte(token)) == 1 {
+			ok = true
+		}
+	}
+	return ok
+}
@@ -0,0 +1,32 @@
+package api_config
+
+import "testing"
+
+func TestCheckAllowedOrigin(t *testing.T) {
+	CurrentApiConfig = &ApiConfig{AllowedOrigins: []string{"https://app.example.com/"}}
+	t.Cleanup(func() { CurrentApiConfig = nil })
+
+	tests := []struct {
+		origin string
+		host   string
+		want   bool
+	}{
+		{"", "dwg.local:8765", true},
+		{"http://dwg.local:8765", "dwg.local:8765", true},
+		{"https://app.example.com", "dwg.local:8765", true},
+		{"https://APP.example.com", "dwg.local:8765", true},
+		{"https://evil.example.com", "dwg.local:8765", false},
+		{"http://dwg.local", "dwg.local:8765", false},
+		{"null", "dwg.local:8765", false},
+	}
+	for _, tt := range tests {
+		if got := CheckAllowedOrigin(tt.origin, tt.host); got != tt.want {
+			t.Errorf("CheckAllowedOrigin(%q, %q) = %v, want %v", tt.origin, tt.host, got, tt.want)
+		}
+	}
+
+	CurrentApiConfig.AllowedOrigins = []string{"*"}
+	if !CheckAllowedOrigin("https://evil.example.com", "dwg.local:8765") {
+		t.Error(`"*" did not allow every origin`)
+	}
+}
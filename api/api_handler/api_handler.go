@@ -1,17 +1,19 @@
 package api_handler
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
 	"strings"
 
 	"github.com/BlockLucky/dwg-go/api/api_config"
+	"github.com/BlockLucky/dwg-go/api/api_method"
 	"github.com/BlockLucky/dwg-go/api/api_request"
 	"github.com/BlockLucky/dwg-go/api/api_response"
 	"github.com/BlockLucky/dwg-go/api/api_rpc"
-	"github.com/BlockLucky/dwg-go/config"
 )
 
 func apiCommonHandle(r *http.Request) (reqModel *api_rpc.RPCRequest, err error) {
@@ -46,7 +48,8 @@ func ApiHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	api_response.HandleResponse(w, nil, "", reqModel)
+	respData, err := api_method.Call(r.Context(), reqModel, nil)
+	api_response.HandleResponse(w, err, respData, reqModel)
 }
 
 // HomeHandler 处理根路径请求
@@ -58,12 +61,23 @@ func HomeHandler(w http.ResponseWriter, r *http.Request) {
 // Middleware 示例中间件
 func Middleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !api_config.CheckAuthToken(requestToken(r)) {
+			unauthorized(w)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, api_config.MaxBodyBytes())
+
+		// 配置了 token 时请求已经通过认证，浏览器等任意 UA 都可以访问
+		if api_config.AuthEnabled() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
 		ua := r.Header.Get("User-Agent")
 		uas := strings.Split(ua, "/")
 		if len(uas) > 1 {
 			uaName := uas[0]
 			if api_config.CheckAllowedUserAgent(uaName) {
-				fmt.Printf("Request URI: [%s] ua:[%s]", r.RequestURI, ua)
 				next.ServeHTTP(w, r)
 				return
 			}
@@ -89,11 +103,28 @@ func Middleware(next http.Handler) http.Handler {
 		// 不符合指定UA，返回失败响应
 		err = errors.New(fmt.Sprintf("%s,%s", "permission denied:", r.RemoteAddr))
 
-		if config.CurrentApp.CurrentRunMode == gtbox.RunModeDebug || config.CurrentApp.CurrentRunMode == gtbox.RunModeTest {
-			gtbox_log.LogDebugf("permission denied body: %v", body)
-			gtbox_log.LogDebugf("permission denied body: %v", reqModel)
-		}
+		log.Printf("permission denied: %s ua:[%s] method:[%s]", r.RemoteAddr, ua, reqModel.Method)
 
 		api_response.HandleResponse(w, err, nil, reqModel)
 	})
 }
+
+// requestToken 取 Authorization: Bearer 中的 token；浏览器的 WebSocket 与 EventSource 无法设置请求头，
+// GET 请求也可以使用 access_token 查询参数
+func requestToken(r *http.Request) string {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+	if r.Method == http.MethodGet {
+		return r.URL.Query().Get("access_token")
+	}
+	return ""
+}
+
+func unauthorized(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("WWW-Authenticate", `Bearer realm="dwg_service"`)
+	w.WriteHeader(http.StatusUnauthorized)
+	err := &api_rpc.RPCError{Code: api_rpc.ErrCodeUnauthorized, Message: "missing or invalid auth token"}
+	_ = json.NewEncoder(w).Encode(api_response.BuildResponse(err, nil, nil))
+}
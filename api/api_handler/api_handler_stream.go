@@ -0,0 +1,54 @@
+package api_handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	"github.com/BlockLucky/dwg-go/api/api_method"
+	"github.com/BlockLucky/dwg-go/api/api_response"
+)
+
+// 每写出多少行刷新一次
+const streamFlushEvery = 256
+
+// StreamHandler 以 NDJSON 返回流式方法的结果：每条 $/item 通知写成一行，
+// 最后一行是 JSON-RPC 响应（带 jsonrpc 字段），用于区分正常结束与出错
+func StreamHandler(w http.ResponseWriter, r *http.Request) {
+	reqModel, err := apiCommonHandle(r)
+	if err != nil {
+		api_response.HandleResponse(w, err, nil, reqModel)
+		return
+	}
+
+	flusher, _ := w.(http.Flusher)
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("X-Accel-Buffering", "no")
+
+	var (
+		lock  sync.Mutex
+		lines int
+	)
+	enc := json.NewEncoder(w)
+	writeLine := func(v interface{}) {
+		lock.Lock()
+		defer lock.Unlock()
+		if err := enc.Encode(v); err != nil {
+			return
+		}
+		lines++
+		if flusher != nil && lines%streamFlushEvery == 0 {
+			flusher.Flush()
+		}
+	}
+
+	respData, err := api_method.Call(r.Context(), reqModel, func(method string, params interface{}) {
+		if method == api_method.NotifyItem {
+			writeLine(params)
+		}
+	})
+	writeLine(api_response.BuildResponse(err, respData, reqModel))
+	if flusher != nil {
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,193 @@
+package api_handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/BlockLucky/dwg-go/api/api_config"
+	"github.com/BlockLucky/dwg-go/api/api_job"
+	"github.com/BlockLucky/dwg-go/api/api_method"
+	"github.com/BlockLucky/dwg-go/api/api_request"
+	"github.com/BlockLucky/dwg-go/api/api_response"
+	"github.com/BlockLucky/dwg-go/api/api_rpc"
+	"github.com/BlockLucky/dwg-go/protocol"
+	"github.com/gorilla/websocket"
+)
+
+var wsUpgrader = websocket.Upgrader{
+	// 浏览器会为跨站页面带上 Cookie 等凭据，只接受同源与 allowed_origins 中的页面
+	CheckOrigin: func(r *http.Request) bool {
+		return api_config.CheckAllowedOrigin(r.Header.Get("Origin"), r.Host)
+	},
+}
+
+type wsSession struct {
+	conn      *websocket.Conn
+	writeLock sync.Mutex
+
+	subLock sync.Mutex
+	subs    map[string]context.CancelFunc
+
+	// calls 进行中的调用，收到 $/cancelRequest 时取消
+	callLock sync.Mutex
+	calls    map[string]context.CancelFunc
+}
+
+// WsHandler WebSocket 上的 JSON-RPC 入口，除请求响应外还会推送进度与任务事件通知
+func WsHandler(w http.ResponseWriter, r *http.Request) {
+	conn, err := wsUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade 失败时已经写回了错误响应
+		return
+	}
+	defer conn.Close()
+	// 与 HTTP 请求体相同的上限，超出时 ReadMessage 出错并关闭连接
+	conn.SetReadLimit(api_config.MaxBodyBytes())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	session := &wsSession{
+		conn:  conn,
+		subs:  make(map[string]context.CancelFunc),
+		calls: make(map[string]context.CancelFunc),
+	}
+
+	for {
+		_, body, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		reqModel, err := api_request.ParserRequest(body, r)
+		if err != nil {
+			session.writeJSON(api_response.BuildResponse(err, nil, nil))
+			continue
+		}
+		if reqModel.Method == protocol.NotifyCancel && reqModel.ID == "" {
+			session.cancelCall(reqModel)
+			continue
+		}
+		if !api_config.CheckAllowedMethods(reqModel.Method) {
+			session.writeJSON(api_response.BuildResponse(errors.New("request method is not allowed"), nil, reqModel))
+			continue
+		}
+
+		go session.handle(ctx, reqModel)
+	}
+}
+
+func (s *wsSession) writeJSON(v interface{}) {
+	s.writeLock.Lock()
+	defer s.writeLock.Unlock()
+	_ = s.conn.WriteJSON(v)
+}
+
+func (s *wsSession) notify(method string, params interface{}) {
+	s.writeJSON(&api_rpc.RPCNotification{
+		Method:  method,
+		Params:  params,
+		JsonRPC: "2.0",
+	})
+}
+
+func (s *wsSession) handle(ctx context.Context, reqModel *api_rpc.RPCRequest) {
+	var (
+		respData interface{}
+		err      error
+	)
+
+	switch reqModel.Method {
+	case protocol.MethodJobSubscribe:
+		respData, err = s.subscribe(ctx, reqModel)
+	case protocol.MethodJobUnsubscribe:
+		respData, err = s.unsubscribe(reqModel)
+	default:
+		callCtx, cancel := context.WithCancel(ctx)
+		s.callLock.Lock()
+		s.calls[reqModel.ID] = cancel
+		s.callLock.Unlock()
+		respData, err = api_method.Call(callCtx, reqModel, func(method string, params interface{}) {
+			s.notify(method, &api_rpc.CallNotice{RequestID: reqModel.ID, Data: params})
+		})
+		s.callLock.Lock()
+		delete(s.calls, reqModel.ID)
+		s.callLock.Unlock()
+		cancel()
+	}
+
+	s.writeJSON(api_response.BuildResponse(err, respData, reqModel))
+}
+
+// cancelCall 处理 $/cancelRequest，取消对应 id 的调用
+func (s *wsSession) cancelCall(reqModel *api_rpc.RPCRequest) {
+	var p protocol.CancelParams
+	if err := api_method.DecodeParams(reqModel, &p); err != nil {
+		return
+	}
+	s.callLock.Lock()
+	defer s.callLock.Unlock()
+	if cancel, ok := s.calls[p.ID]; ok {
+		cancel()
+	}
+}
+
+// subscribe 订阅任务事件，以 job.event 通知推送，任务结束后自动退订
+func (s *wsSession) subscribe(ctx context.Context, reqModel *api_rpc.RPCRequest) (interface{}, error) {
+	var p api_job.GetParams
+	if err := api_method.DecodeParams(reqModel, &p); err != nil {
+		return nil, err
+	}
+	job, ok := api_job.DefaultManager.Get(p.JobID)
+	if !ok {
+		return nil, fmt.Errorf("job not found: %s", p.JobID)
+	}
+
+	subCtx, cancel := context.WithCancel(ctx)
+	s.subLock.Lock()
+	if old, ok := s.subs[p.JobID]; ok {
+		old()
+	}
+	s.subs[p.JobID] = cancel
+	s.subLock.Unlock()
+
+	go func() {
+		defer cancel()
+		var lastSeq int64
+		for {
+			events, finished, changed := job.EventsAfter(lastSeq)
+			for _, ev := range events {
+				s.notify(api_job.NotifyEvent, ev)
+				lastSeq = ev.Seq
+			}
+			if finished {
+				return
+			}
+			select {
+			case <-changed:
+			case <-subCtx.Done():
+				return
+			}
+		}
+	}()
+
+	return job.Info(), nil
+}
+
+func (s *wsSession) unsubscribe(reqModel *api_rpc.RPCRequest) (interface{}, error) {
+	var p api_job.GetParams
+	if err := api_method.DecodeParams(reqModel, &p); err != nil {
+		return nil, err
+	}
+
+	s.subLock.Lock()
+	defer s.subLock.Unlock()
+	if cancel, ok := s.subs[p.JobID]; ok {
+		cancel()
+		delete(s.subs, p.JobID)
+	}
+	return true, nil
+}
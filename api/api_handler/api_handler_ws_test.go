@@ -0,0 +1,44 @@
+package api_handler
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/BlockLucky/dwg-go/api/api_config"
+	"github.com/gorilla/websocket"
+)
+
+func TestWsReadLimit(t *testing.T) {
+	api_config.CurrentApiConfig = &api_config.ApiConfig{MaxBodyMB: 1, UserAgentAllowed: []string{"dwg-go"}}
+	t.Cleanup(func() { api_config.CurrentApiConfig = nil })
+	srv := httptest.NewServer(Middleware(http.HandlerFunc(WsHandler)))
+	defer srv.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), http.Header{"User-Agent": {"dwg-go/test"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// 上限以内的消息正常处理
+	if err = conn.WriteMessage(websocket.TextMessage, []byte(`{"jsonrpc":"2.0","id":"1","method":"none","params":[]}`)); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = conn.ReadMessage(); err != nil {
+		t.Fatalf("small message: %v", err)
+	}
+
+	big := bytes.Repeat([]byte("x"), 1<<20+1)
+	if err = conn.WriteMessage(websocket.TextMessage, big); err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = conn.ReadMessage()
+	var closeErr *websocket.CloseError
+	if !errors.As(err, &closeErr) || closeErr.Code != websocket.CloseMessageTooBig {
+		t.Fatalf("oversized message: %v, want close %d", err, websocket.CloseMessageTooBig)
+	}
+}
@@ -0,0 +1,259 @@
+package api_job
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/BlockLucky/dwg-go/api/api_response"
+	"github.com/BlockLucky/dwg-go/protocol"
+)
+
+const (
+	// NotifyProgress 方法执行过程中上报进度的通知名
+	NotifyProgress = protocol.NotifyProgress
+	// NotifyLog 方法执行过程中上报日志的通知名
+	NotifyLog = protocol.NotifyLog
+	// NotifyEvent 向订阅方推送任务事件的通知名
+	NotifyEvent = protocol.NotifyJobEvent
+)
+
+// 单个任务最多保留的事件数，超出后丢弃最早的事件
+const maxJobEvents = 1000
+
+type Status = protocol.JobStatus
+
+const (
+	StatusPending   = protocol.JobPending
+	StatusRunning   = protocol.JobRunning
+	StatusSucceeded = protocol.JobSucceeded
+	StatusFailed    = protocol.JobFailed
+)
+
+type EventType = protocol.JobEventType
+
+const (
+	EventProgress = protocol.JobEventProgress
+	EventLog      = protocol.JobEventLog
+	EventStatus   = protocol.JobEventStatus
+)
+
+// Event 任务事件，进度/日志/状态共用
+type Event = protocol.JobEvent
+
+// EventFromNotification 将方法上报的通知转换为任务事件
+func EventFromNotification(method string, params interface{}) (Event, bool) {
+	if method != NotifyProgress && method != NotifyLog {
+		return Event{}, false
+	}
+
+	ev, ok := params.(Event)
+	if !ok {
+		raw, err := json.Marshal(params)
+		if err != nil {
+			return Event{}, false
+		}
+		if err = json.Unmarshal(raw, &ev); err != nil {
+			return Event{}, false
+		}
+	}
+
+	if ev.Type == "" {
+		ev.Type = EventProgress
+		if method == NotifyLog {
+			ev.Type = EventLog
+		}
+	}
+	return ev, true
+}
+
+// RunFunc 任务执行体，report 用于上报进度与日志
+type RunFunc func(ctx context.Context, report func(ev Event)) (interface{}, error)
+
+// Info 任务快照
+type Info = protocol.JobInfo
+
+type Job struct {
+	lock sync.Mutex
+	info Info
+
+	events   []Event
+	seq      int64
+	changed  chan struct{}
+	done     chan struct{}
+	progress *Event
+}
+
+// ID 任务ID
+func (j *Job) ID() string {
+	return j.info.ID
+}
+
+// Done 任务结束时关闭
+func (j *Job) Done() <-chan struct{} {
+	return j.done
+}
+
+// Info 返回任务当前快照
+func (j *Job) Info() Info {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	info := j.info
+	if j.progress != nil {
+		p := *j.progress
+		info.Progress = &p
+	}
+	return info
+}
+
+// Report 记录一条任务事件并唤醒订阅方
+func (j *Job) Report(ev Event) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	j.appendLocked(ev)
+}
+
+func (j *Job) appendLocked(ev Event) {
+	j.seq++
+	ev.JobID = j.info.ID
+	ev.Seq = j.seq
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	if ev.Type == EventProgress {
+		p := ev
+		j.progress = &p
+	}
+
+	j.events = append(j.events, ev)
+	if len(j.events) > maxJobEvents {
+		j.events = append(j.events[:0:0], j.events[len(j.events)-maxJobEvents:]...)
+	}
+
+	close(j.changed)
+	j.changed = make(chan struct{})
+}
+
+// EventsAfter 返回序号大于 seq 的事件、任务是否已结束，以及有新事件时会被关闭的通道
+func (j *Job) EventsAfter(seq int64) (events []Event, finished bool, changed <-chan struct{}) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	for _, ev := range j.events {
+		if ev.Seq > seq {
+			events = append(events, ev)
+		}
+	}
+	return events, j.info.Status.Finished(), j.changed
+}
+
+func (j *Job) setStatus(status Status, result interface{}, err error) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	now := time.Now()
+	j.info.Status = status
+	switch status {
+	case StatusRunning:
+		j.info.StartedAt = &now
+	case StatusSucceeded, StatusFailed:
+		j.info.FinishedAt = &now
+		j.info.Result = result
+		if err != nil {
+			j.info.Error = err.Error()
+			j.info.ErrorCode = api_response.RPCError(err).Code
+		}
+	}
+
+	ev := Event{Type: EventStatus, Status: status, Time: now}
+	if err != nil {
+		ev.Message = err.Error()
+	}
+	j.appendLocked(ev)
+}
+
+func (j *Job) setCallback(url string) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	j.info.Callback = url
+}
+
+func (j *Job) run(ctx context.Context, run RunFunc) {
+	defer close(j.done)
+	j.setStatus(StatusRunning, nil, nil)
+
+	result, err := run(ctx, j.Report)
+	if err != nil {
+		j.setStatus(StatusFailed, nil, err)
+		return
+	}
+	j.setStatus(StatusSucceeded, result, nil)
+}
+
+// Manager 任务管理器，已结束的任务保留 Retention 后清理
+type Manager struct {
+	lock      sync.Mutex
+	jobs      map[string]*Job
+	Retention time.Duration
+}
+
+var (
+	DefaultManager = NewManager()
+)
+
+func NewManager() *Manager {
+	return &Manager{
+		jobs:      make(map[string]*Job),
+		Retention: time.Hour,
+	}
+}
+
+// Submit 创建任务并在后台执行
+func (m *Manager) Submit(method string, run RunFunc) *Job {
+	job := &Job{
+		info: Info{
+			ID:        newJobID(),
+			Method:    method,
+			Status:    StatusPending,
+			CreatedAt: time.Now(),
+		},
+		changed: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+
+	m.lock.Lock()
+	m.gcLocked()
+	m.jobs[job.info.ID] = job
+	m.lock.Unlock()
+
+	go job.run(context.Background(), run)
+	return job
+}
+
+// Get 按ID查找任务
+func (m *Manager) Get(id string) (*Job, bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	job, ok := m.jobs[id]
+	return job, ok
+}
+
+func (m *Manager) gcLocked() {
+	deadline := time.Now().Add(-m.Retention)
+	for id, job := range m.jobs {
+		info := job.Info()
+		if info.FinishedAt != nil && info.FinishedAt.Before(deadline) {
+			delete(m.jobs, id)
+		}
+	}
+}
+
+func newJobID() string {
+	buf := make([]byte, 16)
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
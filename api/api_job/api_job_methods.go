@@ -0,0 +1,128 @@
+package api_job
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/BlockLucky/dwg-go/api/api_config"
+	"github.com/BlockLucky/dwg-go/api/api_method"
+	"github.com/BlockLucky/dwg-go/api/api_rpc"
+	"github.com/BlockLucky/dwg-go/api/api_webhook"
+	"github.com/BlockLucky/dwg-go/protocol"
+)
+
+// SubmitParams job.submit 参数
+type SubmitParams = protocol.JobSubmitParams
+
+// GetParams job.get 参数
+type GetParams = protocol.JobParams
+
+// RegisterMethods 注册任务相关的 RPC 方法
+func RegisterMethods(m *Manager) {
+	api_method.RegisterMethod(protocol.MethodJobSubmit, func(ctx context.Context, reqModel *api_rpc.RPCRequest, notify api_method.Notifier) (interface{}, error) {
+		var p SubmitParams
+		if err := api_method.DecodeParams(reqModel, &p); err != nil {
+			return nil, err
+		}
+		if p.Method == "" || strings.HasPrefix(p.Method, "job.") {
+			return nil, fmt.Errorf("invalid job method: %q", p.Method)
+		}
+		if api_config.CurrentApiConfig != nil && !api_config.CheckAllowedMethods(p.Method) {
+			return nil, errors.New("request method is not allowed")
+		}
+		if _, ok := api_method.LookupMethod(p.Method); !ok {
+			return nil, fmt.Errorf("method not found: %s", p.Method)
+		}
+		if p.CallbackURL != "" {
+			if err := api_webhook.ValidateURL(p.CallbackURL, api_webhook.DefaultDispatcher.AllowPrivate); err != nil {
+				return nil, err
+			}
+		}
+
+		inner := &api_rpc.RPCRequest{
+			Method:  p.Method,
+			Params:  p.Params,
+			JsonRPC: reqModel.JsonRPC,
+			ID:      reqModel.ID,
+		}
+		job := m.Submit(p.Method, func(ctx context.Context, report func(ev Event)) (interface{}, error) {
+			return api_method.Call(ctx, inner, func(method string, params interface{}) {
+				if ev, ok := EventFromNotification(method, params); ok {
+					report(ev)
+				}
+			})
+		})
+		if p.CallbackURL != "" {
+			job.setCallback(p.CallbackURL)
+			go notifyCallback(job, api_webhook.Target{URL: p.CallbackURL, Secret: p.CallbackSecret})
+		}
+		return job.Info(), nil
+	})
+
+	api_method.RegisterMethod(protocol.MethodJobGet, func(ctx context.Context, reqModel *api_rpc.RPCRequest, notify api_method.Notifier) (interface{}, error) {
+		var p GetParams
+		if err := api_method.DecodeParams(reqModel, &p); err != nil {
+			return nil, err
+		}
+		job, ok := m.Get(p.JobID)
+		if !ok {
+			return nil, fmt.Errorf("job not found: %s", p.JobID)
+		}
+		return job.Info(), nil
+	})
+
+	api_method.RegisterMethod(protocol.MethodJobDeliveries, func(ctx context.Context, reqModel *api_rpc.RPCRequest, notify api_method.Notifier) (interface{}, error) {
+		var p GetParams
+		if err := api_method.DecodeParams(reqModel, &p); err != nil {
+			return nil, err
+		}
+		if _, ok := m.Get(p.JobID); !ok {
+			return nil, fmt.Errorf("job not found: %s", p.JobID)
+		}
+		return api_webhook.DefaultDispatcher.Deliveries(p.JobID), nil
+	})
+}
+
+// notifyCallback 等待任务结束后投递回调
+func notifyCallback(job *Job, target api_webhook.Target) {
+	<-job.Done()
+
+	info := job.Info()
+	payload := &api_webhook.Payload{
+		Event:  api_webhook.EventJobFinished,
+		JobID:  info.ID,
+		Method: info.Method,
+		Status: string(info.Status),
+		Files:  resultFiles(info.Result),
+		Error:  info.Error,
+	}
+	if info.FinishedAt != nil {
+		payload.FinishedAt = *info.FinishedAt
+	}
+	api_webhook.DefaultDispatcher.Deliver(target, payload)
+}
+
+// resultFiles 按约定从结果中取出产出文件：output 为单个文件，outputs 为多个文件
+func resultFiles(result interface{}) []string {
+	if result == nil {
+		return nil
+	}
+	raw, err := json.Marshal(result)
+	if err != nil {
+		return nil
+	}
+	var files struct {
+		Output  string   `json:"output"`
+		Outputs []string `json:"outputs"`
+	}
+	if err = json.Unmarshal(raw, &files); err != nil {
+		return nil
+	}
+	if files.Output != "" {
+		files.Outputs = append([]string{files.Output}, files.Outputs...)
+	}
+	return files.Outputs
+}
@@ -0,0 +1,81 @@
+package api_method
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/BlockLucky/dwg-go/api/api_rpc"
+	"github.com/BlockLucky/dwg-go/protocol"
+)
+
+// NotifyItem 流式方法逐条推送结果的通知名，params 即单条结果
+const NotifyItem = protocol.NotifyItem
+
+// Notifier 向调用方推送服务端通知（进度、日志等），params 须可 JSON 编码
+type Notifier func(method string, params interface{})
+
+// MethodFunc RPC 方法实现
+type MethodFunc func(ctx context.Context, reqModel *api_rpc.RPCRequest, notify Notifier) (interface{}, error)
+
+var (
+	methodsLock sync.RWMutex
+	methods     = map[string]MethodFunc{}
+)
+
+// RegisterMethod 注册 RPC 方法，同名覆盖
+func RegisterMethod(name string, fn MethodFunc) {
+	methodsLock.Lock()
+	defer methodsLock.Unlock()
+	methods[name] = fn
+}
+
+// LookupMethod 查找已注册的 RPC 方法
+func LookupMethod(name string) (MethodFunc, bool) {
+	methodsLock.RLock()
+	defer methodsLock.RUnlock()
+	fn, ok := methods[name]
+	return fn, ok
+}
+
+// Methods 已注册的全部方法名，按名称排序
+func Methods() []string {
+	methodsLock.RLock()
+	defer methodsLock.RUnlock()
+	names := make([]string, 0, len(methods))
+	for name := range methods {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Call 调用已注册的 RPC 方法，notify 可为 nil
+func Call(ctx context.Context, reqModel *api_rpc.RPCRequest, notify Notifier) (interface{}, error) {
+	fn, ok := LookupMethod(reqModel.Method)
+	if !ok {
+		return nil, fmt.Errorf("method not found: %s", reqModel.Method)
+	}
+	if notify == nil {
+		notify = func(string, interface{}) {}
+	}
+	return fn(ctx, reqModel, notify)
+}
+
+// DecodeParams 将 params[0] 解码到 v，约定结构化参数统一放在第一个位置
+func DecodeParams(reqModel *api_rpc.RPCRequest, v interface{}) error {
+	if len(reqModel.Params) == 0 {
+		return errors.New("missing params")
+	}
+	raw, err := json.Marshal(reqModel.Params[0])
+	if err != nil {
+		return err
+	}
+	if err = json.Unmarshal(raw, v); err != nil {
+		return fmt.Errorf("invalid params: %v", err)
+	}
+	return nil
+}
@@ -1,12 +1,12 @@
 package api_request
 
 import (
-	"dual_wallet/api/api_rpc"
-	"encoding/json"
 	"errors"
 	"fmt"
-	"github.com/goccy/go-json"
 	"net/http"
+
+	"github.com/BlockLucky/dwg-go/api/api_rpc"
+	"github.com/goccy/go-json"
 )
 
 func ParserRequest(body []byte, r *http.Request) (reqModel *api_rpc.RPCRequest, err error) {
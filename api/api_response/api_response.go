@@ -1,39 +1,56 @@
 package api_response
 
 import (
-	"dual_wallet/api/api_rpc"
-	"encoding/json"
-	"github.com/george012/gtbox/gtbox_log"
-	"github.com/goccy/go-json"
+	"errors"
+	"log"
 	"net/http"
+
+	"github.com/BlockLucky/dwg-go/api/api_rpc"
+	"github.com/BlockLucky/dwg-go/protocol"
+	"github.com/goccy/go-json"
 )
 
 func HandleResponse(w http.ResponseWriter, err error, respData interface{}, reqModel *api_rpc.RPCRequest) {
 	w.Header().Set("Content-Type", "application/json")
 
-	aID := "1"
-	if reqModel != nil {
-		aID = reqModel.ID
-	}
+	resp := BuildResponse(err, respData, reqModel)
 
-	resp := &api_rpc.RPCResponse{
-		JsonRPC: "2.0",
-		ID:      aID,
+	// 直接使用 Encoder 编码并写入响应体
+	if err = json.NewEncoder(w).Encode(resp); err != nil {
+		// 如果编码失败，可以记录日志或进一步处理
+		log.Printf("Failed to encode JSON response[%v]: %v", http.StatusInternalServerError, err)
 	}
+}
 
+// BuildResponse 构造 JSON-RPC 响应，HTTP、WebSocket 与 stdio 共用
+func BuildResponse(err error, respData interface{}, reqModel *api_rpc.RPCRequest) *api_rpc.RPCResponse {
 	if err != nil {
-		errMap := map[string]interface{}{
-			"error_code": "-1",
-			"error_msg":  err.Error(),
-		}
-		resp.Error = errMap
-	} else {
-		resp.Result = respData
+		err = RPCError(err)
 	}
+	return api_rpc.NewRPCResponse(reqModel, respData, err)
+}
 
-	// 直接使用 Encoder 编码并写入响应体
-	if err = json.NewEncoder(w).Encode(resp); err != nil {
-		// 如果编码失败，可以记录日志或进一步处理
-		gtbox_log.LogErrorf("Failed to encode JSON response[%v]", http.StatusInternalServerError)
+// RPCError 将方法返回的错误转换为响应中的错误：error_code 按 protocol.ErrorCode 一一映射，
+// 结构化错误（损坏位置、超出的限制、不支持的版本）放入 error_data；已经是 *api_rpc.RPCError 的原样返回
+func RPCError(err error) *api_rpc.RPCError {
+	var rpcErr *api_rpc.RPCError
+	if errors.As(err, &rpcErr) {
+		return rpcErr
+	}
+
+	e := &api_rpc.RPCError{Code: protocol.ErrorCode(err), Message: err.Error()}
+	var (
+		corrupt *protocol.CorruptError
+		limit   *protocol.LimitError
+		version *protocol.UnsupportedVersionError
+	)
+	switch {
+	case errors.As(err, &corrupt):
+		e.Data = corrupt
+	case errors.As(err, &limit):
+		e.Data = limit
+	case errors.As(err, &version):
+		e.Data = version
 	}
+	return e
 }
@@ -1,5 +1,12 @@
 package api_rpc
 
+import (
+	"errors"
+	"fmt"
+
+	"github.com/BlockLucky/dwg-go/protocol"
+)
+
 // RPCRequest JSON-RPC 请求和响应结构
 type RPCRequest struct {
 	Method  string        `json:"method"`
@@ -14,3 +21,65 @@ type RPCResponse struct {
 	JsonRPC string      `json:"jsonrpc"`
 	ID      string      `json:"id"`
 }
+
+// RPCNotification 服务端主动推送的通知（无 ID，不需要响应）
+type RPCNotification struct {
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params"`
+	JsonRPC string      `json:"jsonrpc"`
+}
+
+// CallNotice 某次调用执行过程中推送的通知，RequestID 对应请求的 ID
+type CallNotice struct {
+	RequestID string      `json:"request_id"`
+	Data      interface{} `json:"data"`
+}
+
+// 错误码，定义在 protocol 中，未归类的错误使用 ErrCodeDefault
+const (
+	ErrCodeDefault            = protocol.ErrCodeDefault
+	ErrCodeUnsupportedVersion = protocol.ErrCodeUnsupportedVersion
+	ErrCodeEncrypted          = protocol.ErrCodeEncrypted
+	ErrCodeCorrupt            = protocol.ErrCodeCorrupt
+	ErrCodeServiceUnavailable = protocol.ErrCodeServiceUnavailable
+	ErrCodeServiceCrashed     = protocol.ErrCodeServiceCrashed
+	ErrCodeLimitExceeded      = protocol.ErrCodeLimitExceeded
+	ErrCodeIncompatible       = protocol.ErrCodeIncompatible
+	ErrCodeUnauthorized       = protocol.ErrCodeUnauthorized
+)
+
+// RPCError 响应中的错误，Code 为空时按 ErrCodeDefault 处理，Data 为可选的结构化详情
+type RPCError struct {
+	Code    string      `json:"error_code"`
+	Message string      `json:"error_msg"`
+	Data    interface{} `json:"error_data,omitempty"`
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("rpc error %s: %s", e.Code, e.Message)
+}
+
+// NewRPCResponse 构造响应，err 非空时填充 Error
+func NewRPCResponse(reqModel *RPCRequest, result interface{}, err error) *RPCResponse {
+	aID := "1"
+	if reqModel != nil {
+		aID = reqModel.ID
+	}
+
+	resp := &RPCResponse{
+		JsonRPC: "2.0",
+		ID:      aID,
+	}
+
+	if err != nil {
+		rpcErr := &RPCError{Code: ErrCodeDefault, Message: err.Error()}
+		var e *RPCError
+		if errors.As(err, &e) {
+			rpcErr = e
+		}
+		resp.Error = rpcErr
+	} else {
+		resp.Result = result
+	}
+	return resp
+}
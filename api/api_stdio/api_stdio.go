@@ -0,0 +1,491 @@
+package api_stdio
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/BlockLucky/dwg-go/api/api_method"
+	"github.com/BlockLucky/dwg-go/api/api_request"
+	"github.com/BlockLucky/dwg-go/api/api_response"
+	"github.com/BlockLucky/dwg-go/api/api_rpc"
+	"github.com/BlockLucky/dwg-go/protocol"
+)
+
+// Serve 以 protocol 分帧的 JSON-RPC 在 r/w 上提供 api_method 注册的方法，r 关闭后返回。
+// 请求附带的二进制帧通过 protocol.Blobs 传给方法，方法用 protocol.AttachBlob 返回二进制数据；
+// 收到 protocol.NotifyCancel 时取消对应调用的 ctx。调用方发送了 protocol.NotifyWindow 的调用，
+// 推送的通知超出额度时方法的 notify 等待调用方归还额度，只阻塞该调用
+func Serve(r io.Reader, w io.Writer) error {
+	var wg sync.WaitGroup
+	fw := protocol.NewWriter(w)
+	write := func(requestID string, blobs map[string][]byte, v interface{}) {
+		_ = fw.WriteMessage(requestID, blobs, v)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var callsLock sync.Mutex
+	calls := make(map[string]context.CancelFunc)
+	windows := make(map[string]*window)
+
+	fr := protocol.NewReader(r)
+	blobs := protocol.NewAssembler()
+	var err error
+	for {
+		var f *protocol.Frame
+		if f, err = fr.Read(); err != nil {
+			break
+		}
+		if f.IsBlob() {
+			blobs.Add(f)
+			continue
+		}
+
+		reqModel, err := api_request.ParserRequest(f.Body, nil)
+		if err != nil {
+			write("", nil, api_response.BuildResponse(err, nil, nil))
+			continue
+		}
+		if reqModel.Method == protocol.NotifyCancel && reqModel.ID == "" {
+			var p protocol.CancelParams
+			if api_method.DecodeParams(reqModel, &p) == nil {
+				callsLock.Lock()
+				if cancelCall, ok := calls[p.ID]; ok {
+					cancelCall()
+				}
+				callsLock.Unlock()
+			}
+			continue
+		}
+		if (reqModel.Method == protocol.NotifyWindow || reqModel.Method == protocol.NotifyCredit) && reqModel.ID == "" {
+			var p protocol.CreditParams
+			if api_method.DecodeParams(reqModel, &p) == nil && p.Count > 0 {
+				callsLock.Lock()
+				if reqModel.Method == protocol.NotifyWindow {
+					windows[p.ID] = newWindow(p.Count)
+				} else if win := windows[p.ID]; win != nil {
+					win.grant(p.Count)
+				}
+				callsLock.Unlock()
+			}
+			continue
+		}
+
+		in, err := blobs.Take(reqModel.ID)
+		if err != nil {
+			callsLock.Lock()
+			delete(windows, reqModel.ID)
+			callsLock.Unlock()
+			write(reqModel.ID, nil, api_response.BuildResponse(err, nil, reqModel))
+			continue
+		}
+
+		callCtx, cancelCall := context.WithCancel(ctx)
+		callsLock.Lock()
+		calls[reqModel.ID] = cancelCall
+		win := windows[reqModel.ID]
+		callsLock.Unlock()
+		callCtx, sink := protocol.WithBlobSink(protocol.WithBlobs(callCtx, in))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() {
+				callsLock.Lock()
+				delete(calls, reqModel.ID)
+				delete(windows, reqModel.ID)
+				callsLock.Unlock()
+				cancelCall()
+			}()
+			result, err := api_method.Call(callCtx, reqModel, func(method string, params interface{}) {
+				// 调用被取消时不再等待额度，丢弃通知
+				if win != nil && !win.acquire(callCtx) {
+					return
+				}
+				write("", nil, &api_rpc.RPCNotification{
+					Method:  method,
+					Params:  &api_rpc.CallNotice{RequestID: reqModel.ID, Data: params},
+					JsonRPC: "2.0",
+				})
+			})
+			var out map[string][]byte
+			if err == nil {
+				out = sink.Blobs()
+			}
+			write(reqModel.ID, out, api_response.BuildResponse(err, result, reqModel))
+		}()
+	}
+
+	wg.Wait()
+	if err == io.EOF {
+		return nil
+	}
+	return err
+}
+
+// window 调用方允许推送的通知额度
+type window struct {
+	lock  sync.Mutex
+	count int
+	wake  chan struct{}
+}
+
+func newWindow(count int) *window {
+	return &window{count: count, wake: make(chan struct{}, 1)}
+}
+
+// acquire 占用一条额度，没有额度时等待调用方归还；ctx 先结束时返回 false
+func (w *window) acquire(ctx context.Context) bool {
+	for {
+		w.lock.Lock()
+		if w.count > 0 {
+			w.count--
+			w.lock.Unlock()
+			return true
+		}
+		w.lock.Unlock()
+		select {
+		case <-w.wake:
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+func (w *window) grant(count int) {
+	w.lock.Lock()
+	w.count += count
+	w.lock.Unlock()
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// NotifyFunc 调用过程中收到的通知
+type NotifyFunc func(method string, params json.RawMessage)
+
+// message 对端发来的消息：带 id 的是响应，带 method 的是通知
+type message struct {
+	ID     string            `json:"id"`
+	Method string            `json:"method"`
+	Params json.RawMessage   `json:"params"`
+	Result json.RawMessage   `json:"result"`
+	Error  *api_rpc.RPCError `json:"error"`
+}
+
+type callNotice struct {
+	RequestID string          `json:"request_id"`
+	Data      json.RawMessage `json:"data"`
+}
+
+type pendingCall struct {
+	notify NotifyFunc
+	done   chan *message
+	blobs  map[string][]byte
+
+	// 通知放入容量为 noticeWindow 的队列，由该调用自己的 goroutine 按顺序交给 notify，
+	// 处理完的额度通过 protocol.NotifyCredit 归还对端。对端最多领先 noticeWindow 条，
+	// 队列不会写满，notify 阻塞时只影响本调用，readLoop 仍然读取其他调用的消息
+	queue     chan *message
+	finished  chan struct{}
+	abandoned chan struct{}
+	delivered chan struct{}
+	abandon   func()
+}
+
+// noticeWindow 每个调用最多缓存的通知条数，处理完一半后归还额度
+const noticeWindow = 64
+
+func (c *Client) newPendingCall(id string, notify NotifyFunc) *pendingCall {
+	call := &pendingCall{notify: notify, done: make(chan *message, 1), abandon: func() {}}
+	if notify != nil {
+		call.queue = make(chan *message, noticeWindow)
+		call.finished = make(chan struct{})
+		call.abandoned = make(chan struct{})
+		call.delivered = make(chan struct{})
+		call.abandon = sync.OnceFunc(func() {
+			close(call.abandoned)
+			<-call.delivered
+		})
+		go c.deliver(id, call)
+	}
+	return call
+}
+
+// push 将通知放入队列。对端遵守额度时队列不会写满；不支持额度的旧版本对端写满队列后等待 notify，
+// 调用被放弃时丢弃通知
+func (call *pendingCall) push(msg *message) {
+	select {
+	case call.queue <- msg:
+	case <-call.abandoned:
+	}
+}
+
+// deliver 按顺序把通知交给 notify 并归还额度，响应到达后交完队列中剩余的通知再返回
+func (c *Client) deliver(id string, call *pendingCall) {
+	defer close(call.delivered)
+	handled := 0
+	handle := func(msg *message) bool {
+		select {
+		case <-call.abandoned:
+			return false
+		default:
+		}
+		call.notify(msg.Method, msg.Params)
+		if handled++; handled >= noticeWindow/2 {
+			c.credit(id, handled)
+			handled = 0
+		}
+		return true
+	}
+	for {
+		select {
+		case msg := <-call.queue:
+			if !handle(msg) {
+				return
+			}
+		case <-call.finished:
+			// readLoop 先放入通知再交出响应，此时本调用的通知都已在队列中
+			for {
+				select {
+				case msg := <-call.queue:
+					if !handle(msg) {
+						return
+					}
+				default:
+					return
+				}
+			}
+		case <-call.abandoned:
+			return
+		}
+	}
+}
+
+// drain 等待已收到的通知全部交给 notify，ctx 先结束时丢弃剩余的通知并返回 ctx 的错误
+func (call *pendingCall) drain(ctx context.Context) error {
+	if call.notify == nil {
+		return nil
+	}
+	close(call.finished)
+	select {
+	case <-call.delivered:
+		return nil
+	case <-ctx.Done():
+		call.abandon()
+		return ctx.Err()
+	}
+}
+
+// credit 向对端归还 count 条通知额度，调用已结束时对端忽略
+func (c *Client) credit(id string, count int) {
+	_ = c.fw.WriteMessage("", nil, &api_rpc.RPCNotification{
+		Method:  protocol.NotifyCredit,
+		Params:  []interface{}{&protocol.CreditParams{ID: id, Count: count}},
+		JsonRPC: "2.0",
+	})
+}
+
+// ErrClosed 连接已关闭
+var ErrClosed = errors.New("stdio connection closed")
+
+// ErrCancelTimeout 调用被取消后，对端在 CancelGrace 内没有结束该调用
+var ErrCancelTimeout = errors.New("cancelled call did not stop in time")
+
+// Client Serve 的调用端
+type Client struct {
+	// CancelGrace ctx 结束后等待对端结束调用的时间，0 表示不等待；须在发起调用前设置
+	CancelGrace time.Duration
+
+	fw *protocol.Writer
+
+	lock    sync.Mutex
+	pending map[string]*pendingCall
+	nextID  uint64
+	err     error
+	done    chan struct{}
+}
+
+// NewClient 在 r/w 上创建调用端，r 读到 EOF 后所有未完成的调用返回错误
+func NewClient(r io.Reader, w io.Writer) *Client {
+	c := &Client{
+		fw:      protocol.NewWriter(w),
+		pending: make(map[string]*pendingCall),
+		done:    make(chan struct{}),
+	}
+	go c.readLoop(r)
+	return c
+}
+
+func (c *Client) readLoop(r io.Reader) {
+	fr := protocol.NewReader(r)
+	blobs := protocol.NewAssembler()
+	for {
+		f, err := fr.Read()
+		if err != nil {
+			if err == io.EOF {
+				err = ErrClosed
+			}
+			c.fail(err)
+			return
+		}
+		if f.IsBlob() {
+			blobs.Add(f)
+			continue
+		}
+		var msg message
+		if err = json.Unmarshal(f.Body, &msg); err != nil {
+			continue
+		}
+		c.dispatch(&msg, blobs)
+	}
+}
+
+func (c *Client) dispatch(msg *message, blobs *protocol.Assembler) {
+	if msg.Method != "" {
+		var notice callNotice
+		if err := json.Unmarshal(msg.Params, &notice); err != nil {
+			return
+		}
+		c.lock.Lock()
+		call := c.pending[notice.RequestID]
+		c.lock.Unlock()
+		if call != nil && call.notify != nil {
+			call.push(&message{Method: msg.Method, Params: notice.Data})
+		}
+		return
+	}
+
+	c.lock.Lock()
+	call := c.pending[msg.ID]
+	delete(c.pending, msg.ID)
+	c.lock.Unlock()
+	in, err := blobs.Take(msg.ID)
+	if call == nil {
+		return
+	}
+	if err != nil && msg.Error == nil {
+		msg.Error = api_response.RPCError(err)
+	}
+	call.blobs = in
+	call.done <- msg
+}
+
+func (c *Client) fail(err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.err != nil {
+		return
+	}
+	c.err = err
+	close(c.done)
+}
+
+// Done 连接断开时关闭
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err 连接断开的原因
+func (c *Client) Err() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.err
+}
+
+// Call 发起调用并等待响应，params 作为 params[0] 发送，notify 可为 nil。
+// notify 在每个调用自己的 goroutine 中按顺序执行，Call 返回前已收到的通知都已交给 notify；
+// notify 处理得慢时对端暂停推送本调用的通知，不影响其他调用，缓存的通知不超过 noticeWindow 条。
+// ctx 中的 protocol.Blobs 随请求发出，响应附带的二进制数据放入 ctx 中的 protocol.BlobSink。
+// ctx 结束时向对端发送 protocol.NotifyCancel 并返回 ctx 的错误；设置了 CancelGrace 时
+// 先等待对端结束调用，超时则返回同时匹配 ErrCancelTimeout 与 ctx 错误的错误
+func (c *Client) Call(ctx context.Context, method string, params interface{}, notify NotifyFunc) (json.RawMessage, error) {
+	c.lock.Lock()
+	if c.err != nil {
+		c.lock.Unlock()
+		return nil, c.err
+	}
+	c.nextID++
+	id := strconv.FormatUint(c.nextID, 10)
+	call := c.newPendingCall(id, notify)
+	c.pending[id] = call
+	c.lock.Unlock()
+
+	var err error
+	if notify != nil {
+		err = c.fw.WriteMessage("", nil, &api_rpc.RPCNotification{
+			Method:  protocol.NotifyWindow,
+			Params:  []interface{}{&protocol.CreditParams{ID: id, Count: noticeWindow}},
+			JsonRPC: "2.0",
+		})
+	}
+	req := &api_rpc.RPCRequest{Method: method, Params: []interface{}{params}, JsonRPC: "2.0", ID: id}
+	if err == nil {
+		err = c.fw.WriteMessage(id, protocol.Blobs(ctx), req)
+	}
+	if err != nil {
+		c.forget(id)
+		call.abandon()
+		return nil, fmt.Errorf("write request: %w", err)
+	}
+
+	select {
+	case msg := <-call.done:
+		// readLoop 先放入通知再交出响应，此时本调用的通知都已在队列中
+		if err := call.drain(ctx); err != nil {
+			return nil, err
+		}
+		if msg.Error != nil {
+			return nil, msg.Error
+		}
+		for name, data := range call.blobs {
+			_ = protocol.AttachBlob(ctx, name, data)
+		}
+		return msg.Result, nil
+	case <-c.done:
+		c.forget(id)
+		call.abandon()
+		return nil, c.Err()
+	case <-ctx.Done():
+		err := c.cancel(ctx, id, call)
+		call.abandon()
+		return nil, err
+	}
+}
+
+// cancel 通知对端取消调用，按 CancelGrace 等待对端结束
+func (c *Client) cancel(ctx context.Context, id string, call *pendingCall) error {
+	notice := &api_rpc.RPCNotification{
+		Method:  protocol.NotifyCancel,
+		Params:  []interface{}{&protocol.CancelParams{ID: id}},
+		JsonRPC: "2.0",
+	}
+	if err := c.fw.WriteMessage("", nil, notice); err != nil || c.CancelGrace <= 0 {
+		c.forget(id)
+		return ctx.Err()
+	}
+
+	t := time.NewTimer(c.CancelGrace)
+	defer t.Stop()
+	defer c.forget(id)
+	select {
+	case <-call.done:
+	case <-c.done:
+	case <-t.C:
+		return fmt.Errorf("%w: %w", ErrCancelTimeout, ctx.Err())
+	}
+	return ctx.Err()
+}
+
+func (c *Client) forget(id string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	delete(c.pending, id)
+}
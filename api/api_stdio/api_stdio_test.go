@@ -0,0 +1,155 @@
+package api_stdio
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/BlockLucky/dwg-go/api/api_method"
+	"github.com/BlockLucky/dwg-go/api/api_rpc"
+)
+
+type countParams struct {
+	Count int `json:"count"`
+}
+
+// floodSent test.count 已经推送出去的通知数
+var floodSent atomic.Int64
+
+func init() {
+	// test.count 发出 count 条通知后返回 count
+	api_method.RegisterMethod("test.count", func(ctx context.Context, reqModel *api_rpc.RPCRequest, notify api_method.Notifier) (interface{}, error) {
+		var p countParams
+		if err := api_method.DecodeParams(reqModel, &p); err != nil {
+			return nil, err
+		}
+		for i := 0; i < p.Count; i++ {
+			notify("test.tick", i)
+			floodSent.Add(1)
+		}
+		return p.Count, nil
+	})
+}
+
+// newTestClient 在管道上连接 Serve 与 Client
+func newTestClient(t *testing.T) *Client {
+	t.Helper()
+	reqR, reqW := io.Pipe()
+	respR, respW := io.Pipe()
+	go func() {
+		_ = Serve(reqR, respW)
+		_ = respW.Close()
+	}()
+	t.Cleanup(func() {
+		_ = reqW.Close()
+	})
+	return NewClient(respR, reqW)
+}
+
+func TestCallNotifyOrder(t *testing.T) {
+	c := newTestClient(t)
+	var got []int
+	raw, err := c.Call(context.Background(), "test.count", &countParams{Count: 100}, func(method string, params json.RawMessage) {
+		var i int
+		_ = json.Unmarshal(params, &i)
+		got = append(got, i)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(raw) != "100" || len(got) != 100 {
+		t.Fatalf("result %s after %d notices", raw, len(got))
+	}
+	for i, v := range got {
+		if v != i {
+			t.Fatalf("notice %d = %d", i, v)
+		}
+	}
+}
+
+func TestSlowNotifyDoesNotBlockOtherCalls(t *testing.T) {
+	c := newTestClient(t)
+	release := make(chan struct{})
+	first := make(chan error, 1)
+	notices := 0
+	go func() {
+		_, err := c.Call(context.Background(), "test.count", &countParams{Count: 3}, func(method string, params json.RawMessage) {
+			<-release
+			notices++
+		})
+		first <- err
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := c.Call(ctx, "test.count", &countParams{Count: 1}, func(string, json.RawMessage) {}); err != nil {
+		t.Fatalf("second call blocked behind a slow notify: %v", err)
+	}
+	select {
+	case err := <-first:
+		t.Fatalf("first call returned before its notices were delivered: %v", err)
+	default:
+	}
+
+	close(release)
+	if err := <-first; err != nil || notices != 3 {
+		t.Fatalf("first call = %v after %d notices", err, notices)
+	}
+}
+
+func TestCancelStopsNotify(t *testing.T) {
+	c := newTestClient(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	block := make(chan struct{})
+	calls := 0
+	done := make(chan error, 1)
+	go func() {
+		_, err := c.Call(ctx, "test.count", &countParams{Count: 10}, func(method string, params json.RawMessage) {
+			calls++
+			if calls == 1 {
+				<-block
+			}
+		})
+		done <- err
+	}()
+	// 第一条通知阻塞期间取消，Call 丢弃其余通知并等待这条通知处理完
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	time.Sleep(50 * time.Millisecond)
+	close(block)
+	if err := <-done; err != context.Canceled {
+		t.Fatalf("Call = %v, want %v", err, context.Canceled)
+	}
+	if calls != 1 {
+		t.Errorf("notify ran %d times after cancel, want 1", calls)
+	}
+}
+
+func TestSlowNotifyBoundsBufferedNotices(t *testing.T) {
+	c := newTestClient(t)
+	floodSent.Store(0)
+	const total = 1000
+	var delivered, maxAhead int64
+	raw, err := c.Call(context.Background(), "test.count", &countParams{Count: total}, func(method string, params json.RawMessage) {
+		// 前 200 条处理得很慢，对端应当停下来等待额度，而不是把通知全部推过来
+		if delivered < 200 {
+			time.Sleep(time.Millisecond)
+		}
+		if ahead := floodSent.Load() - delivered; ahead > maxAhead {
+			maxAhead = ahead
+		}
+		delivered++
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(raw) != "1000" || delivered != total {
+		t.Fatalf("result %s after %d notices", raw, delivered)
+	}
+	if maxAhead > noticeWindow {
+		t.Errorf("peer ran %d notices ahead of a slow consumer, want at most %d", maxAhead, noticeWindow)
+	}
+}
@@ -0,0 +1,272 @@
+package api_webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	mrand "math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/BlockLucky/dwg-go/protocol"
+)
+
+const (
+	HeaderSignature = "X-DWG-Signature"
+	HeaderTimestamp = "X-DWG-Timestamp"
+	HeaderDelivery  = "X-DWG-Delivery"
+	HeaderEvent     = "X-DWG-Event"
+
+	EventJobFinished = "job.finished"
+)
+
+// 投递日志最多保留的条数
+const maxDeliveries = 5000
+
+// Target 回调地址与签名密钥
+type Target struct {
+	URL    string
+	Secret string
+}
+
+// Payload 任务结束时回调的内容
+type Payload struct {
+	Event      string    `json:"event"`
+	JobID      string    `json:"job_id"`
+	Method     string    `json:"method"`
+	Status     string    `json:"status"`
+	Files      []string  `json:"files,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	FinishedAt time.Time `json:"finished_at"`
+}
+
+// Delivery 一次投递尝试的记录
+type Delivery = protocol.JobDelivery
+
+// Dispatcher 回调投递器，失败时按指数退避重试。AllowPrivate 为 false 时拒绝连接
+// 回环、链路本地与内网地址，在建立连接时按解析出的地址检查，DNS 重绑定也无法绕过
+type Dispatcher struct {
+	Client       *http.Client
+	MaxAttempts  int
+	BaseDelay    time.Duration
+	MaxDelay     time.Duration
+	AllowPrivate bool
+
+	lock       sync.Mutex
+	deliveries []Delivery
+}
+
+var (
+	DefaultDispatcher = NewDispatcher()
+)
+
+func NewDispatcher() *Dispatcher {
+	d := &Dispatcher{
+		MaxAttempts: 6,
+		BaseDelay:   time.Second,
+		MaxDelay:    5 * time.Minute,
+	}
+	dialer := &net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: func(network, address string, c syscall.RawConn) error {
+			if d.AllowPrivate {
+				return nil
+			}
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || blockedIP(ip) {
+				return fmt.Errorf("callback address %s is not allowed", host)
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	d.Client = &http.Client{Timeout: 30 * time.Second, Transport: transport}
+	return d
+}
+
+// ValidateURL 校验回调地址：仅允许 http/https，allowPrivate 为 false 时主机解析出的地址
+// 不能是回环、链路本地（包括 169.254.169.254 等云元数据地址）或内网地址
+func ValidateURL(raw string, allowPrivate bool) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("invalid callback url: %v", err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return fmt.Errorf("invalid callback url: %s", raw)
+	}
+	if allowPrivate {
+		return nil
+	}
+
+	host := u.Hostname()
+	ips := []net.IP{net.ParseIP(host)}
+	if ips[0] == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return fmt.Errorf("invalid callback url: %v", err)
+		}
+		ips = ips[:0]
+		for _, addr := range addrs {
+			ips = append(ips, addr.IP)
+		}
+	}
+	for _, ip := range ips {
+		if blockedIP(ip) {
+			return fmt.Errorf("invalid callback url: %s resolves to non-public address %s", host, ip)
+		}
+	}
+	return nil
+}
+
+// blockedIP 不允许作为回调目标的地址
+func blockedIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast()
+}
+
+// Sign 计算签名：HMAC-SHA256(secret, timestamp + "." + body)，十六进制编码
+func Sign(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify 接收方校验签名
+func Verify(secret string, timestamp string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
+
+// Deliver 在后台投递回调，直到成功、遇到不可重试的响应或达到最大尝试次数
+func (d *Dispatcher) Deliver(target Target, payload *Payload) {
+	go d.deliver(target, payload)
+}
+
+func (d *Dispatcher) deliver(target Target, payload *Payload) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		d.record(Delivery{JobID: payload.JobID, URL: target.URL, Attempt: 1, Error: err.Error(), Time: time.Now()})
+		return
+	}
+
+	deliveryID := newDeliveryID()
+	for attempt := 1; attempt <= d.MaxAttempts; attempt++ {
+		retry := d.attempt(target, payload, body, deliveryID, attempt)
+		if !retry || attempt == d.MaxAttempts {
+			return
+		}
+		time.Sleep(d.backoff(attempt))
+	}
+}
+
+// attempt 单次投递，返回是否需要重试
+func (d *Dispatcher) attempt(target Target, payload *Payload, body []byte, deliveryID string, attempt int) bool {
+	start := time.Now()
+	rec := Delivery{
+		ID:      deliveryID,
+		JobID:   payload.JobID,
+		URL:     target.URL,
+		Attempt: attempt,
+		Time:    start,
+	}
+	defer func() {
+		rec.Duration = time.Since(start)
+		d.record(rec)
+	}()
+
+	req, err := http.NewRequest(http.MethodPost, target.URL, bytes.NewReader(body))
+	if err != nil {
+		rec.Error = err.Error()
+		return false
+	}
+
+	timestamp := strconv.FormatInt(start.Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, payload.Event)
+	req.Header.Set(HeaderDelivery, deliveryID)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	if target.Secret != "" {
+		req.Header.Set(HeaderSignature, Sign(target.Secret, timestamp, body))
+	}
+
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		rec.Error = err.Error()
+		return true
+	}
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+
+	rec.StatusCode = resp.StatusCode
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		rec.Success = true
+		return false
+	}
+
+	rec.Error = resp.Status
+	// 4xx 通常是接收方拒绝，除超时与限流外不再重试
+	if resp.StatusCode >= 400 && resp.StatusCode < 500 &&
+		resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests {
+		return false
+	}
+	return true
+}
+
+// backoff 第 attempt 次失败后的等待时间，指数增长并叠加最多 20% 抖动
+func (d *Dispatcher) backoff(attempt int) time.Duration {
+	delay := time.Duration(float64(d.BaseDelay) * math.Pow(2, float64(attempt-1)))
+	if delay <= 0 || delay > d.MaxDelay {
+		delay = d.MaxDelay
+	}
+	return delay + time.Duration(mrand.Int63n(int64(delay)/5+1))
+}
+
+func (d *Dispatcher) record(rec Delivery) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.deliveries = append(d.deliveries, rec)
+	if len(d.deliveries) > maxDeliveries {
+		d.deliveries = append(d.deliveries[:0:0], d.deliveries[len(d.deliveries)-maxDeliveries:]...)
+	}
+}
+
+// Deliveries 返回指定任务的投递记录，jobID 为空时返回全部
+func (d *Dispatcher) Deliveries(jobID string) []Delivery {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	out := make([]Delivery, 0)
+	for _, rec := range d.deliveries {
+		if jobID == "" || rec.JobID == jobID {
+			out = append(out, rec)
+		}
+	}
+	return out
+}
+
+func newDeliveryID() string {
+	buf := make([]byte, 12)
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
@@ -0,0 +1,219 @@
+package api_webhook
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSignVerify(t *testing.T) {
+	body := []byte(`{"event":"job.finished","job_id":"j1"}`)
+	sig := Sign("secret", "1700000000", body)
+
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp string
+		body      []byte
+		signature string
+		want      bool
+	}{
+		{"round trip", "secret", "1700000000", body, sig, true},
+		{"wrong secret", "other", "1700000000", body, sig, false},
+		{"wrong timestamp", "secret", "1700000001", body, sig, false},
+		{"tampered body", "secret", "1700000000", []byte(`{"event":"job.finished","job_id":"j2"}`), sig, false},
+		{"missing prefix", "secret", "1700000000", body, sig[len("sha256="):], false},
+		{"empty signature", "secret", "1700000000", body, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Verify(tt.secret, tt.timestamp, tt.body, tt.signature); got != tt.want {
+				t.Errorf("Verify() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// receiver 依次按 statuses 响应，超出后重复最后一个；secret 非空时校验签名
+func receiver(t *testing.T, secret string, statuses ...int) (*httptest.Server, *int32) {
+	t.Helper()
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(atomic.AddInt32(&calls, 1))
+		body, _ := io.ReadAll(r.Body)
+		if secret != "" && !Verify(secret, r.Header.Get(HeaderTimestamp), body, r.Header.Get(HeaderSignature)) {
+			t.Errorf("call %d: signature does not verify", n)
+		}
+		if r.Header.Get(HeaderEvent) != EventJobFinished || r.Header.Get(HeaderDelivery) == "" {
+			t.Errorf("call %d: unexpected headers %v", n, r.Header)
+		}
+		if n > len(statuses) {
+			n = len(statuses)
+		}
+		w.WriteHeader(statuses[n-1])
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func testDispatcher(maxAttempts int) *Dispatcher {
+	d := NewDispatcher()
+	d.MaxAttempts = maxAttempts
+	d.BaseDelay = time.Millisecond
+	d.MaxDelay = 4 * time.Millisecond
+	d.AllowPrivate = true
+	return d
+}
+
+func TestDeliverRetries(t *testing.T) {
+	tests := []struct {
+		name        string
+		statuses    []int
+		maxAttempts int
+		wantCalls   int
+		wantSuccess bool
+	}{
+		{"first attempt succeeds", []int{http.StatusOK}, 3, 1, true},
+		{"retries 5xx until success", []int{500, 502, http.StatusNoContent}, 5, 3, true},
+		{"gives up after max attempts", []int{http.StatusServiceUnavailable}, 3, 3, false},
+		{"retries 429", []int{http.StatusTooManyRequests, http.StatusOK}, 3, 2, true},
+		{"does not retry 4xx", []int{http.StatusBadRequest}, 5, 1, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, calls := receiver(t, "s3cret", tt.statuses...)
+			d := testDispatcher(tt.maxAttempts)
+			d.deliver(Target{URL: srv.URL, Secret: "s3cret"}, &Payload{Event: EventJobFinished, JobID: "job-1"})
+
+			if got := int(atomic.LoadInt32(calls)); got != tt.wantCalls {
+				t.Fatalf("receiver got %d calls, want %d", got, tt.wantCalls)
+			}
+			log := d.Deliveries("job-1")
+			if len(log) != tt.wantCalls {
+				t.Fatalf("delivery log has %d entries, want %d", len(log), tt.wantCalls)
+			}
+			for i, rec := range log {
+				if rec.Attempt != i+1 || rec.ID != log[0].ID || rec.URL != srv.URL {
+					t.Errorf("entry %d = %+v", i, rec)
+				}
+				last := i == len(log)-1
+				if rec.Success != (last && tt.wantSuccess) {
+					t.Errorf("entry %d success = %v", i, rec.Success)
+				}
+				if !rec.Success && rec.Error == "" {
+					t.Errorf("entry %d has no error", i)
+				}
+			}
+		})
+	}
+}
+
+func TestDeliveriesFilter(t *testing.T) {
+	srv, _ := receiver(t, "", http.StatusOK)
+	d := testDispatcher(1)
+	d.deliver(Target{URL: srv.URL}, &Payload{Event: EventJobFinished, JobID: "a"})
+	d.deliver(Target{URL: srv.URL}, &Payload{Event: EventJobFinished, JobID: "b"})
+
+	tests := []struct {
+		jobID string
+		want  int
+	}{
+		{"a", 1},
+		{"b", 1},
+		{"c", 0},
+		{"", 2},
+	}
+	for _, tt := range tests {
+		if got := len(d.Deliveries(tt.jobID)); got != tt.want {
+			t.Errorf("Deliveries(%q) has %d entries, want %d", tt.jobID, got, tt.want)
+		}
+	}
+}
+
+func TestDeliveriesCap(t *testing.T) {
+	d := testDispatcher(1)
+	for i := 0; i < maxDeliveries+10; i++ {
+		d.record(Delivery{JobID: "j", Attempt: i})
+	}
+	log := d.Deliveries("")
+	if len(log) != maxDeliveries {
+		t.Fatalf("log has %d entries, want %d", len(log), maxDeliveries)
+	}
+	if log[0].Attempt != 10 {
+		t.Errorf("oldest kept entry is %d, want 10", log[0].Attempt)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	d := &Dispatcher{BaseDelay: time.Second, MaxDelay: 10 * time.Second}
+	tests := []struct {
+		attempt int
+		base    time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{4, 8 * time.Second},
+		{5, 10 * time.Second},
+		{100, 10 * time.Second},
+	}
+	for _, tt := range tests {
+		for i := 0; i < 20; i++ {
+			got := d.backoff(tt.attempt)
+			if got < tt.base || got > tt.base+tt.base/5 {
+				t.Fatalf("backoff(%d) = %s, want within [%s, %s]", tt.attempt, got, tt.base, tt.base+tt.base/5)
+			}
+		}
+	}
+}
+
+func TestValidateURL(t *testing.T) {
+	tests := []struct {
+		url          string
+		allowPrivate bool
+		wantErr      bool
+	}{
+		{"https://93.184.216.34/hook", false, false},
+		{"http://[2606:2800:220:1::1]:8080/hook", false, false},
+		{"ftp://93.184.216.34/hook", false, true},
+		{"https:///hook", false, true},
+		{"http://127.0.0.1:8080/hook", false, true},
+		{"http://localhost/hook", false, true},
+		{"http://[::1]/hook", false, true},
+		{"http://0.0.0.0/hook", false, true},
+		{"http://169.254.169.254/latest/meta-data", false, true},
+		{"http://10.1.2.3/hook", false, true},
+		{"http://172.16.0.1/hook", false, true},
+		{"http://192.168.1.1/hook", false, true},
+		{"http://[fd00::1]/hook", false, true},
+		{"http://[::ffff:127.0.0.1]/hook", false, true},
+		{"http://127.0.0.1:8080/hook", true, false},
+		{"http://192.168.1.1/hook", true, false},
+		{"ftp://127.0.0.1/hook", true, true},
+	}
+	for _, tt := range tests {
+		err := ValidateURL(tt.url, tt.allowPrivate)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ValidateURL(%q, %v) error = %v, want error %v", tt.url, tt.allowPrivate, err, tt.wantErr)
+		}
+	}
+}
+
+func TestDeliverRefusesPrivateAddress(t *testing.T) {
+	srv, calls := receiver(t, "", http.StatusOK)
+	d := testDispatcher(2)
+	d.AllowPrivate = false
+	d.deliver(Target{URL: srv.URL}, &Payload{Event: EventJobFinished, JobID: "j"})
+
+	if got := atomic.LoadInt32(calls); got != 0 {
+		t.Fatalf("receiver got %d calls, want none", got)
+	}
+	for _, rec := range d.Deliveries("j") {
+		if rec.Success || rec.Error == "" {
+			t.Errorf("delivery to loopback was not refused: %+v", rec)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package dwg_go
+
+import (
+	"context"
+
+	"github.com/BlockLucky/dwg-go/protocol"
+)
+
+// AuditOptions 审计参数，Fix 为 true 时修复发现的问题，修复后用 Session.WriteDWG 保存
+type AuditOptions struct {
+	Fix bool
+}
+
+// AuditResult 审计结果
+type AuditResult = protocol.AuditResult
+
+// AuditIssue 审计发现的问题
+type AuditIssue = protocol.AuditIssue
+
+// AuditKind 审计问题的类别
+type AuditKind = protocol.AuditKind
+
+// 审计问题的类别
+const (
+	AuditBrokenOwner       = protocol.AuditBrokenOwner
+	AuditDanglingHandle    = protocol.AuditDanglingHandle
+	AuditDuplicateHandle   = protocol.AuditDuplicateHandle
+	AuditBadHandseed       = protocol.AuditBadHandseed
+	AuditMissingTableEntry = protocol.AuditMissingTableEntry
+	AuditInvalidBlockRef   = protocol.AuditInvalidBlockRef
+)
+
+// Audit 检查图纸中的所有者、句柄与表项引用，只报告不修改；需要修复时用 Open 打开后调用 Session.Audit
+func (c *Client) Audit(ctx context.Context, path string) (*AuditResult, error) {
+	result := &AuditResult{}
+	if err := c.call(ctx, protocol.MethodAudit, &protocol.AuditParams{Path: path}, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Audit 检查会话中的图纸，opts.Fix 为 true 时就地修复：重复句柄重新分配、$HANDSEED 调到最大句柄之后、
+// 失效的所有者改为模型空间、失效的反应器与扩展字典去掉、缺失的图层与线型改为 0 与 BYLAYER、
+// 引用不存在的块定义的块参照被删除。修复无法撤销，Fix 为 true 时清空撤销与重做记录，并中止进行中的事务
+func (s *Session) Audit(ctx context.Context, opts AuditOptions) (*AuditResult, error) {
+	if opts.Fix {
+		s.history.lock.Lock()
+		defer s.history.lock.Unlock()
+		defer s.history.reset()
+	}
+	result := &AuditResult{}
+	if err := s.client.call(ctx, protocol.MethodAudit, &protocol.AuditParams{Session: s.id, Fix: opts.Fix}, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
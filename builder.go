@@ -0,0 +1,291 @@
+package dwg_go
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Units 长度单位，取值与 $INSUNITS 相同
+type Units int
+
+const (
+	Unitless    Units = 0
+	Inches      Units = 1
+	Feet        Units = 2
+	Miles       Units = 3
+	Millimeters Units = 4
+	Centimeters Units = 5
+	Meters      Units = 6
+	Kilometers  Units = 7
+)
+
+// 每个单位的米数
+var unitMeters = map[Units]float64{
+	Inches:      0.0254,
+	Feet:        0.3048,
+	Miles:       1609.344,
+	Millimeters: 0.001,
+	Centimeters: 0.01,
+	Meters:      1,
+	Kilometers:  1000,
+}
+
+// 文字高度默认为 2.5 毫米，图纸无单位时为 2.5
+const defaultTextHeightMM = 2.5
+
+// Pt 平面上的点
+func Pt(x, y float64) Point {
+	return Point{X: x, Y: y}
+}
+
+// Builder 以链式调用向会话添加图形。调用只在本地排队，Build 时一次提交，整体成功或整体不生效，
+// 记为一步撤销。链中参数错误记录下来由 Build 返回，之后的调用被忽略。
+//
+// 坐标、半径与文字高度按 Units 给出的单位换算为图纸的 $INSUNITS，两者之一为 Unitless 时不换算；
+// 角度为弧度。实体默认在图层 0、颜色为 ColorByLayer（256，随层），文字默认高 2.5 毫米，
+// 引用的图层不存在时自动新建
+type Builder struct {
+	sess       *Session
+	units      Units
+	layer      string
+	color      int
+	textHeight float64
+	space      string
+	block      string
+
+	entries []*builderEntry
+	err     error
+}
+
+// builderEntry 排队的操作，坐标为 Builder 单位，Build 时换算
+type builderEntry struct {
+	op         *EditOp
+	textHeight bool
+}
+
+// Builder 在会话上开始链式构建
+func (s *Session) Builder() *Builder {
+	return &Builder{sess: s, layer: "0", color: ColorByLayer, space: SpaceModel}
+}
+
+// Units 之后的坐标与长度使用的单位
+func (b *Builder) Units(u Units) *Builder {
+	if _, ok := unitMeters[u]; !ok && u != Unitless && b.err == nil {
+		b.err = fmt.Errorf("unknown units %d", int(u))
+	}
+	b.units = u
+	return b
+}
+
+// Layer 之后的实体所在的图层，不存在时在 Build 时新建
+func (b *Builder) Layer(name string) *Builder {
+	if name == "" && b.err == nil {
+		b.err = errors.New("layer name is required")
+	}
+	b.layer = name
+	return b
+}
+
+// Color 之后的实体的颜色号，ColorByLayer（256）随层，ColorByBlock（0）随块，1-255 为索引色
+func (b *Builder) Color(aci int) *Builder {
+	if (aci < 0 || aci > 256) && b.err == nil {
+		b.err = fmt.Errorf("color %d out of range [0, 256]", aci)
+	}
+	b.color = aci
+	return b
+}
+
+// TextHeight 之后的文字在未指定高度时使用的高度
+func (b *Builder) TextHeight(h float64) *Builder {
+	b.textHeight = h
+	return b
+}
+
+// Block 新建块定义，之后的实体添加到块中直到 EndBlock
+func (b *Builder) Block(name string, base Point) *Builder {
+	b.add(&EditOp{Op: EditAddBlock, Block: &Block{Name: name, BasePoint: base}}, false)
+	b.space, b.block = SpaceBlock, name
+	return b
+}
+
+// EndBlock 结束块定义，之后的实体回到模型空间
+func (b *Builder) EndBlock() *Builder {
+	return b.Model()
+}
+
+// Model 之后的实体添加到模型空间
+func (b *Builder) Model() *Builder {
+	b.space, b.block = SpaceModel, ""
+	return b
+}
+
+// Paper 之后的实体添加到图纸空间
+func (b *Builder) Paper() *Builder {
+	b.space, b.block = SpacePaper, ""
+	return b
+}
+
+func (b *Builder) Line(p1, p2 Point) *Builder {
+	return b.entity(&Entity{Type: "LINE", Points: []Point{p1, p2}})
+}
+
+func (b *Builder) Polyline(pts []Point, closed bool) *Builder {
+	if len(pts) < 2 && b.err == nil {
+		b.err = fmt.Errorf("polyline needs at least 2 points, got %d", len(pts))
+	}
+	return b.entity(&Entity{Type: "LWPOLYLINE", Points: append([]Point(nil), pts...), Closed: closed})
+}
+
+func (b *Builder) Circle(center Point, radius float64) *Builder {
+	return b.entity(&Entity{Type: "CIRCLE", Center: &center, Radius: radius})
+}
+
+// Arc 圆弧，角度为弧度，逆时针从 start 到 end
+func (b *Builder) Arc(center Point, radius, start, end float64) *Builder {
+	return b.entity(&Entity{Type: "ARC", Center: &center, Radius: radius, StartAngle: start, EndAngle: end})
+}
+
+func (b *Builder) Point(pt Point) *Builder {
+	return b.entity(&Entity{Type: "POINT", Points: []Point{pt}})
+}
+
+// Text 单行文字，height 为 0 时使用 TextHeight 或默认高度
+func (b *Builder) Text(pt Point, text string, height float64) *Builder {
+	return b.text(&Entity{Type: "TEXT", Points: []Point{pt}, Text: text, Height: height})
+}
+
+// MText 多行文字，height 为 0 时使用 TextHeight 或默认高度
+func (b *Builder) MText(pt Point, text string, height float64) *Builder {
+	return b.text(&Entity{Type: "MTEXT", Points: []Point{pt}, Text: text, Height: height})
+}
+
+// Insert 块参照，scale 为三个方向相同的比例（0 为 1），rot 为弧度
+func (b *Builder) Insert(block string, pt Point, scale, rot float64) *Builder {
+	if block == "" && b.err == nil {
+		b.err = errors.New("insert needs a block name")
+	}
+	if scale == 0 {
+		scale = 1
+	}
+	return b.entity(&Entity{Type: "INSERT", Name: block, Points: []Point{pt}, Scale: &Point{X: scale, Y: scale, Z: scale}, Rotation: rot})
+}
+
+func (b *Builder) text(e *Entity) *Builder {
+	useDefault := e.Height == 0
+	if useDefault && b.textHeight != 0 {
+		e.Height, useDefault = b.textHeight, false
+	}
+	e.Layer, e.Color, e.Space, e.Block = b.layer, b.color, b.space, b.block
+	b.add(&EditOp{Op: EditAddEntity, Entity: e}, useDefault)
+	return b
+}
+
+func (b *Builder) entity(e *Entity) *Builder {
+	e.Layer, e.Color, e.Space, e.Block = b.layer, b.color, b.space, b.block
+	b.add(&EditOp{Op: EditAddEntity, Entity: e}, false)
+	return b
+}
+
+func (b *Builder) add(op *EditOp, defaultTextHeight bool) {
+	if b.err != nil {
+		return
+	}
+	b.entries = append(b.entries, &builderEntry{op: op, textHeight: defaultTextHeight})
+}
+
+// Build 提交排队的操作，返回与链中 Block 及各图形调用一一对应的句柄；
+// 自动新建的图层不在其中。提交后 Builder 清空，可以继续使用
+func (b *Builder) Build(ctx context.Context) ([]Handle, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	if len(b.entries) == 0 {
+		return nil, nil
+	}
+	header, err := b.sess.Header(ctx)
+	if err != nil {
+		return nil, err
+	}
+	newLayers, err := b.missingLayers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	factor := unitFactor(b.units, Units(header.InsUnits))
+	textHeight := defaultTextHeightMM * unitFactor(Millimeters, Units(header.InsUnits))
+	ops := make([]*EditOp, 0, len(newLayers)+len(b.entries))
+	for _, name := range newLayers {
+		ops = append(ops, &EditOp{Op: EditAddLayer, Layer: &Layer{Name: name}})
+	}
+	for _, entry := range b.entries {
+		op := scaleOp(entry.op, factor)
+		if entry.textHeight {
+			op.Entity.Height = textHeight
+		}
+		ops = append(ops, op)
+	}
+
+	handles, err := b.sess.Edit(ctx, ops...)
+	if err != nil {
+		return nil, err
+	}
+	b.entries = nil
+	return handles[len(newLayers):], nil
+}
+
+// missingLayers 排队的实体引用但图纸中没有的图层，按首次出现的顺序
+func (b *Builder) missingLayers(ctx context.Context) ([]string, error) {
+	layers, err := b.sess.Layers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	known := make(map[string]bool, len(layers))
+	for _, l := range layers {
+		known[strings.ToUpper(l.Name)] = true
+	}
+	var missing []string
+	for _, entry := range b.entries {
+		if e := entry.op.Entity; e != nil && !known[strings.ToUpper(e.Layer)] {
+			known[strings.ToUpper(e.Layer)] = true
+			missing = append(missing, e.Layer)
+		}
+	}
+	return missing, nil
+}
+
+// unitFactor from 单位的长度换算为 to 单位的倍数，任一方无单位时为 1
+func unitFactor(from, to Units) float64 {
+	f, t := unitMeters[from], unitMeters[to]
+	if f == 0 || t == 0 {
+		return 1
+	}
+	return f / t
+}
+
+// scaleOp 按 factor 换算操作中的坐标与长度，角度与块参照比例不变；返回副本，排队的操作保持原样
+func scaleOp(op *EditOp, factor float64) *EditOp {
+	scale := func(p Point) Point { return Point{X: p.X * factor, Y: p.Y * factor, Z: p.Z * factor} }
+	out := *op
+	if op.Block != nil {
+		blk := *op.Block
+		blk.BasePoint = scale(blk.BasePoint)
+		out.Block = &blk
+	}
+	if op.Entity != nil {
+		e := *op.Entity
+		e.Points = make([]Point, len(op.Entity.Points))
+		for i, p := range op.Entity.Points {
+			e.Points[i] = scale(p)
+		}
+		if e.Center != nil {
+			center := scale(*e.Center)
+			e.Center = &center
+		}
+		e.Radius *= factor
+		e.Height *= factor
+		out.Entity = &e
+	}
+	return &out
+}
@@ -0,0 +1,207 @@
+package dwg_go
+
+import (
+	"context"
+	"math"
+	"slices"
+	"testing"
+)
+
+// near 判断浮点数在误差范围内相等
+func near(a, b float64) bool {
+	return math.Abs(a-b) <= 1e-9*math.Max(1, math.Abs(b))
+}
+
+func TestUnitFactor(t *testing.T) {
+	tests := []struct {
+		from, to Units
+		want     float64
+	}{
+		{Millimeters, Millimeters, 1},
+		{Meters, Millimeters, 1000},
+		{Millimeters, Meters, 0.001},
+		{Inches, Millimeters, 25.4},
+		{Feet, Inches, 12},
+		{Kilometers, Miles, 1000 / 1609.344},
+		{Unitless, Meters, 1},
+		{Meters, Unitless, 1},
+	}
+	for _, tt := range tests {
+		if got := unitFactor(tt.from, tt.to); !near(got, tt.want) {
+			t.Errorf("unitFactor(%d, %d) = %v, want %v", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
+
+func TestScaleOp(t *testing.T) {
+	center, scale := Pt(1, 2), Point{X: 2, Y: 2, Z: 2}
+	op := &EditOp{Op: EditAddEntity, Entity: &Entity{
+		Type: "ARC", Points: []Point{{X: 1, Y: 2, Z: 3}}, Center: &center, Radius: 4, Height: 5,
+		StartAngle: 0.5, EndAngle: 1.5, Rotation: 0.25, Scale: &scale,
+	}}
+	got := scaleOp(op, 10).Entity
+	if got.Points[0] != (Point{X: 10, Y: 20, Z: 30}) || *got.Center != Pt(10, 20) || got.Radius != 40 || got.Height != 50 {
+		t.Errorf("scaled entity = %+v, center %v", got, *got.Center)
+	}
+	if got.StartAngle != 0.5 || got.EndAngle != 1.5 || got.Rotation != 0.25 || *got.Scale != scale {
+		t.Errorf("angles or insert scale changed: %+v", got)
+	}
+	// 排队的操作保持原样
+	if e := op.Entity; e.Points[0] != (Point{X: 1, Y: 2, Z: 3}) || *e.Center != Pt(1, 2) || e.Radius != 4 || e.Height != 5 {
+		t.Errorf("original op modified: %+v", e)
+	}
+
+	blk := scaleOp(&EditOp{Op: EditAddBlock, Block: &Block{Name: "B", BasePoint: Pt(3, 4)}}, 0.5)
+	if blk.Block.BasePoint != Pt(1.5, 2) {
+		t.Errorf("block base point = %v", blk.Block.BasePoint)
+	}
+}
+
+// builtEntities 最后一次 doc.edit 中新建的实体
+func builtEntities(t *testing.T, doc *fakeDoc) []*Entity {
+	t.Helper()
+	if len(doc.edits) == 0 {
+		t.Fatal("no doc.edit call")
+	}
+	var out []*Entity
+	for _, op := range doc.edits[len(doc.edits)-1] {
+		if op.Op == EditAddEntity {
+			out = append(out, op.Entity)
+		}
+	}
+	return out
+}
+
+func TestBuilderTextHeight(t *testing.T) {
+	tests := []struct {
+		name     string
+		drawing  Units
+		build    func(b *Builder) *Builder
+		wantText float64
+		wantX    float64
+	}{
+		{"default in millimeters", Millimeters, func(b *Builder) *Builder { return b.Text(Pt(1, 0), "A", 0) }, 2.5, 1},
+		{"default in meters", Meters, func(b *Builder) *Builder { return b.Text(Pt(1, 0), "A", 0) }, 0.0025, 1},
+		{"default in inches", Inches, func(b *Builder) *Builder { return b.MText(Pt(1, 0), "A", 0) }, 2.5 / 25.4, 1},
+		{"default unitless", Unitless, func(b *Builder) *Builder { return b.Text(Pt(1, 0), "A", 0) }, 2.5, 1},
+		{"builder units do not change the default", Meters, func(b *Builder) *Builder {
+			return b.Units(Millimeters).Text(Pt(1000, 0), "A", 0)
+		}, 0.0025, 1},
+		{"TextHeight in builder units", Millimeters, func(b *Builder) *Builder {
+			return b.Units(Meters).TextHeight(0.005).Text(Pt(1, 0), "A", 0)
+		}, 5, 1000},
+		{"explicit height", Millimeters, func(b *Builder) *Builder {
+			return b.Units(Centimeters).TextHeight(1).Text(Pt(1, 0), "A", 2)
+		}, 20, 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, doc := newFakeSession()
+			doc.insUnits = tt.drawing
+			doc.layers = []*Layer{{Name: "0"}}
+			if _, err := tt.build(s.Builder()).Build(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			e := builtEntities(t, doc)[0]
+			if !near(e.Height, tt.wantText) || !near(e.Points[0].X, tt.wantX) {
+				t.Errorf("height %v at x %v, want %v at x %v", e.Height, e.Points[0].X, tt.wantText, tt.wantX)
+			}
+		})
+	}
+}
+
+func TestBuilderLayersAndHandles(t *testing.T) {
+	ctx := context.Background()
+	s, doc := newFakeSession()
+	doc.layers = []*Layer{{Name: "0"}, {Name: "Walls"}}
+
+	handles, err := s.Builder().
+		Block("DOOR", Pt(0, 0)).Line(Pt(0, 0), Pt(1, 0)).EndBlock().
+		Layer("WALLS").Line(Pt(0, 0), Pt(5, 0)).
+		Layer("TEXT").Color(2).Text(Pt(1, 1), "A", 0).
+		Layer("doors").Insert("DOOR", Pt(2, 0), 0, 0).
+		Layer("text").Circle(Pt(0, 0), 1).
+		Build(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ops := doc.edits[0]
+	var kinds []EditOpKind
+	var newLayers []string
+	for _, op := range ops {
+		kinds = append(kinds, op.Op)
+		if op.Op == EditAddLayer {
+			newLayers = append(newLayers, op.Layer.Name)
+		}
+	}
+	// 缺失的图层按首次出现的顺序、不区分大小写只新建一次，排在其他操作之前
+	if !slices.Equal(newLayers, []string{"TEXT", "doors"}) {
+		t.Errorf("new layers = %v", newLayers)
+	}
+	wantKinds := []EditOpKind{EditAddLayer, EditAddLayer, EditAddBlock, EditAddEntity, EditAddEntity, EditAddEntity, EditAddEntity, EditAddEntity}
+	if !slices.Equal(kinds, wantKinds) {
+		t.Fatalf("ops = %v", kinds)
+	}
+	// 返回的句柄不含新建的图层，与 Block 及各图形调用一一对应
+	want := []Handle{0x102, 0x103, 0x104, 0x105, 0x106, 0x107}
+	if !slices.Equal(handles, want) {
+		t.Errorf("handles = %v, want %v", handles, want)
+	}
+
+	entities := builtEntities(t, doc)
+	tests := []struct {
+		layer string
+		color int
+		space string
+		block string
+	}{
+		{"0", ColorByLayer, SpaceBlock, "DOOR"},
+		{"WALLS", ColorByLayer, SpaceModel, ""},
+		{"TEXT", 2, SpaceModel, ""},
+		{"doors", 2, SpaceModel, ""},
+		{"text", 2, SpaceModel, ""},
+	}
+	for i, tt := range tests {
+		e := entities[i]
+		if e.Layer != tt.layer || e.Color != tt.color || e.Space != tt.space || e.Block != tt.block {
+			t.Errorf("entity %d = layer %q color %d space %q block %q, want %+v", i, e.Layer, e.Color, e.Space, e.Block, tt)
+		}
+	}
+	if scale := entities[3].Scale; scale == nil || *scale != (Point{X: 1, Y: 1, Z: 1}) {
+		t.Errorf("insert scale = %v, want 1", scale)
+	}
+
+	// Build 后 Builder 清空，再次 Build 不发送请求
+	b := s.Builder()
+	if _, err = b.Line(Pt(0, 0), Pt(1, 1)).Build(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if handles, err = b.Build(ctx); err != nil || handles != nil || len(doc.edits) != 2 {
+		t.Errorf("empty Build = %v, %v after %d edits", handles, err, len(doc.edits))
+	}
+}
+
+func TestBuilderErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		build func(b *Builder) *Builder
+	}{
+		{"color out of range", func(b *Builder) *Builder { return b.Color(257).Line(Pt(0, 0), Pt(1, 0)) }},
+		{"unknown units", func(b *Builder) *Builder { return b.Units(99).Line(Pt(0, 0), Pt(1, 0)) }},
+		{"empty layer", func(b *Builder) *Builder { return b.Layer("").Line(Pt(0, 0), Pt(1, 0)) }},
+		{"short polyline", func(b *Builder) *Builder { return b.Polyline([]Point{Pt(0, 0)}, false) }},
+		{"insert without block", func(b *Builder) *Builder { return b.Insert("", Pt(0, 0), 1, 0) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, doc := newFakeSession()
+			if _, err := tt.build(s.Builder()).Circle(Pt(0, 0), 1).Build(context.Background()); err == nil {
+				t.Fatal("Build succeeded")
+			}
+			if len(doc.edits) != 0 {
+				t.Errorf("doc.edit was called %d times", len(doc.edits))
+			}
+		})
+	}
+}
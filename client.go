@@ -0,0 +1,351 @@
+package dwg_go
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/BlockLucky/dwg-go/api/api_rpc"
+	"github.com/BlockLucky/dwg-go/api/api_stdio"
+	"github.com/BlockLucky/dwg-go/protocol"
+)
+
+const (
+	// Close 时等待 dwg_service 自行退出的时间，超时后强制结束
+	serviceExitTimeout = 5 * time.Second
+	// 等待 service.hello 响应的时间
+	helloTimeout = 30 * time.Second
+	// 调用被取消后等待 dwg_service 结束该调用的时间，超时后结束子进程；
+	// 需长于 dwg_service 进程池替换卡住的 worker 所需的时间
+	cancelGrace = 5 * time.Second
+)
+
+// 二进制帧的名称
+const (
+	blobInput  = "input"
+	blobOutput = "output"
+)
+
+type clientOptions struct {
+	servicePath string
+	serviceURL  string
+	serviceArgs []string
+	stderr      io.Writer
+	httpClient  *http.Client
+	authToken   string
+	header      http.Header
+	retry       *RetryPolicy
+	breaker     *BreakerPolicy
+}
+
+type Option func(o *clientOptions)
+
+// WithServicePath 指定 dwg_service 可执行文件路径，设置后不再查找其他位置
+func WithServicePath(path string) Option {
+	return func(o *clientOptions) {
+		o.servicePath = path
+	}
+}
+
+// WithServiceURL 使用远程 dwg_service 的 HTTP 接口（如 http://10.0.0.5:8080），不启动子进程
+func WithServiceURL(url string) Option {
+	return func(o *clientOptions) {
+		o.serviceURL = url
+	}
+}
+
+// WithServiceArgs 启动 dwg_service 时追加的参数
+func WithServiceArgs(args ...string) Option {
+	return func(o *clientOptions) {
+		o.serviceArgs = append(o.serviceArgs, args...)
+	}
+}
+
+// WithStderr dwg_service 的 stderr 输出位置，默认丢弃
+func WithStderr(w io.Writer) Option {
+	return func(o *clientOptions) {
+		o.stderr = w
+	}
+}
+
+// WithHTTPClient 远程模式使用的 http.Client，默认使用保留空闲连接的独立 Transport
+func WithHTTPClient(hc *http.Client) Option {
+	return func(o *clientOptions) {
+		o.httpClient = hc
+	}
+}
+
+// WithAuthToken 远程模式下以 Authorization: Bearer 发送的 token，未设置时读取 DWG_SERVICE_TOKEN
+func WithAuthToken(token string) Option {
+	return func(o *clientOptions) {
+		o.authToken = token
+	}
+}
+
+// WithHeader 远程模式下每个请求附加的 HTTP 头，用于网关认证等
+func WithHeader(key, value string) Option {
+	return func(o *clientOptions) {
+		if o.header == nil {
+			o.header = http.Header{}
+		}
+		o.header.Add(key, value)
+	}
+}
+
+// WithRetry 远程模式下瞬时错误的重试策略，默认 DefaultRetryPolicy
+func WithRetry(p RetryPolicy) Option {
+	return func(o *clientOptions) {
+		o.retry = &p
+	}
+}
+
+// WithCircuitBreaker 远程模式的熔断策略，默认 DefaultBreakerPolicy
+func WithCircuitBreaker(p BreakerPolicy) Option {
+	return func(o *clientOptions) {
+		o.breaker = &p
+	}
+}
+
+// ServiceInfo dwg_service 在握手时返回的版本与能力
+type ServiceInfo = protocol.HelloResult
+
+// connector 与 dwg_service 的连接：本地子进程（stdio）或远程服务（HTTP）
+type connector interface {
+	// call 发起一次调用，notify 接收调用过程中的通知
+	call(ctx context.Context, method string, params interface{}, notify api_stdio.NotifyFunc) (json.RawMessage, error)
+	// info 当前连接的握手结果，连接断开时重新建立
+	info() (*ServiceInfo, error)
+	close() error
+}
+
+// Client dwg_service 的调用端。默认启动 dwg_service 子进程并通过 stdio 通信，LibreDWG 只在子进程中运行，
+// 子进程崩溃后当前调用返回 ErrServiceCrashed，下一次调用时自动重新启动；
+// 远程模式下通过 HTTP 调用，瞬时错误自动重试，持续失败时熔断。Client 可以并发使用
+type Client struct {
+	opts clientOptions
+	conn connector
+}
+
+// NewClient 查找 dwg_service 并完成握手，查找顺序见 discover
+func NewClient(opts ...Option) (*Client, error) {
+	o := clientOptions{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	target, err := discover(&o)
+	if err != nil {
+		return nil, err
+	}
+	var conn connector
+	if target.url != "" {
+		conn, err = newHTTPConn(target.url, &o)
+	} else {
+		conn, err = newStdioConn(target.path, &o)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Client{opts: o, conn: conn}, nil
+}
+
+func helloParams() *protocol.HelloParams {
+	return &protocol.HelloParams{
+		ClientVersion:      Version(),
+		ProtocolVersion:    protocol.Version,
+		MinProtocolVersion: protocol.MinVersion,
+	}
+}
+
+// handshake 调用 service.hello 交换版本，协议不兼容时拒绝使用该 dwg_service；
+// closed 返回连接是否已经断开
+func handshake(call func(ctx context.Context) (json.RawMessage, error), closed func() bool) (*ServiceInfo, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), helloTimeout)
+	defer cancel()
+
+	raw, err := call(ctx)
+	if err != nil {
+		var rpcErr *api_rpc.RPCError
+		switch {
+		case errors.As(err, &rpcErr) && rpcErr.Code == api_rpc.ErrCodeIncompatible:
+			return nil, fmt.Errorf("%w: %s", ErrIncompatibleService, rpcErr.Message)
+		case errors.As(err, &rpcErr) && rpcErr.Code == api_rpc.ErrCodeUnauthorized:
+			return nil, fmt.Errorf("dwg_service handshake: %w", serviceError(err))
+		case errors.As(err, &rpcErr):
+			// 旧版本的 dwg_service 没有 service.hello
+			return nil, fmt.Errorf("%w: %s: %s", ErrIncompatibleService, protocol.MethodHello, rpcErr.Message)
+		case closed():
+			return nil, fmt.Errorf("%w: dwg_service closed the connection during handshake", ErrIncompatibleService)
+		}
+		return nil, fmt.Errorf("dwg_service handshake: %w", err)
+	}
+
+	info := &ServiceInfo{}
+	if err = json.Unmarshal(raw, info); err != nil {
+		return nil, fmt.Errorf("decode %s result: %w", protocol.MethodHello, err)
+	}
+	if err = protocol.CheckVersion(info.MinProtocolVersion, info.ProtocolVersion); err != nil {
+		return nil, fmt.Errorf("%w: dwg_service %s: %w", ErrIncompatibleService, info.ServiceVersion, err)
+	}
+	return info, nil
+}
+
+// ServiceInfo 当前 dwg_service 的版本、LibreDWG 版本与支持的方法、格式
+func (c *Client) ServiceInfo() (*ServiceInfo, error) {
+	return c.conn.info()
+}
+
+// Ping 确认 dwg_service 可用：子进程已退出时重新启动，远程模式下请求一次 service.hello
+func (c *Client) Ping(ctx context.Context) error {
+	if _, err := c.conn.info(); err != nil {
+		return err
+	}
+	_, err := c.conn.call(ctx, protocol.MethodHello, helloParams(), nil)
+	return serviceError(err)
+}
+
+// Close 关闭连接，本地模式下等待 dwg_service 退出
+func (c *Client) Close() error {
+	return c.conn.close()
+}
+
+// invoke 发起调用；dwg_service 不提供该方法时直接返回 ErrUnsupportedMethod
+func (c *Client) invoke(ctx context.Context, method string, params interface{}, notify api_stdio.NotifyFunc) (json.RawMessage, error) {
+	info, err := c.conn.info()
+	if err != nil {
+		return nil, err
+	}
+	if !info.HasMethod(method) {
+		return nil, fmt.Errorf("%w: %s (dwg_service %s)", ErrUnsupportedMethod, method, info.ServiceVersion)
+	}
+	raw, err := c.conn.call(ctx, method, params, notify)
+	return raw, serviceError(err)
+}
+
+// call 调用 dwg_service 方法并将结果解码到 result
+func (c *Client) call(ctx context.Context, method string, params interface{}, result interface{}) error {
+	raw, err := c.invoke(ctx, method, params, nil)
+	if err != nil {
+		return err
+	}
+	if result == nil {
+		return nil
+	}
+	if err = json.Unmarshal(raw, result); err != nil {
+		return fmt.Errorf("decode %s result: %w", method, err)
+	}
+	return nil
+}
+
+// ReadOptions 读取参数。Recover 为 true 时尽量读取损坏的图纸：无法解码的对象被跳过并记入
+// Document.Warnings，只有 LibreDWG 一个对象都没有解码出来时才返回错误
+type ReadOptions struct {
+	Recover bool
+}
+
+// ReadDWG 读取整份图纸；实体数量很大时使用 Entities 分页读取
+func (c *Client) ReadDWG(ctx context.Context, path string) (*Document, error) {
+	return c.ReadDWGWithOptions(ctx, path, ReadOptions{})
+}
+
+// ReadDWGWithOptions 按 opts 读取整份图纸
+func (c *Client) ReadDWGWithOptions(ctx context.Context, path string, opts ReadOptions) (*Document, error) {
+	if err := c.requireRecover(protocol.MethodRead, opts); err != nil {
+		return nil, err
+	}
+	doc := &Document{}
+	if err := c.call(ctx, protocol.MethodRead, &protocol.ReadParams{Path: path, Recover: opts.Recover}, doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// requireRecover 请求恢复模式而 dwg_service 不支持时直接返回 ErrUnsupportedMethod，
+// 避免旧版本忽略 recover 参数按普通模式读取
+func (c *Client) requireRecover(method string, opts ReadOptions) error {
+	if !opts.Recover {
+		return nil
+	}
+	info, err := c.ServiceInfo()
+	if err != nil {
+		return err
+	}
+	if !info.HasCapability(protocol.CapRecover) {
+		return fmt.Errorf("%w: %s with recover (dwg_service %s)", ErrUnsupportedMethod, method, info.ServiceVersion)
+	}
+	return nil
+}
+
+// ConvertOptions 转换参数，Format 为空时按 Output 扩展名推断
+type ConvertOptions = protocol.ConvertParams
+
+type ConvertResult = protocol.ConvertResult
+
+// Convert 转换图纸格式或版本
+func (c *Client) Convert(ctx context.Context, opts ConvertOptions) (*ConvertResult, error) {
+	result := &ConvertResult{}
+	if err := c.call(ctx, protocol.MethodConvert, &opts, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// requireBlobs dwg_service 不支持二进制帧时直接返回 ErrUnsupportedMethod
+func (c *Client) requireBlobs(method string) error {
+	info, err := c.ServiceInfo()
+	if err != nil {
+		return err
+	}
+	if !info.HasCapability(protocol.CapBlobs) {
+		return fmt.Errorf("%w: %s with binary payloads (dwg_service %s)", ErrUnsupportedMethod, method, info.ServiceVersion)
+	}
+	return nil
+}
+
+// ReadDWGBytes 读取内存中的 DWG/DXF 数据，数据以二进制帧发给 dwg_service，不经过 base64 编码
+func (c *Client) ReadDWGBytes(ctx context.Context, data []byte) (*Document, error) {
+	return c.ReadDWGBytesWithOptions(ctx, data, ReadOptions{})
+}
+
+// ReadDWGBytesWithOptions 按 opts 读取内存中的 DWG/DXF 数据
+func (c *Client) ReadDWGBytesWithOptions(ctx context.Context, data []byte, opts ReadOptions) (*Document, error) {
+	if err := c.requireBlobs(protocol.MethodRead); err != nil {
+		return nil, err
+	}
+	if err := c.requireRecover(protocol.MethodRead, opts); err != nil {
+		return nil, err
+	}
+	ctx = protocol.WithBlobs(ctx, map[string][]byte{blobInput: data})
+	doc := &Document{}
+	params := &protocol.ReadParams{InputBlob: blobInput, Recover: opts.Recover}
+	if err := c.call(ctx, protocol.MethodRead, params, doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// ConvertBytes 转换内存中的图纸，format 为 dwg 或 json，返回转换结果的内容
+func (c *Client) ConvertBytes(ctx context.Context, data []byte, format, release string) ([]byte, error) {
+	if err := c.requireBlobs(protocol.MethodConvert); err != nil {
+		return nil, err
+	}
+	ctx, sink := protocol.WithBlobSink(protocol.WithBlobs(ctx, map[string][]byte{blobInput: data}))
+	params := &protocol.ConvertParams{
+		InputBlob:  blobInput,
+		OutputBlob: blobOutput,
+		Format:     format,
+		Release:    release,
+	}
+	if err := c.call(ctx, protocol.MethodConvert, params, nil); err != nil {
+		return nil, err
+	}
+	out, ok := sink.Blobs()[blobOutput]
+	if !ok {
+		return nil, errors.New(protocol.MethodConvert + " returned no output")
+	}
+	return out, nil
+}
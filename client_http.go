@@ -0,0 +1,226 @@
+package dwg_go
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/BlockLucky/dwg-go/api/api_rpc"
+	"github.com/BlockLucky/dwg-go/api/api_stdio"
+	"github.com/BlockLucky/dwg-go/config"
+	"github.com/BlockLucky/dwg-go/protocol"
+)
+
+// 远程模式下 dwg.stream 单行 NDJSON 的最大长度
+const maxStreamLine = 64 << 20
+
+// EnvServiceToken 远程模式下未使用 WithAuthToken 时，从该环境变量读取 token
+const EnvServiceToken = "DWG_SERVICE_TOKEN"
+
+// httpConn 远程 dwg_service 的 HTTP 接口：普通调用 POST /api/v1，
+// dwg.stream 使用 POST /api/v1/stream 逐行接收实体；HTTP 上没有二进制帧，也收不到进度通知。
+// 瞬时错误按 RetryPolicy 重试，连续失败后熔断
+type httpConn struct {
+	endpoint string
+	client   *http.Client
+	header   http.Header
+	retry    RetryPolicy
+	breaker  *circuitBreaker
+	hello    *ServiceInfo
+	nextID   atomic.Uint64
+}
+
+type httpResponse struct {
+	JsonRPC string            `json:"jsonrpc"`
+	Result  json.RawMessage   `json:"result"`
+	Error   *api_rpc.RPCError `json:"error"`
+}
+
+func newHTTPConn(url string, o *clientOptions) (*httpConn, error) {
+	endpoint := strings.TrimRight(url, "/")
+	if !strings.HasSuffix(endpoint, "/api/v1") {
+		endpoint += "/api/v1"
+	}
+	c := &httpConn{
+		endpoint: endpoint,
+		client:   o.httpClient,
+		header:   o.header.Clone(),
+		retry:    DefaultRetryPolicy,
+		breaker:  &circuitBreaker{policy: DefaultBreakerPolicy},
+	}
+	if c.client == nil {
+		c.client = defaultHTTPClient()
+	}
+	if c.header == nil {
+		c.header = http.Header{}
+	}
+	token := o.authToken
+	if token == "" {
+		token = os.Getenv(EnvServiceToken)
+	}
+	if token != "" {
+		c.header.Set("Authorization", "Bearer "+token)
+	}
+	if o.retry != nil {
+		c.retry = *o.retry
+	}
+	if o.breaker != nil {
+		c.breaker.policy = *o.breaker
+	}
+
+	info, err := handshake(func(ctx context.Context) (json.RawMessage, error) {
+		return c.call(ctx, protocol.MethodHello, helloParams(), nil)
+	}, func() bool { return false })
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", url, err)
+	}
+	c.hello = info
+	return c, nil
+}
+
+// defaultHTTPClient 复用连接的 http.Client，同一 dwg_service 保留较多空闲连接以支持并发调用
+func defaultHTTPClient() *http.Client {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.MaxIdleConnsPerHost = 32
+	return &http.Client{Transport: t}
+}
+
+func (c *httpConn) info() (*ServiceInfo, error) {
+	return c.hello, nil
+}
+
+// call 发起调用，瞬时错误按 RetryPolicy 重试；dwg.stream 已经推送过实体后不再重试
+func (c *httpConn) call(ctx context.Context, method string, params interface{}, notify api_stdio.NotifyFunc) (json.RawMessage, error) {
+	body, err := json.Marshal(&api_rpc.RPCRequest{
+		Method:  method,
+		Params:  []interface{}{params},
+		JsonRPC: "2.0",
+		ID:      strconv.FormatUint(c.nextID.Add(1), 10),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	delivered := false
+	if notify != nil {
+		inner := notify
+		notify = func(method string, params json.RawMessage) {
+			delivered = true
+			inner(method, params)
+		}
+	}
+
+	for attempt := 1; ; attempt++ {
+		if err = c.breaker.allow(); err != nil {
+			return nil, err
+		}
+		var result json.RawMessage
+		result, err = c.post(ctx, method, body, notify)
+		c.breaker.done(err)
+		if err == nil {
+			return result, nil
+		}
+		if attempt >= c.retry.MaxAttempts || delivered || !retryable(method, params, err) {
+			return nil, unavailable(err)
+		}
+
+		wait := c.retry.backoff(attempt)
+		var statusErr *httpStatusError
+		if errors.As(err, &statusErr) && statusErr.retryAfter > wait {
+			wait = min(statusErr.retryAfter, c.retry.MaxBackoff)
+		}
+		if sleepErr := sleepContext(ctx, wait); sleepErr != nil {
+			return nil, unavailable(err)
+		}
+	}
+}
+
+// post 发送一次请求
+func (c *httpConn) post(ctx context.Context, method string, body []byte, notify api_stdio.NotifyFunc) (json.RawMessage, error) {
+	url := c.endpoint
+	stream := method == protocol.MethodStream && notify != nil
+	if stream {
+		url += "/stream"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range c.header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+	// dwg_service 按 User-Agent 的名称部分做白名单
+	req.Header.Set("User-Agent", config.ProjectName+"/"+Version())
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var out httpResponse
+	if resp.StatusCode != http.StatusOK {
+		statusErr := &httpStatusError{status: resp.Status, code: resp.StatusCode}
+		if secs, convErr := strconv.Atoi(resp.Header.Get("Retry-After")); convErr == nil && secs > 0 {
+			statusErr.retryAfter = time.Duration(secs) * time.Second
+		}
+		// 401 等由 dwg_service 返回的状态码带有 JSON-RPC 错误
+		if !isTransientStatus(resp.StatusCode) && json.NewDecoder(resp.Body).Decode(&out) == nil && out.Error != nil {
+			return nil, out.Error
+		}
+		return nil, statusErr
+	}
+
+	if stream {
+		if err = readStream(resp, &out, notify); err != nil {
+			return nil, err
+		}
+	} else if err = json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+	if out.Error != nil {
+		return nil, out.Error
+	}
+	return out.Result, nil
+}
+
+// readStream 读取 NDJSON：每行一个实体，带 jsonrpc 字段的最后一行是响应
+func readStream(resp *http.Response, out *httpResponse, notify api_stdio.NotifyFunc) error {
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64<<10), maxStreamLine)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var head struct {
+			JsonRPC string `json:"jsonrpc"`
+		}
+		if err := json.Unmarshal(line, &head); err != nil {
+			return fmt.Errorf("decode stream line: %w", err)
+		}
+		if head.JsonRPC != "" {
+			return json.Unmarshal(line, out)
+		}
+		notify(protocol.NotifyItem, bytes.Clone(line))
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return fmt.Errorf("stream ended without a response: %w", io.ErrUnexpectedEOF)
+}
+
+func (c *httpConn) close() error {
+	return nil
+}
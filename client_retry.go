@@ -0,0 +1,200 @@
+package dwg_go
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/BlockLucky/dwg-go/protocol"
+)
+
+// RetryPolicy 远程模式下瞬时错误的重试策略，MaxAttempts 包含第一次调用，小于 2 时不重试。
+// 瞬时错误指连接失败、连接中断与 HTTP 429/502/503/504；dwg_service 返回的业务错误不重试
+type RetryPolicy struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// DefaultRetryPolicy 远程模式默认的重试策略
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: 200 * time.Millisecond,
+	MaxBackoff:     5 * time.Second,
+}
+
+// backoff 第 attempt 次重试前的等待时间，指数增长并带随机抖动
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.InitialBackoff << (attempt - 1)
+	if d <= 0 || d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + rand.N(d/2+1)
+}
+
+// BreakerPolicy 熔断策略：连续 Threshold 次瞬时错误后，Cooldown 内的调用直接返回 ErrCircuitOpen，
+// 之后放行一次探测调用，成功则恢复；Threshold 为 0 时不熔断
+type BreakerPolicy struct {
+	Threshold int
+	Cooldown  time.Duration
+}
+
+// DefaultBreakerPolicy 远程模式默认的熔断策略
+var DefaultBreakerPolicy = BreakerPolicy{
+	Threshold: 5,
+	Cooldown:  30 * time.Second,
+}
+
+type circuitBreaker struct {
+	policy BreakerPolicy
+
+	lock      sync.Mutex
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+// allow 熔断打开时返回 ErrCircuitOpen；冷却结束后只放行一个探测调用
+func (b *circuitBreaker) allow() error {
+	if b.policy.Threshold <= 0 {
+		return nil
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.failures < b.policy.Threshold {
+		return nil
+	}
+	if wait := time.Until(b.openUntil); wait > 0 || b.probing {
+		return fmt.Errorf("%w: %d consecutive failures, retry in %s", ErrCircuitOpen, b.failures, max(wait, 0).Round(100*time.Millisecond))
+	}
+	b.probing = true
+	return nil
+}
+
+// done 记录一次调用的结果；被调用方取消的调用不计入
+func (b *circuitBreaker) done(err error) {
+	if b.policy.Threshold <= 0 {
+		return
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.probing = false
+	switch {
+	case isTransient(err):
+		b.failures++
+		if b.failures >= b.policy.Threshold {
+			b.openUntil = time.Now().Add(b.policy.Cooldown)
+		}
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+	default:
+		b.failures = 0
+	}
+}
+
+// httpStatusError dwg_service（或其前面的代理）返回了非 200 的状态码
+type httpStatusError struct {
+	status     string
+	code       int
+	retryAfter time.Duration
+}
+
+func (e *httpStatusError) Error() string {
+	return "dwg_service HTTP " + e.status
+}
+
+func isTransientStatus(code int) bool {
+	switch code {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// isTransient 错误是否可能在稍后重试时消失
+func isTransient(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var statusErr *httpStatusError
+	if errors.As(err, &statusErr) {
+		return isTransientStatus(statusErr.code)
+	}
+	var certErr *tls.CertificateVerificationError
+	if errors.As(err, &certErr) {
+		return false
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED)
+}
+
+// notSent 请求确定没有到达 dwg_service：连接没有建立，或服务明确拒绝处理
+func notSent(err error) bool {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	var statusErr *httpStatusError
+	return errors.As(err, &statusErr) &&
+		(statusErr.code == http.StatusTooManyRequests || statusErr.code == http.StatusServiceUnavailable)
+}
+
+// 重复执行会产生副作用的方法，只在请求确定没有到达时重试；
+// doc.close 第一次已关闭会话而响应丢失时，重试会得到会话不存在的错误
+var nonIdempotentMethods = map[string]bool{
+	protocol.MethodJobSubmit: true,
+	protocol.MethodDocOpen:   true,
+	protocol.MethodDocNew:    true,
+	protocol.MethodDocEdit:   true,
+	protocol.MethodDocPurge:  true,
+	protocol.MethodDocClose:  true,
+}
+
+// idempotent 方法以 params 重复执行是否没有副作用；dwg.audit 只在 fix 时修改图纸
+func idempotent(method string, params interface{}) bool {
+	if nonIdempotentMethods[method] {
+		return false
+	}
+	if p, ok := params.(*protocol.AuditParams); ok && method == protocol.MethodAudit {
+		return !p.Fix
+	}
+	return true
+}
+
+func retryable(method string, params interface{}, err error) bool {
+	if !isTransient(err) {
+		return false
+	}
+	return idempotent(method, params) || notSent(err)
+}
+
+// unavailable 重试后仍然失败的瞬时错误按 ErrServiceUnavailable 返回
+func unavailable(err error) error {
+	if isTransient(err) {
+		return fmt.Errorf("%w: %w", ErrServiceUnavailable, err)
+	}
+	return err
+}
+
+// sleepContext 等待 d，ctx 结束时提前返回 ctx 的错误
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
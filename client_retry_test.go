@@ -0,0 +1,211 @@
+package dwg_go
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/BlockLucky/dwg-go/protocol"
+)
+
+func TestRetryBackoff(t *testing.T) {
+	p := RetryPolicy{MaxAttempts: 5, InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+	tests := []struct {
+		attempt int
+		max     time.Duration
+	}{
+		{1, 100 * time.Millisecond},
+		{2, 200 * time.Millisecond},
+		{3, 400 * time.Millisecond},
+		{4, 800 * time.Millisecond},
+		{5, time.Second},
+		{70, time.Second},
+	}
+	for _, tt := range tests {
+		for i := 0; i < 20; i++ {
+			if got := p.backoff(tt.attempt); got < tt.max/2 || got > tt.max {
+				t.Fatalf("backoff(%d) = %s, want within [%s, %s]", tt.attempt, got, tt.max/2, tt.max)
+			}
+		}
+	}
+	if got := (&RetryPolicy{}).backoff(1); got != 0 {
+		t.Errorf("zero policy backoff = %s, want 0", got)
+	}
+}
+
+func TestIsTransient(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"cancelled", context.Canceled, false},
+		{"deadline", fmt.Errorf("call: %w", context.DeadlineExceeded), false},
+		{"dial refused", &net.OpError{Op: "dial", Err: errors.New("connection refused")}, true},
+		{"unexpected eof", fmt.Errorf("read: %w", io.ErrUnexpectedEOF), true},
+		{"503", &httpStatusError{code: http.StatusServiceUnavailable}, true},
+		{"429", &httpStatusError{code: http.StatusTooManyRequests}, true},
+		{"500", &httpStatusError{code: http.StatusInternalServerError}, false},
+		{"service error", ErrUnsupportedVersion, false},
+	}
+	for _, tt := range tests {
+		if got := isTransient(tt.err); got != tt.want {
+			t.Errorf("%s: isTransient = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	lost := fmt.Errorf("read: %w", io.ErrUnexpectedEOF)
+	refused := &net.OpError{Op: "dial", Err: errors.New("connection refused")}
+	tests := []struct {
+		method string
+		params interface{}
+		err    error
+		want   bool
+	}{
+		{protocol.MethodRead, &protocol.ReadParams{}, lost, true},
+		{protocol.MethodAudit, &protocol.AuditParams{Session: "s"}, lost, true},
+		{protocol.MethodAudit, &protocol.AuditParams{Session: "s", Fix: true}, lost, false},
+		{protocol.MethodAudit, &protocol.AuditParams{Session: "s", Fix: true}, refused, true},
+		{protocol.MethodJobSubmit, nil, lost, false},
+		{protocol.MethodDocOpen, nil, lost, false},
+		{protocol.MethodDocNew, nil, lost, false},
+		{protocol.MethodDocEdit, nil, lost, false},
+		{protocol.MethodDocPurge, nil, lost, false},
+		{protocol.MethodDocClose, &protocol.SessionParams{Session: "s"}, lost, false},
+		{protocol.MethodDocClose, &protocol.SessionParams{Session: "s"}, refused, true},
+		{protocol.MethodDocOpen, nil, refused, true},
+		{protocol.MethodDocNew, nil, &httpStatusError{code: http.StatusServiceUnavailable}, true},
+		{protocol.MethodDocEdit, nil, &httpStatusError{code: http.StatusBadGateway}, false},
+		{protocol.MethodRead, nil, context.Canceled, false},
+	}
+	for _, tt := range tests {
+		if got := retryable(tt.method, tt.params, tt.err); got != tt.want {
+			t.Errorf("retryable(%s, %+v, %v) = %v, want %v", tt.method, tt.params, tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	transient := &httpStatusError{code: http.StatusServiceUnavailable}
+	b := &circuitBreaker{policy: BreakerPolicy{Threshold: 2, Cooldown: 20 * time.Millisecond}}
+
+	steps := []struct {
+		name  string
+		sleep time.Duration
+		done  []error
+		open  bool
+	}{
+		{"closed at start", 0, nil, false},
+		{"one failure", 0, []error{transient}, false},
+		{"cancelled calls do not count", 0, []error{context.Canceled}, false},
+		{"threshold reached", 0, []error{transient}, true},
+		{"probe after cooldown", 30 * time.Millisecond, nil, false},
+		{"only one probe", 0, nil, true},
+		{"failed probe reopens", 0, []error{transient}, true},
+		{"second probe", 30 * time.Millisecond, nil, false},
+		{"successful probe closes", 0, []error{nil}, false},
+		{"closed again", 0, nil, false},
+	}
+	for _, st := range steps {
+		time.Sleep(st.sleep)
+		for _, err := range st.done {
+			b.done(err)
+		}
+		err := b.allow()
+		if got := errors.Is(err, ErrCircuitOpen); got != st.open {
+			t.Fatalf("%s: allow() = %v, want open %v", st.name, err, st.open)
+		}
+	}
+
+	off := &circuitBreaker{}
+	for i := 0; i < 10; i++ {
+		off.done(transient)
+	}
+	if err := off.allow(); err != nil {
+		t.Errorf("breaker without threshold opened: %v", err)
+	}
+}
+
+// retryServer 按 script 处理每次请求："ok" 返回结果，"503" 返回状态码，"drop" 读完请求后断开连接
+func retryServer(t *testing.T, script ...string) (*httpConn, *int32) {
+	t.Helper()
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(atomic.AddInt32(&calls, 1))
+		_, _ = io.Copy(io.Discard, r.Body)
+		step := script[min(n, len(script))-1]
+		switch step {
+		case "ok":
+			_, _ = io.WriteString(w, `{"jsonrpc":"2.0","id":"1","result":{"ok":true}}`)
+		case "drop":
+			conn, _, err := w.(http.Hijacker).Hijack()
+			if err == nil {
+				conn.Close()
+			}
+		default:
+			var code int
+			fmt.Sscan(step, &code)
+			w.WriteHeader(code)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return &httpConn{
+		endpoint: srv.URL + "/api/v1",
+		client:   srv.Client(),
+		header:   http.Header{},
+		retry:    RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: 2 * time.Millisecond},
+		breaker:  &circuitBreaker{},
+	}, &calls
+}
+
+// errStatus 期望得到不可重试的 HTTP 状态码错误
+var errStatus = errors.New("http status")
+
+func TestHTTPCallRetry(t *testing.T) {
+	tests := []struct {
+		name      string
+		method    string
+		params    interface{}
+		script    []string
+		wantCalls int32
+		wantErr   error
+	}{
+		{"success", protocol.MethodRead, &protocol.ReadParams{}, []string{"ok"}, 1, nil},
+		{"retries 503", protocol.MethodRead, &protocol.ReadParams{}, []string{"503", "503", "ok"}, 3, nil},
+		{"gives up", protocol.MethodRead, &protocol.ReadParams{}, []string{"503"}, 3, ErrServiceUnavailable},
+		{"no retry on 500", protocol.MethodRead, &protocol.ReadParams{}, []string{"500", "ok"}, 1, errStatus},
+		{"retries lost response", protocol.MethodRead, &protocol.ReadParams{}, []string{"drop", "ok"}, 2, nil},
+		{"doc.open not replayed", protocol.MethodDocOpen, &protocol.OpenParams{}, []string{"drop", "ok"}, 1, ErrServiceUnavailable},
+		{"doc.new retried when refused", protocol.MethodDocNew, &protocol.NewParams{}, []string{"503", "ok"}, 2, nil},
+		{"audit fix not replayed", protocol.MethodAudit, &protocol.AuditParams{Fix: true}, []string{"drop", "ok"}, 1, ErrServiceUnavailable},
+		{"audit replayed", protocol.MethodAudit, &protocol.AuditParams{}, []string{"drop", "ok"}, 2, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, calls := retryServer(t, tt.script...)
+			_, err := c.call(context.Background(), tt.method, tt.params, nil)
+			if got := atomic.LoadInt32(calls); got != tt.wantCalls {
+				t.Errorf("server got %d calls, want %d", got, tt.wantCalls)
+			}
+			var statusErr *httpStatusError
+			switch {
+			case tt.wantErr == nil && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case tt.wantErr == errStatus && !errors.As(err, &statusErr):
+				t.Errorf("error = %v, want an HTTP status error", err)
+			case tt.wantErr != nil && tt.wantErr != errStatus && !errors.Is(err, tt.wantErr):
+				t.Errorf("error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,192 @@
+package dwg_go
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/BlockLucky/dwg-go/api/api_stdio"
+	"github.com/BlockLucky/dwg-go/protocol"
+)
+
+// stdioConn 本地 dwg_service 子进程，子进程退出后下一次调用时重新启动
+type stdioConn struct {
+	path string
+	opts *clientOptions
+
+	lock   sync.Mutex
+	proc   *serviceProcess
+	closed bool
+}
+
+// serviceProcess 一个 dwg_service 子进程，info 为握手结果；
+// killed 表示子进程因被取消的调用没有及时结束而被结束
+type serviceProcess struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	conn   *api_stdio.Client
+	exited chan struct{}
+	info   *ServiceInfo
+	killed atomic.Bool
+}
+
+func newStdioConn(path string, o *clientOptions) (*stdioConn, error) {
+	c := &stdioConn{path: path, opts: o}
+	proc, err := c.start()
+	if err != nil {
+		return nil, err
+	}
+	c.proc = proc
+	return c, nil
+}
+
+func (c *stdioConn) start() (*serviceProcess, error) {
+	cmd := exec.Command(c.path, append([]string{"-stdio"}, c.opts.serviceArgs...)...)
+	cmd.Stderr = c.opts.stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err = cmd.Start(); err != nil {
+		return nil, fmt.Errorf("start dwg_service %s: %w", c.path, err)
+	}
+
+	proc := &serviceProcess{
+		cmd:    cmd,
+		stdin:  stdin,
+		conn:   api_stdio.NewClient(stdout, stdin),
+		exited: make(chan struct{}),
+	}
+	proc.conn.CancelGrace = cancelGrace
+	// 读完 stdout 后再 Wait，Wait 会关闭管道，提前调用可能丢掉最后的响应
+	go func() {
+		<-proc.conn.Done()
+		_ = cmd.Wait()
+		close(proc.exited)
+	}()
+
+	proc.info, err = handshake(func(ctx context.Context) (json.RawMessage, error) {
+		return proc.conn.Call(ctx, protocol.MethodHello, helloParams(), nil)
+	}, func() bool {
+		return proc.conn.Err() != nil
+	})
+	if err != nil {
+		_ = cmd.Process.Kill()
+		<-proc.exited
+		return nil, fmt.Errorf("%s: %w", c.path, err)
+	}
+	return proc, nil
+}
+
+// stop 关闭 stdin 等待子进程退出，超时后强制结束
+func (p *serviceProcess) stop() error {
+	_ = p.stdin.Close()
+
+	select {
+	case <-p.exited:
+	case <-time.After(serviceExitTimeout):
+		_ = p.cmd.Process.Kill()
+		<-p.exited
+	}
+	if !p.cmd.ProcessState.Success() {
+		return fmt.Errorf("dwg_service %s", p.cmd.ProcessState)
+	}
+	return nil
+}
+
+// process 返回可用的子进程，上一个子进程已退出时重新启动
+func (c *stdioConn) process() (*serviceProcess, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.closed {
+		return nil, api_stdio.ErrClosed
+	}
+	if c.proc.conn.Err() == nil && !c.proc.killed.Load() {
+		return c.proc, nil
+	}
+	<-c.proc.exited
+
+	proc, err := c.start()
+	if err != nil {
+		return nil, fmt.Errorf("%w: restart: %w", ErrServiceUnavailable, err)
+	}
+	c.proc = proc
+	return proc, nil
+}
+
+func (c *stdioConn) info() (*ServiceInfo, error) {
+	proc, err := c.process()
+	if err != nil {
+		return nil, err
+	}
+	return proc.info, nil
+}
+
+// call 子进程在调用过程中退出时返回 ErrServiceCrashed。ctx 结束时通知子进程取消调用，
+// 子进程在 cancelGrace 内没有结束该调用（卡在 LibreDWG 中）时结束子进程，下一次调用时重新启动
+func (c *stdioConn) call(ctx context.Context, method string, params interface{}, notify api_stdio.NotifyFunc) (json.RawMessage, error) {
+	proc, err := c.process()
+	if err != nil {
+		return nil, err
+	}
+
+	type reply struct {
+		raw json.RawMessage
+		err error
+	}
+	replies := make(chan reply, 1)
+	go func() {
+		raw, err := proc.conn.Call(ctx, method, params, notify)
+		if errors.Is(err, api_stdio.ErrCancelTimeout) {
+			proc.killed.Store(true)
+			_ = proc.cmd.Process.Kill()
+		}
+		replies <- reply{raw, err}
+	}()
+
+	var r reply
+	select {
+	case r = <-replies:
+	case <-ctx.Done():
+		// 不等待子进程结束被取消的调用，超时后由上面的 goroutine 结束子进程
+		return nil, ctx.Err()
+	}
+	raw, err := r.raw, r.err
+	if err != nil && ctx.Err() == nil && proc.conn.Err() != nil {
+		if proc.killed.Load() {
+			return nil, fmt.Errorf("%w: dwg_service was killed after a cancelled call did not stop, during %s", ErrServiceCrashed, method)
+		}
+		state := "connection closed"
+		select {
+		case <-proc.exited:
+			state = proc.cmd.ProcessState.String()
+		case <-time.After(serviceExitTimeout):
+		}
+		return nil, fmt.Errorf("%w: %s during %s", ErrServiceCrashed, state, method)
+	}
+	return raw, err
+}
+
+// close 关闭连接并等待 dwg_service 退出
+func (c *stdioConn) close() error {
+	c.lock.Lock()
+	if c.closed {
+		c.lock.Unlock()
+		return nil
+	}
+	c.closed = true
+	proc := c.proc
+	c.lock.Unlock()
+
+	return proc.stop()
+}
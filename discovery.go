@@ -0,0 +1,111 @@
+package dwg_go
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// EnvServicePath 指定 dwg_service 的环境变量：可执行文件路径，或 http:// / https:// 开头的远程地址
+const EnvServicePath = "DWG_SERVICE_PATH"
+
+// ErrServiceNotFound 找不到 dwg_service，具体尝试过的位置见 *DiscoveryError
+var ErrServiceNotFound = errors.New("dwg_service not found")
+
+// DiscoveryAttempt 查找 dwg_service 时尝试过的一个位置
+type DiscoveryAttempt struct {
+	// Source 位置的来源：WithServicePath、DWG_SERVICE_PATH、executable dir、PATH
+	Source   string
+	Location string
+	Err      error
+}
+
+// DiscoveryError 列出查找 dwg_service 时尝试过的全部位置
+type DiscoveryError struct {
+	Attempts []DiscoveryAttempt
+}
+
+func (e *DiscoveryError) Error() string {
+	var b strings.Builder
+	b.WriteString("dwg_service not found, tried:")
+	for _, a := range e.Attempts {
+		fmt.Fprintf(&b, "\n  - %s: %s: %v", a.Source, a.Location, a.Err)
+	}
+	fmt.Fprintf(&b, "\ninstall dwg_service next to the executable or in PATH, set %s, or use WithServicePath / WithServiceURL", EnvServicePath)
+	return b.String()
+}
+
+func (e *DiscoveryError) Unwrap() error {
+	return ErrServiceNotFound
+}
+
+// serviceTarget 查找结果，path 与 url 二选一
+type serviceTarget struct {
+	path string
+	url  string
+}
+
+func serviceBinary() string {
+	if runtime.GOOS == "windows" {
+		return "dwg_service.exe"
+	}
+	return "dwg_service"
+}
+
+func isServiceURL(s string) bool {
+	return strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://")
+}
+
+// discover 按顺序查找 dwg_service：WithServiceURL、WithServicePath、DWG_SERVICE_PATH、
+// 当前可执行文件所在目录、PATH。前三者是明确指定的位置，不可用时不再继续查找
+func discover(o *clientOptions) (*serviceTarget, error) {
+	if o.serviceURL != "" {
+		return &serviceTarget{url: o.serviceURL}, nil
+	}
+
+	derr := &DiscoveryError{}
+	try := func(source, location string) (*serviceTarget, bool) {
+		path, err := exec.LookPath(location)
+		if err != nil {
+			derr.Attempts = append(derr.Attempts, DiscoveryAttempt{Source: source, Location: location, Err: err})
+			return nil, false
+		}
+		if path, err = filepath.Abs(path); err != nil {
+			derr.Attempts = append(derr.Attempts, DiscoveryAttempt{Source: source, Location: location, Err: err})
+			return nil, false
+		}
+		return &serviceTarget{path: path}, true
+	}
+
+	if o.servicePath != "" {
+		if t, ok := try("WithServicePath", o.servicePath); ok {
+			return t, nil
+		}
+		return nil, derr
+	}
+
+	if env := os.Getenv(EnvServicePath); env != "" {
+		if isServiceURL(env) {
+			return &serviceTarget{url: env}, nil
+		}
+		if t, ok := try(EnvServicePath, env); ok {
+			return t, nil
+		}
+		return nil, derr
+	}
+
+	if exe, err := os.Executable(); err != nil {
+		derr.Attempts = append(derr.Attempts, DiscoveryAttempt{Source: "executable dir", Location: "?", Err: err})
+	} else if t, ok := try("executable dir", filepath.Join(filepath.Dir(exe), serviceBinary())); ok {
+		return t, nil
+	}
+
+	if t, ok := try("PATH", serviceBinary()); ok {
+		return t, nil
+	}
+	return nil, derr
+}
@@ -0,0 +1,127 @@
+package dwg_go
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// fakeService 在 dir 下创建可执行的 dwg_service，返回其路径
+func fakeService(t *testing.T, dir string) string {
+	t.Helper()
+	path := filepath.Join(dir, serviceBinary())
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// exeDirService 在测试程序所在目录创建 dwg_service，测试结束后删除
+func exeDirService(t *testing.T) string {
+	t.Helper()
+	exe, err := os.Executable()
+	if err != nil {
+		t.Skip(err)
+	}
+	path := filepath.Join(filepath.Dir(exe), serviceBinary())
+	if _, err = os.Stat(path); err == nil {
+		t.Skipf("%s already exists", path)
+	}
+	fakeService(t, filepath.Dir(exe))
+	t.Cleanup(func() { _ = os.Remove(path) })
+	return path
+}
+
+func TestDiscoverOrder(t *testing.T) {
+	optDir, envDir, pathDir := t.TempDir(), t.TempDir(), t.TempDir()
+	opt, env, inPath := fakeService(t, optDir), fakeService(t, envDir), fakeService(t, pathDir)
+	missing := filepath.Join(t.TempDir(), serviceBinary())
+
+	tests := []struct {
+		name     string
+		opts     clientOptions
+		env      string
+		exeDir   bool
+		wantExe  bool
+		wantPath string
+		wantURL  string
+		// 失败时尝试过的位置来源
+		wantSources []string
+	}{
+		{"url option first", clientOptions{serviceURL: "https://dwg.example", servicePath: opt}, env, true, false, "", "https://dwg.example", nil},
+		{"path option before env", clientOptions{servicePath: opt}, env, true, false, opt, "", nil},
+		{"missing path option stops", clientOptions{servicePath: missing}, env, true, false, "", "", []string{"WithServicePath"}},
+		{"env path before executable dir", clientOptions{}, env, true, false, env, "", nil},
+		{"env url", clientOptions{}, "http://dwg.internal:8765", true, false, "", "http://dwg.internal:8765", nil},
+		{"missing env path stops", clientOptions{}, missing, true, false, "", "", []string{EnvServicePath}},
+		{"executable dir before PATH", clientOptions{}, "", true, true, "", "", nil},
+		{"PATH last", clientOptions{}, "", false, false, inPath, "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(EnvServicePath, tt.env)
+			t.Setenv("PATH", pathDir)
+			want := tt.wantPath
+			if tt.exeDir {
+				if exe := exeDirService(t); tt.wantExe {
+					want = exe
+				}
+			}
+
+			target, err := discover(&tt.opts)
+			if tt.wantSources != nil {
+				var derr *DiscoveryError
+				if !errors.As(err, &derr) {
+					t.Fatalf("discover() = %+v, %v; want a DiscoveryError", target, err)
+				}
+				var sources []string
+				for _, a := range derr.Attempts {
+					sources = append(sources, a.Source)
+				}
+				if !slices.Equal(sources, tt.wantSources) {
+					t.Errorf("attempts = %v, want %v", sources, tt.wantSources)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if target.path != want || target.url != tt.wantURL {
+				t.Errorf("discover() = %+v, want path %q url %q", target, want, tt.wantURL)
+			}
+		})
+	}
+}
+
+func TestDiscoverNotFound(t *testing.T) {
+	t.Setenv(EnvServicePath, "")
+	t.Setenv("PATH", t.TempDir())
+
+	_, err := discover(&clientOptions{})
+	if !errors.Is(err, ErrServiceNotFound) {
+		t.Fatalf("discover() = %v, want %v", err, ErrServiceNotFound)
+	}
+	var derr *DiscoveryError
+	if !errors.As(err, &derr) {
+		t.Fatalf("%v is not a DiscoveryError", err)
+	}
+	var sources []string
+	for _, a := range derr.Attempts {
+		sources = append(sources, a.Source)
+		if a.Err == nil || a.Location == "" {
+			t.Errorf("attempt %+v has no location or error", a)
+		}
+	}
+	if !slices.Equal(sources, []string{"executable dir", "PATH"}) {
+		t.Errorf("attempts = %v", sources)
+	}
+	msg := err.Error()
+	for _, s := range []string{"executable dir", "PATH", EnvServicePath, "WithServiceURL"} {
+		if !strings.Contains(msg, s) {
+			t.Errorf("message does not mention %s:\n%s", s, msg)
+		}
+	}
+}
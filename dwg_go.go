@@ -2,6 +2,7 @@ package dwg_go
 
 import "github.com/BlockLucky/dwg-go/config"
 
+// Version 本库的版本，握手时发送给 dwg_service；协议兼容性由 protocol.Version 决定
 func Version() string {
 	return config.ProjectVersion
 }
@@ -0,0 +1,200 @@
+package main
+
+/*
+#include <dwg.h>
+*/
+import "C"
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/BlockLucky/dwg-go/api/api_method"
+	"github.com/BlockLucky/dwg-go/api/api_rpc"
+	"github.com/BlockLucky/dwg-go/protocol"
+)
+
+// methodAudit 检查图纸的句柄与引用；fix 只能作用于会话，修复后用 doc.write 保存
+func methodAudit(ctx context.Context, reqModel *api_rpc.RPCRequest, notify api_method.Notifier) (interface{}, error) {
+	var p protocol.AuditParams
+	if err := api_method.DecodeParams(reqModel, &p); err != nil {
+		return nil, err
+	}
+	if p.Fix && p.Session == "" {
+		return nil, errors.New("fix requires a session")
+	}
+	return withDrawing(p.Session, p.Path, notify, func(d *drawing) (interface{}, error) {
+		return d.audit(ctx, p.Fix)
+	})
+}
+
+// auditor 一次审计的状态
+type auditor struct {
+	d       *drawing
+	fix     bool
+	result  *protocol.AuditResult
+	changed bool
+}
+
+// audit 依次检查重复句柄、$HANDSEED 与各对象的引用，fix 为 true 时就地修复，调用方须持有 dwgLock
+func (d *drawing) audit(ctx context.Context, fix bool) (*protocol.AuditResult, error) {
+	a := &auditor{d: d, fix: fix, result: &protocol.AuditResult{Issues: make([]*protocol.AuditIssue, 0)}}
+	a.handles()
+	if err := a.references(ctx); err != nil {
+		return nil, err
+	}
+	if a.changed {
+		d.indexTables()
+	}
+	if fix {
+		// 客户端在修复后清空撤销记录，删除后保留的对象不再需要
+		d.dropAllParked()
+	}
+	return a.result, nil
+}
+
+// report 记录问题，repair 只在修复模式下调用，返回是否已修复
+func (a *auditor) report(issue *protocol.AuditIssue, repair func() bool) {
+	if a.fix && repair != nil && repair() {
+		issue.Fixed = true
+		a.result.Fixed++
+		a.changed = true
+	}
+	a.result.Issues = append(a.result.Issues, issue)
+}
+
+// handles 重复的句柄改为新分配的句柄，$HANDSEED 调整到最大句柄之后
+func (a *auditor) handles() {
+	d := a.d
+	last := d.maxHandle()
+	seen := make(map[protocol.Handle]bool)
+	n := d.numObjects()
+	for i := 0; i < n; i++ {
+		obj := d.object(i)
+		if !d.live(obj) {
+			continue
+		}
+		h := d.handleOf(obj)
+		if !seen[h] {
+			seen[h] = true
+			continue
+		}
+		a.report(&protocol.AuditIssue{
+			Kind:    protocol.AuditDuplicateHandle,
+			Handle:  h,
+			Type:    objectTypeName(obj),
+			Message: fmt.Sprintf("handle %X is used by more than one object", uint64(h)),
+		}, func() bool {
+			last++
+			d.setHandle(obj, last)
+			return true
+		})
+	}
+	if a.changed {
+		d.indexTables()
+	}
+
+	if seed := d.handseed(); seed <= last {
+		a.report(&protocol.AuditIssue{
+			Kind:    protocol.AuditBadHandseed,
+			Ref:     seed,
+			Message: fmt.Sprintf("$HANDSEED %X is not above the largest handle %X", uint64(seed), uint64(last)),
+		}, func() bool {
+			d.setHandseed(last + 1)
+			return true
+		})
+	}
+}
+
+// references 检查所有者、反应器、扩展字典、图层与线型以及块参照
+func (a *auditor) references(ctx context.Context) error {
+	d := a.d
+	layer0 := d.tableEntry(C.DWG_TYPE_LAYER, "0")
+	byLayer := d.tableEntry(C.DWG_TYPE_LTYPE, "BYLAYER")
+
+	n := d.numObjects()
+	for i := 0; i < n; i++ {
+		if i%progressEvery == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
+		obj := d.object(i)
+		if !d.live(obj) {
+			continue
+		}
+		issue := func(kind protocol.AuditKind, ref protocol.Handle, format string, args ...interface{}) *protocol.AuditIssue {
+			return &protocol.AuditIssue{
+				Kind:    kind,
+				Handle:  d.handleOf(obj),
+				Type:    objectTypeName(obj),
+				Ref:     ref,
+				Message: fmt.Sprintf(format, args...),
+			}
+		}
+
+		owner := d.owner(obj)
+		if d.isEntity(obj) {
+			// 模型空间与图纸空间的实体可以不记录所有者
+			if (owner == 0 && d.entmode(obj) == 0) || (owner != 0 && d.resolveType(owner, C.DWG_TYPE_BLOCK_HEADER) == nil) {
+				a.report(issue(protocol.AuditBrokenOwner, owner, "owner %X is not a block", uint64(owner)), func() bool {
+					if d.modelBlk == 0 {
+						return false
+					}
+					d.moveToModelSpace(obj)
+					return true
+				})
+			}
+		} else if owner != 0 && d.resolve(owner) == nil {
+			a.report(issue(protocol.AuditBrokenOwner, owner, "owner %X does not exist", uint64(owner)), nil)
+		}
+
+		for _, r := range d.reactors(obj) {
+			if r != 0 && d.resolve(r) == nil {
+				a.report(issue(protocol.AuditDanglingHandle, r, "reactor %X does not exist", uint64(r)), func() bool {
+					d.keepReactors(obj, func(h protocol.Handle) bool { return h != r })
+					return true
+				})
+			}
+		}
+		if x := d.xdic(obj); x != 0 && d.resolve(x) == nil {
+			a.report(issue(protocol.AuditDanglingHandle, x, "extension dictionary %X does not exist", uint64(x)), func() bool {
+				d.clearXdic(obj)
+				return true
+			})
+		}
+
+		if !d.isEntity(obj) {
+			continue
+		}
+		if l := d.layerRef(obj); d.resolveType(l, C.DWG_TYPE_LAYER) == nil {
+			a.report(issue(protocol.AuditMissingTableEntry, l, "layer %X does not exist", uint64(l)), func() bool {
+				if layer0 == nil {
+					return false
+				}
+				d.setLayerRef(obj, d.handleOf(layer0))
+				return true
+			})
+		}
+		if lt := d.ltypeRef(obj); lt != 0 && d.resolveType(lt, C.DWG_TYPE_LTYPE) == nil {
+			a.report(issue(protocol.AuditMissingTableEntry, lt, "linetype %X does not exist", uint64(lt)), func() bool {
+				if byLayer == nil {
+					return false
+				}
+				d.setLtypeRef(obj, d.handleOf(byLayer))
+				return true
+			})
+		}
+		if obj.fixedtype == C.DWG_TYPE_INSERT {
+			if b := d.insertBlock(obj); d.resolveType(b, C.DWG_TYPE_BLOCK_HEADER) == nil {
+				// 与 AutoCAD 的 AUDIT 一致，引用不存在的块定义的块参照被删除
+				a.report(issue(protocol.AuditInvalidBlockRef, b, "block %X does not exist", uint64(b)), func() bool {
+					d.erase(obj)
+					return true
+				})
+			}
+		}
+	}
+	return nil
+}
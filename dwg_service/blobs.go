@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/BlockLucky/dwg-go/protocol"
+)
+
+// dwgMagic DWG 文件以 AC10xx 版本号开头，其余内容按 DXF 处理
+var dwgMagic = []byte("AC10")
+
+// blobInput 将请求附带的二进制数据写入临时文件，LibreDWG 只能从文件读取；
+// 返回的 cleanup 删除临时文件
+func blobInput(ctx context.Context, name string) (string, func(), error) {
+	data, ok := protocol.Blob(ctx, name)
+	if !ok {
+		return "", nil, fmt.Errorf("blob %q not found in request", name)
+	}
+	ext := ".dxf"
+	if bytes.HasPrefix(data, dwgMagic) {
+		ext = ".dwg"
+	}
+
+	f, err := os.CreateTemp("", "dwg-input-*"+ext)
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup := func() { _ = os.Remove(f.Name()) }
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	return f.Name(), cleanup, nil
+}
+
+// blobOutput 创建转换结果的临时输出路径，cleanup 删除临时目录；
+// 调用不是经由帧传输发起时无法返回二进制数据，直接报错
+func blobOutput(ctx context.Context, format string) (string, func(), error) {
+	if protocol.BlobSinkFrom(ctx) == nil {
+		return "", nil, protocol.ErrNoBlobSink
+	}
+	dir, err := os.MkdirTemp("", "dwg-output-*")
+	if err != nil {
+		return "", nil, err
+	}
+	return filepath.Join(dir, "output."+format), func() { _ = os.RemoveAll(dir) }, nil
+}
+
+// attachFile 将文件内容作为二进制数据附加到调用结果中
+func attachFile(ctx context.Context, name, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return protocol.AttachBlob(ctx, name, data)
+}
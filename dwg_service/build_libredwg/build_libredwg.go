@@ -105,6 +105,10 @@ type buildCtx struct {
 
 	// wd
 	wd string
+
+	// 实际构建的 LibreDWG 提交与版本（git describe）
+	commit  string
+	version string
 }
 
 func mustGetwd() string {
@@ -323,6 +327,10 @@ func ensureSource(ctx *buildCtx) {
 	// checkout ref
 	runCmd(ctx.srcDir, "git", "checkout", RepoRef)
 	runCmd(ctx.srcDir, "git", "submodule", "update", "--init", "--recursive")
+
+	ctx.commit = strings.TrimSpace(string(outputCmd(ctx.srcDir, "git", "rev-parse", "HEAD")))
+	ctx.version = strings.TrimSpace(string(outputCmd(ctx.srcDir, "git", "describe", "--tags", "--always")))
+	fmt.Printf("libredwg commit: %s (%s)\n", ctx.commit, ctx.version)
 }
 
 // ============================================================
@@ -672,6 +680,9 @@ func generateCgo(ctx *buildCtx) {
 	fmt.Fprintf(f, "// #cgo LDFLAGS: %s\n", ld)
 	fmt.Fprintln(f, `import "C"`)
 
+	// 记录构建所用的 LibreDWG 提交与版本，隔离区的复现包与 service.hello 中会带上它们
+	fmt.Fprintf(f, "\nfunc init() {\n\tlibredwgCommit = %q\n\tlibredwgVersion = %q\n}\n", ctx.commit, ctx.version)
+
 	fmt.Printf("Generated cgo file: %s\n", outPath)
 }
 
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/BlockLucky/dwg-go/protocol"
+)
+
+// dwgReleases LibreDWG 能完整读取的 DWG 版本（R13 起），键为文件开头的版本号
+var dwgReleases = map[string]string{
+	"AC1012": "R13",
+	"AC1014": "R14",
+	"AC1015": "R2000",
+	"AC1018": "R2004",
+	"AC1021": "R2007",
+	"AC1024": "R2010",
+	"AC1027": "R2013",
+	"AC1032": "R2018",
+}
+
+// LibreDWG DWG_ERROR 的各个位，与 dwg.h 中的取值相同
+var dwgErrorNames = []struct {
+	bit  int
+	name string
+}{
+	{1, "wrong CRC"},
+	{2, "not yet supported"},
+	{4, "unhandled class"},
+	{8, "invalid type"},
+	{16, "invalid handle"},
+	{32, "invalid EED"},
+	{64, "value out of bounds"},
+	{128, "classes not found"},
+	{256, "section not found"},
+	{512, "page not found"},
+	{1024, "internal error"},
+	{2048, "invalid DWG"},
+	{4096, "I/O error"},
+	{8192, "out of memory"},
+}
+
+const (
+	dwgErrWrongCRC        = 1
+	dwgErrClassesNotFound = 128
+	dwgErrIO              = 4096
+	dwgErrOutOfMem        = 8192
+)
+
+// R2004 起文件头 0x18 处的安全标志，加密数据或加密属性时需要密码才能打开
+const (
+	securityOffset        = 0x18
+	securityEncryptData   = 0x1
+	securityEncryptProps  = 0x2
+	fileHeaderProbeLength = 0x80
+)
+
+// checkDWGHeader 在交给 LibreDWG 之前检查文件头：不是 DWG、版本不受支持、设置了密码时直接返回对应的错误
+func checkDWGHeader(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	head := make([]byte, fileHeaderProbeLength)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	head = head[:n]
+	if len(head) < 6 || !bytes.HasPrefix(head, []byte("AC")) {
+		return &protocol.CorruptError{Section: "file header", Detail: "not a DWG file"}
+	}
+
+	version := string(head[:6])
+	if _, ok := dwgReleases[version]; !ok {
+		return &protocol.UnsupportedVersionError{Version: version}
+	}
+	if version >= "AC1018" && len(head) >= securityOffset+4 {
+		if flags := binary.LittleEndian.Uint32(head[securityOffset:]); flags&(securityEncryptData|securityEncryptProps) != 0 {
+			return fmt.Errorf("%w (security flags 0x%x)", protocol.ErrEncrypted, flags)
+		}
+	}
+	return nil
+}
+
+// readError 将 LibreDWG 读取失败的错误码转换为错误类别；
+// R13–R2000 的 DWG 会检查文件头与节的位置，尽量给出损坏的节、偏移与校验和
+func readError(path string, dxf bool, code int) error {
+	detail := fmt.Sprintf("libredwg error 0x%x (%s)", code, dwgErrorString(code))
+	if code&(dwgErrIO|dwgErrOutOfMem) != 0 {
+		return fmt.Errorf("libredwg read %s failed: %s", path, detail)
+	}
+	if !dxf {
+		if corrupt := scanR2000(path, code&dwgErrWrongCRC != 0); corrupt != nil {
+			corrupt.Detail = detail
+			return corrupt
+		}
+	}
+	return &protocol.CorruptError{Detail: detail}
+}
+
+// readWarnings 恢复模式下将 LibreDWG 的错误码转换为警告，R13–R2000 的 DWG 附带找到的损坏位置
+func readWarnings(path string, dxf bool, code int) []*protocol.Warning {
+	if code == 0 {
+		return nil
+	}
+	w := &protocol.Warning{Message: fmt.Sprintf("libredwg error 0x%x (%s)", code, dwgErrorString(code))}
+	if code&dwgErrClassesNotFound != 0 {
+		w.Section = "classes"
+	}
+	warnings := []*protocol.Warning{w}
+	if !dxf {
+		if corrupt := scanR2000(path, code&dwgErrWrongCRC != 0); corrupt != nil {
+			warnings = append(warnings, &protocol.Warning{Section: corrupt.Section, Message: corrupt.Error()})
+		}
+	}
+	return warnings
+}
+
+func dwgErrorString(code int) string {
+	var names []string
+	for _, e := range dwgErrorNames {
+		if code&e.bit != 0 {
+			names = append(names, e.name)
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+// R13–R2000 文件头之后与各节开头的哨兵
+var (
+	fileHeaderSentinel = []byte{0x95, 0xA0, 0x4E, 0x28, 0x99, 0x82, 0x1A, 0xE5, 0x5E, 0x41, 0xE0, 0x5F, 0x9D, 0x3A, 0x4D, 0x00}
+	sectionSentinels   = map[byte][]byte{
+		0: {0xCF, 0x7B, 0x1F, 0x23, 0xFD, 0xDE, 0x38, 0xA9, 0x5F, 0x7C, 0x68, 0xB8, 0x4E, 0x6D, 0x33, 0x5F},
+		1: {0x8D, 0xA1, 0xC4, 0xB8, 0xC4, 0xA9, 0xF8, 0xC5, 0xC0, 0xDC, 0xF4, 0x5F, 0xE7, 0xCF, 0xB6, 0x8A},
+	}
+	sectionNames = map[byte]string{
+		0: "header",
+		1: "classes",
+		2: "handles",
+		3: "objfreespace",
+		4: "template",
+		5: "auxheader",
+	}
+	// 文件头 CRC 按节定位记录数异或的常量
+	fileHeaderCRCXor = map[uint32]uint16{3: 0xA598, 4: 0x8101, 5: 0x3CC4, 6: 0x8461}
+)
+
+const (
+	locatorCountOffset = 0x15
+	locatorSize        = 9
+	// 节内数据的 CRC 初值
+	sectionCRCSeed = 0xC0C1
+)
+
+// scanR2000 检查 R13–R2000 的文件头与节定位记录，返回找到的第一处损坏；
+// checkCRC 为 true（LibreDWG 报告了 CRC 错误）时才比较校验和
+func scanR2000(path string, checkCRC bool) *protocol.CorruptError {
+	data, err := os.ReadFile(path)
+	if err != nil || len(data) < 6 {
+		return nil
+	}
+	switch string(data[:6]) {
+	case "AC1012", "AC1014", "AC1015":
+	default:
+		return nil
+	}
+
+	size := int64(len(data))
+	if size < locatorCountOffset+4 {
+		return &protocol.CorruptError{Section: "file header", Offset: size, Detail: "truncated"}
+	}
+	count := binary.LittleEndian.Uint32(data[locatorCountOffset:])
+	crcOffset := int64(locatorCountOffset+4) + int64(count)*locatorSize
+	if count > 16 || crcOffset+2+int64(len(fileHeaderSentinel)) > size {
+		return &protocol.CorruptError{Section: "file header", Offset: locatorCountOffset}
+	}
+
+	if checkCRC {
+		stored := binary.LittleEndian.Uint16(data[crcOffset:])
+		// 文件头 CRC 的初值在各份资料中分别为 0 与 0xC0C1，两者之一相符即可
+		xor := fileHeaderCRCXor[count]
+		withSeed := crc16(sectionCRCSeed, data[:crcOffset]) ^ xor
+		if stored != crc16(0, data[:crcOffset])^xor && stored != withSeed {
+			return &protocol.CorruptError{Section: "file header", Offset: crcOffset, ExpectedCRC: uint32(stored), ActualCRC: uint32(withSeed)}
+		}
+	}
+	if !bytes.Equal(data[crcOffset+2:crcOffset+2+int64(len(fileHeaderSentinel))], fileHeaderSentinel) {
+		return &protocol.CorruptError{Section: "file header", Offset: crcOffset + 2, Detail: "missing sentinel"}
+	}
+
+	for i := int64(0); i < int64(count); i++ {
+		rec := data[locatorCountOffset+4+i*locatorSize:]
+		number := rec[0]
+		addr := int64(binary.LittleEndian.Uint32(rec[1:]))
+		length := int64(binary.LittleEndian.Uint32(rec[5:]))
+		name := sectionNames[number]
+		if name == "" {
+			name = fmt.Sprintf("#%d", number)
+		}
+		if length == 0 {
+			continue
+		}
+		if addr+length > size {
+			return &protocol.CorruptError{Section: name, Offset: addr, Detail: fmt.Sprintf("%d bytes past end of file", addr+length-size)}
+		}
+		sentinel := sectionSentinels[number]
+		if sentinel == nil {
+			continue
+		}
+		if !bytes.HasPrefix(data[addr:], sentinel) {
+			return &protocol.CorruptError{Section: name, Offset: addr, Detail: "missing sentinel"}
+		}
+		// 哨兵之后为 RL 长度、数据与 RS CRC，CRC 覆盖长度与数据
+		body := addr + int64(len(sentinel))
+		if !checkCRC || body+4 > size {
+			continue
+		}
+		n := int64(binary.LittleEndian.Uint32(data[body:]))
+		end := body + 4 + n
+		if end+2 > size {
+			return &protocol.CorruptError{Section: name, Offset: body, Detail: "section size past end of file"}
+		}
+		stored := binary.LittleEndian.Uint16(data[end:])
+		if actual := crc16(sectionCRCSeed, data[body:end]); stored != actual {
+			return &protocol.CorruptError{Section: name, Offset: end, ExpectedCRC: uint32(stored), ActualCRC: uint32(actual)}
+		}
+	}
+	return nil
+}
+
+// crc16 DWG 使用的 CRC-16（多项式 0x8005，按位反转）
+func crc16(seed uint16, data []byte) uint16 {
+	crc := seed
+	for _, b := range data {
+		crc ^= uint16(b)
+		for i := 0; i < 8; i++ {
+			if crc&1 != 0 {
+				crc = crc>>1 ^ 0xA001
+			} else {
+				crc >>= 1
+			}
+		}
+	}
+	return crc
+}
@@ -1 +1,162 @@
 package dwg_service_conf
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"strings"
+
+	"github.com/BlockLucky/dwg-go/api/api_config"
+	"github.com/BlockLucky/dwg-go/protocol"
+)
+
+type ServiceConfig struct {
+	Api     api_config.ApiConfig `yaml:"api" json:"api"`
+	Session SessionConfig        `yaml:"session" json:"session"`
+	Pool    PoolConfig           `yaml:"pool" json:"pool"`
+	// 仅 worker 进程池模式下生效
+	Quarantine QuarantineConfig `yaml:"quarantine" json:"quarantine"`
+	Sandbox    SandboxConfig    `yaml:"sandbox" json:"sandbox"`
+}
+
+// SessionConfig doc.open 会话配置，会话内存按 文件大小 × MemoryFactor 预估
+type SessionConfig struct {
+	IdleTTLSeconds int     `yaml:"idle_ttl_seconds" json:"idle_ttl_seconds"`
+	MaxSessions    int     `yaml:"max_sessions" json:"max_sessions"`
+	MaxMemoryMB    int64   `yaml:"max_memory_mb" json:"max_memory_mb"`
+	MemoryFactor   float64 `yaml:"memory_factor" json:"memory_factor"`
+}
+
+// PoolConfig worker 进程池配置，Workers 为 0 时在本进程内调用 LibreDWG；
+// 会话限制对每个 worker 分别生效。同一文件导致 worker 崩溃 MaxCrashes 次后，
+// CrashTTLSeconds 内不再交给 worker 处理
+type PoolConfig struct {
+	Workers         int   `yaml:"workers" json:"workers"`
+	MaxRequests     int64 `yaml:"max_requests" json:"max_requests"`
+	MaxRSSMB        int64 `yaml:"max_rss_mb" json:"max_rss_mb"`
+	MaxCrashes      int   `yaml:"max_crashes" json:"max_crashes"`
+	CrashTTLSeconds int   `yaml:"crash_ttl_seconds" json:"crash_ttl_seconds"`
+
+	Limits LimitsConfig `yaml:"limits" json:"limits"`
+}
+
+// LimitsConfig worker 单次调用的资源限制，0 表示不限；超出时结束 worker 并返回 limit_exceeded。
+// 除 TimeoutSeconds 外仅 Linux 有效。MemoryMB 为 RLIMIT_DATA，只计算实际映射的堆内存，
+// 不含 Go 运行时预留的虚拟地址空间；过小时 worker 无法启动，不能低于 MinMemoryMB
+type LimitsConfig struct {
+	TimeoutSeconds int   `yaml:"timeout_seconds" json:"timeout_seconds"`
+	CPUSeconds     int   `yaml:"cpu_seconds" json:"cpu_seconds"`
+	MemoryMB       int64 `yaml:"memory_mb" json:"memory_mb"`
+	MaxOutputMB    int64 `yaml:"max_output_mb" json:"max_output_mb"`
+}
+
+// MinMemoryMB limits.memory_mb 的最小值，Go 运行时与 LibreDWG 启动时即需要这些堆内存
+const MinMemoryMB = 64
+
+// QuarantineConfig 导致 worker 崩溃的输入文件及复现信息的保存位置，Dir 为空时不保存
+type QuarantineConfig struct {
+	Dir        string `yaml:"dir" json:"dir"`
+	MaxEntries int    `yaml:"max_entries" json:"max_entries"`
+}
+
+// SandboxConfig 运行 LibreDWG 的进程（worker，或不使用进程池时的 -stdio 进程）的沙箱，仅 Linux：
+// 只能读取 ReadPaths、读写 WritePaths，不能创建网络 socket 与 exec；以 root 启动时切换到 UID/GID（默认 65534）
+type SandboxConfig struct {
+	Enabled    bool     `yaml:"enabled" json:"enabled"`
+	ReadPaths  []string `yaml:"read_paths" json:"read_paths"`
+	WritePaths []string `yaml:"write_paths" json:"write_paths"`
+	UID        int      `yaml:"uid" json:"uid"`
+	GID        int      `yaml:"gid" json:"gid"`
+}
+
+// EnvAuthTokens 逗号分隔的 API token，追加到 api.auth_tokens，便于从 Secret 注入而不写入配置文件
+const EnvAuthTokens = "DWG_SERVICE_AUTH_TOKENS"
+
+var (
+	CurrentServiceConfig *ServiceConfig
+)
+
+// DefaultMethods dwg_service 对外提供的全部 RPC 方法；admin.* 方法只有配置了 auth_tokens 时才能通过 HTTP 调用
+var DefaultMethods = []string{
+	protocol.MethodHello,
+	protocol.MethodRead,
+	protocol.MethodConvert,
+	protocol.MethodEntities,
+	protocol.MethodStream,
+	protocol.MethodDocOpen,
+	protocol.MethodDocHeader,
+	protocol.MethodDocLayers,
+	protocol.MethodDocBlocks,
+	protocol.MethodDocEntities,
+	protocol.MethodDocWrite,
+	protocol.MethodDocPurge,
+	protocol.MethodDocObject,
+	protocol.MethodDocEdit,
+	protocol.MethodDocNew,
+	protocol.MethodDocClose,
+	protocol.MethodAudit,
+	protocol.MethodPoolStats,
+	protocol.MethodJobSubmit,
+	protocol.MethodJobGet,
+	protocol.MethodJobDeliveries,
+	protocol.MethodJobSubscribe,
+	protocol.MethodJobUnsubscribe,
+	protocol.MethodQuarantineList,
+	protocol.MethodQuarantineGet,
+	protocol.MethodQuarantinePurge,
+}
+
+// DefaultConfig 默认配置
+func DefaultConfig() *ServiceConfig {
+	return &ServiceConfig{
+		Api: api_config.ApiConfig{
+			Enabled:           true,
+			Port:              8765,
+			UserAgentAllowed:  []string{"dwg-go"},
+			APIMethodsAllowed: append([]string(nil), DefaultMethods...),
+			MaxBodyMB:         api_config.DefaultMaxBodyMB,
+		},
+		Session: SessionConfig{
+			IdleTTLSeconds: 600,
+			MaxSessions:    32,
+			MaxMemoryMB:    4096,
+			MemoryFactor:   12,
+		},
+		Pool: PoolConfig{
+			MaxRequests:     1000,
+			MaxRSSMB:        2048,
+			MaxCrashes:      2,
+			CrashTTLSeconds: 86400,
+			Limits: LimitsConfig{
+				TimeoutSeconds: 600,
+			},
+		},
+		Quarantine: QuarantineConfig{
+			Dir:        "quarantine",
+			MaxEntries: 200,
+		},
+	}
+}
+
+// LoadConfig 读取 JSON 配置文件，文件不存在时使用默认配置
+func LoadConfig(path string) (*ServiceConfig, error) {
+	cfg := DefaultConfig()
+
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	if err == nil {
+		if err = json.Unmarshal(data, cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, token := range strings.Split(os.Getenv(EnvAuthTokens), ",") {
+		if token = strings.TrimSpace(token); token != "" {
+			cfg.Api.AuthTokens = append(cfg.Api.AuthTokens, token)
+		}
+	}
+	return cfg, nil
+}
@@ -0,0 +1,586 @@
+package dwg_service_pool
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/BlockLucky/dwg-go/api/api_stdio"
+	"github.com/BlockLucky/dwg-go/protocol"
+)
+
+// AnyWorker Call 时不指定 worker，由空闲的 worker 处理
+const AnyWorker = -1
+
+// MethodWorkerStats worker 进程需要提供的内部方法，回收前用来确认 worker 上没有常驻会话
+const MethodWorkerStats = protocol.MethodWorkerStats
+
+const (
+	// worker 关闭 stdin 后等待退出的时间，超时后强制结束
+	stopTimeout = 5 * time.Second
+	// worker 启动失败后重试的间隔
+	restartDelay = time.Second
+	// 崩溃时保留的 stderr 末尾字节数
+	stderrTail = 16 << 10
+	// 调用被取消后等待 worker 结束该调用的时间，超时说明 worker 卡在 LibreDWG 中，结束并替换它
+	cancelGrace = 2 * time.Second
+)
+
+// ErrPoolClosed 进程池已关闭，调用方按 protocol.ErrServiceUnavailable 处理
+var ErrPoolClosed = fmt.Errorf("%w: worker pool closed", protocol.ErrServiceUnavailable)
+
+// CrashError worker 在处理调用的过程中退出（通常是 LibreDWG 段错误），
+// Signal 为导致退出的信号（仅 Linux），Stderr 为 worker stderr 的末尾
+type CrashError struct {
+	Slot   int
+	PID    int
+	State  string
+	Signal string
+	Stderr string
+	// limit 退出由 rlimit 引起时对应的限制
+	limit string
+}
+
+func (e *CrashError) Error() string {
+	return fmt.Sprintf("worker %d (pid %d) crashed: %s", e.Slot, e.PID, e.State)
+}
+
+// WorkerStats MethodWorkerStats 的返回值
+type WorkerStats = protocol.WorkerStats
+
+type Config struct {
+	// Path worker 可执行文件，Args 为启动参数，worker 在 stdin/stdout 上提供 JSON-RPC
+	Path string
+	Args []string
+	// Workers worker 进程数
+	Workers int
+	// MaxRequests 单个 worker 处理多少次调用后回收，0 表示不限
+	MaxRequests int64
+	// MaxRSS worker 常驻内存超过多少字节后回收，0 表示不限，仅 Linux 有效
+	MaxRSS int64
+	// Stderr worker 的 stderr 输出位置
+	Stderr io.Writer
+	// Limits 单次调用的资源限制
+	Limits Limits
+}
+
+// WorkerInfo worker 快照
+type WorkerInfo = protocol.WorkerInfo
+
+// Stats 进程池统计
+type Stats = protocol.PoolStats
+
+type worker struct {
+	slot      int
+	cmd       *exec.Cmd
+	stdin     io.WriteCloser
+	conn      *api_stdio.Client
+	stderr    *tailBuffer
+	exited    chan struct{}
+	startedAt time.Time
+
+	busy       bool
+	draining   bool
+	restarting bool
+	requests   int64
+	rss        int64
+	sessions   int
+	// waiters 指定了该 worker 的调用（会话调用）
+	waiters []chan *worker
+}
+
+// Pool worker 进程池：每个 worker 同一时间只处理一个调用，
+// 处理次数或内存超过阈值后在没有常驻会话时重启
+type Pool struct {
+	cfg Config
+
+	lock     sync.Mutex
+	workers  []*worker
+	waiters  []chan *worker
+	closed   bool
+	requests int64
+	recycled int64
+	crashed  int64
+	killed   int64
+}
+
+// New 启动全部 worker
+func New(cfg Config) (*Pool, error) {
+	if cfg.Workers <= 0 {
+		return nil, errors.New("workers must be positive")
+	}
+
+	p := &Pool{cfg: cfg}
+	for i := 0; i < cfg.Workers; i++ {
+		w := &worker{slot: i}
+		if err := p.start(w); err != nil {
+			p.Close()
+			return nil, err
+		}
+		p.workers = append(p.workers, w)
+	}
+	return p, nil
+}
+
+// start 启动 worker 进程，调用方须确保没有其他 goroutine 在使用 w
+func (p *Pool) start(w *worker) error {
+	cmd := exec.Command(p.cfg.Path, p.cfg.Args...)
+	tail := &tailBuffer{size: stderrTail}
+	cmd.Stderr = tail
+	if env := p.cfg.Limits.env(); env != "" {
+		cmd.Env = append(os.Environ(), EnvRlimits+"="+env)
+	}
+	if p.cfg.Stderr != nil {
+		cmd.Stderr = io.MultiWriter(p.cfg.Stderr, tail)
+	}
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err = cmd.Start(); err != nil {
+		return fmt.Errorf("start worker %d: %w", w.slot, err)
+	}
+	conn := api_stdio.NewClient(stdout, stdin)
+	conn.CancelGrace = cancelGrace
+	// 读完 stdout 后再 Wait，Wait 会关闭管道，提前调用可能丢掉最后的响应
+	exited := make(chan struct{})
+	go func() {
+		<-conn.Done()
+		_ = cmd.Wait()
+		close(exited)
+	}()
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	w.cmd = cmd
+	w.stdin = stdin
+	w.conn = conn
+	w.stderr = tail
+	w.exited = exited
+	w.startedAt = time.Now()
+	w.requests = 0
+	w.rss = 0
+	w.sessions = 0
+	w.draining = false
+	return nil
+}
+
+// stop 关闭 stdin 等待 worker 退出，返回退出状态；可重复调用
+func (w *worker) stop() string {
+	if w.cmd == nil {
+		return ""
+	}
+	_ = w.stdin.Close()
+
+	select {
+	case <-w.exited:
+	case <-time.After(stopTimeout):
+		_ = w.cmd.Process.Kill()
+		<-w.exited
+	}
+	return w.cmd.ProcessState.String()
+}
+
+func (w *worker) pid() int {
+	if w.cmd == nil || w.cmd.Process == nil {
+		return 0
+	}
+	return w.cmd.Process.Pid
+}
+
+// Call 在 worker 上执行调用，slot 为 AnyWorker 时交给任一空闲 worker，返回实际处理的 slot。
+// ctx 结束时通知 worker 取消调用，worker 在 cancelGrace 内没有结束时将其结束并重启，返回 ctx 的错误
+func (p *Pool) Call(ctx context.Context, slot int, method string, params interface{}, notify api_stdio.NotifyFunc) (json.RawMessage, int, error) {
+	w, err := p.acquire(ctx, slot)
+	if err != nil {
+		return nil, slot, err
+	}
+	// 空闲时退出的 worker 与本次调用无关，重启后重新分配
+	for w.conn.Err() != nil {
+		p.release(w, false)
+		if w, err = p.acquire(ctx, slot); err != nil {
+			return nil, slot, err
+		}
+	}
+
+	// worker 返回的二进制数据计入输出，没有超出限制时再交给调用方
+	g := p.guard(w)
+	callCtx, sink := protocol.WithBlobSink(ctx)
+	result, err := w.conn.Call(callCtx, method, params, g.notify(notify))
+	stuck := errors.Is(err, api_stdio.ErrCancelTimeout)
+	if stuck {
+		log.Printf("worker %d (pid %d): cancelled %s did not stop within %s, killing", w.slot, w.pid(), method, cancelGrace)
+		_ = w.cmd.Process.Kill()
+		// 等连接发现进程退出，否则 release 会把已被结束的 worker 当作空闲交给下一个调用
+		<-w.exited
+	}
+	size := len(result)
+	for _, data := range sink.Blobs() {
+		size += len(data)
+	}
+	breach, killed := g.finish(size)
+	crash := p.release(w, killed || stuck)
+	if stuck {
+		return nil, w.slot, ctx.Err()
+	}
+	if crash != nil && breach == "" {
+		breach = crash.limit
+	}
+	if breach != "" {
+		return nil, w.slot, &LimitError{Limit: breach, Max: p.cfg.Limits.max(breach), Crash: crash}
+	}
+	if crash != nil {
+		return nil, w.slot, crash
+	}
+	for name, data := range sink.Blobs() {
+		_ = protocol.AttachBlob(ctx, name, data)
+	}
+	return result, w.slot, err
+}
+
+func (p *Pool) acquire(ctx context.Context, slot int) (*worker, error) {
+	p.lock.Lock()
+	if p.closed {
+		p.lock.Unlock()
+		return nil, ErrPoolClosed
+	}
+	if slot >= len(p.workers) {
+		p.lock.Unlock()
+		return nil, fmt.Errorf("worker %d not found", slot)
+	}
+
+	ch := make(chan *worker, 1)
+	if slot >= 0 {
+		w := p.workers[slot]
+		if !w.busy && !w.restarting {
+			w.busy = true
+			p.lock.Unlock()
+			return w, nil
+		}
+		w.waiters = append(w.waiters, ch)
+	} else {
+		for _, w := range p.workers {
+			if !w.busy && !w.restarting && !w.draining {
+				w.busy = true
+				p.lock.Unlock()
+				return w, nil
+			}
+		}
+		p.waiters = append(p.waiters, ch)
+	}
+	p.lock.Unlock()
+
+	select {
+	case w := <-ch:
+		if w == nil {
+			return nil, ErrPoolClosed
+		}
+		return w, nil
+	case <-ctx.Done():
+		p.lock.Lock()
+		var removed bool
+		if slot >= 0 {
+			p.workers[slot].waiters, removed = removeWaiter(p.workers[slot].waiters, ch)
+		} else {
+			p.waiters, removed = removeWaiter(p.waiters, ch)
+		}
+		p.lock.Unlock()
+		// 已经分配到 worker 时需要归还
+		if !removed {
+			if w := <-ch; w != nil {
+				p.putBack(w)
+			}
+		}
+		return nil, ctx.Err()
+	}
+}
+
+func removeWaiter(waiters []chan *worker, ch chan *worker) ([]chan *worker, bool) {
+	for i, c := range waiters {
+		if c == ch {
+			return append(waiters[:i], waiters[i+1:]...), true
+		}
+	}
+	return waiters, false
+}
+
+// release 调用结束后归还 worker：进程已退出则重启并返回 CrashError，超过阈值则标记回收；
+// killed 表示 worker 是因超出资源限制被结束的
+func (p *Pool) release(w *worker, killed bool) *CrashError {
+	rss := readRSS(w.pid())
+
+	p.lock.Lock()
+	w.requests++
+	p.requests++
+	w.rss = rss
+	crashed := w.conn.Err() != nil
+	if !crashed && ((p.cfg.MaxRequests > 0 && w.requests >= p.cfg.MaxRequests) ||
+		(p.cfg.MaxRSS > 0 && w.rss >= p.cfg.MaxRSS)) {
+		w.draining = true
+	}
+	draining := w.draining
+	p.lock.Unlock()
+
+	switch {
+	case crashed:
+		crash := &CrashError{Slot: w.slot, PID: w.pid(), State: w.stop()}
+		crash.Signal = exitSignal(w.cmd.ProcessState)
+		crash.Stderr = w.stderr.String()
+		crash.limit = p.crashLimit(w.cmd.ProcessState, crash)
+		p.lock.Lock()
+		if killed {
+			p.killed++
+		} else {
+			p.crashed++
+		}
+		p.lock.Unlock()
+		if !killed {
+			log.Printf("%v", crash)
+		}
+		p.restart(w)
+		return crash
+	case draining && p.idleForRecycle(w):
+		p.lock.Lock()
+		p.recycled++
+		p.lock.Unlock()
+		p.restart(w)
+	default:
+		p.putBack(w)
+	}
+	return nil
+}
+
+// idleForRecycle 询问 worker 上的常驻会话数，没有会话时才能回收
+func (p *Pool) idleForRecycle(w *worker) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), stopTimeout)
+	defer cancel()
+
+	var stats WorkerStats
+	raw, err := w.conn.Call(ctx, MethodWorkerStats, nil, nil)
+	if err == nil {
+		err = json.Unmarshal(raw, &stats)
+	}
+	if err != nil {
+		return true
+	}
+
+	p.lock.Lock()
+	w.sessions = stats.Sessions
+	p.lock.Unlock()
+	return stats.Sessions == 0
+}
+
+// putBack 将 worker 交给等待者或标记为空闲；回收中的 worker 只接收会话调用
+func (p *Pool) putBack(w *worker) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.dispatchLocked(w)
+}
+
+func (p *Pool) dispatchLocked(w *worker) {
+	if p.closed {
+		w.busy = false
+		return
+	}
+	if len(w.waiters) > 0 {
+		ch := w.waiters[0]
+		w.waiters = w.waiters[1:]
+		w.busy = true
+		ch <- w
+		return
+	}
+	if !w.draining && len(p.waiters) > 0 {
+		ch := p.waiters[0]
+		p.waiters = p.waiters[1:]
+		w.busy = true
+		ch <- w
+		return
+	}
+	w.busy = false
+}
+
+// restart 重启 worker，启动失败时持续重试直到进程池关闭
+func (p *Pool) restart(w *worker) {
+	p.lock.Lock()
+	w.restarting = true
+	w.busy = false
+	p.lock.Unlock()
+
+	go func() {
+		w.stop()
+		for {
+			p.lock.Lock()
+			closed := p.closed
+			p.lock.Unlock()
+			if closed {
+				return
+			}
+
+			err := p.start(w)
+			if err == nil {
+				break
+			}
+			log.Printf("restart worker %d failed: %v", w.slot, err)
+			time.Sleep(restartDelay)
+		}
+
+		p.lock.Lock()
+		defer p.lock.Unlock()
+		w.restarting = false
+		if p.closed {
+			go w.stop()
+			return
+		}
+		p.dispatchLocked(w)
+	}()
+}
+
+// CheckDraining 检查等待回收的空闲 worker，会话被空闲淘汰后 worker 才能回收
+func (p *Pool) CheckDraining() {
+	p.lock.Lock()
+	var slots []int
+	for _, w := range p.workers {
+		if w.draining && !w.busy && !w.restarting {
+			slots = append(slots, w.slot)
+		}
+	}
+	p.lock.Unlock()
+
+	for _, slot := range slots {
+		w, err := p.acquire(context.Background(), slot)
+		if err != nil {
+			return
+		}
+		if p.idleForRecycle(w) {
+			p.lock.Lock()
+			p.recycled++
+			p.lock.Unlock()
+			p.restart(w)
+			continue
+		}
+		p.putBack(w)
+	}
+}
+
+// StartJanitor 后台定期执行 CheckDraining
+func (p *Pool) StartJanitor(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			p.lock.Lock()
+			closed := p.closed
+			p.lock.Unlock()
+			if closed {
+				return
+			}
+			p.CheckDraining()
+		}
+	}()
+}
+
+// Stats 进程池统计
+func (p *Pool) Stats() Stats {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	stats := Stats{
+		Workers:  make([]WorkerInfo, 0, len(p.workers)),
+		Waiting:  len(p.waiters),
+		Requests: p.requests,
+		Recycled: p.recycled,
+		Crashed:  p.crashed,
+		Killed:   p.killed,
+	}
+	for _, w := range p.workers {
+		state := "idle"
+		switch {
+		case w.restarting:
+			state = "restarting"
+		case w.busy:
+			state = "busy"
+		case w.draining:
+			state = "draining"
+		}
+		stats.Waiting += len(w.waiters)
+		stats.Workers = append(stats.Workers, WorkerInfo{
+			Slot:      w.slot,
+			PID:       w.pid(),
+			State:     state,
+			Requests:  w.requests,
+			RSS:       w.rss,
+			Sessions:  w.sessions,
+			StartedAt: w.startedAt,
+		})
+	}
+	return stats
+}
+
+// Close 关闭全部 worker，等待中的调用返回 ErrPoolClosed
+func (p *Pool) Close() {
+	p.lock.Lock()
+	if p.closed {
+		p.lock.Unlock()
+		return
+	}
+	p.closed = true
+	waiters := p.waiters
+	p.waiters = nil
+	// 重启中的 worker 由重启流程自行退出，其余 worker 关闭 stdin 后未完成的调用返回错误
+	var running []*worker
+	for _, w := range p.workers {
+		waiters = append(waiters, w.waiters...)
+		w.waiters = nil
+		if !w.restarting {
+			running = append(running, w)
+		}
+	}
+	p.lock.Unlock()
+
+	for _, ch := range waiters {
+		ch <- nil
+	}
+	var wg sync.WaitGroup
+	for _, w := range running {
+		wg.Add(1)
+		go func(w *worker) {
+			defer wg.Done()
+			w.stop()
+		}(w)
+	}
+	wg.Wait()
+}
+
+// tailBuffer 只保留最后写入的 size 字节
+type tailBuffer struct {
+	lock sync.Mutex
+	size int
+	buf  []byte
+}
+
+func (t *tailBuffer) Write(b []byte) (int, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.buf = append(t.buf, b...)
+	if over := len(t.buf) - t.size; over > 0 {
+		t.buf = append(t.buf[:0], t.buf[over:]...)
+	}
+	return len(b), nil
+}
+
+func (t *tailBuffer) String() string {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return string(t.buf)
+}
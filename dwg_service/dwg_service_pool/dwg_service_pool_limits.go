@@ -0,0 +1,202 @@
+package dwg_service_pool
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BlockLucky/dwg-go/api/api_stdio"
+)
+
+// 资源限制名称，即 LimitError.Limit 的取值
+const (
+	LimitTimeout = "timeout"
+	LimitCPU     = "cpu"
+	LimitMemory  = "memory"
+	LimitOutput  = "output"
+)
+
+// 检查 CPU 时间的间隔
+const limitPollInterval = 100 * time.Millisecond
+
+// EnvRlimits 传给 worker 的 rlimit，格式为 "<RLIMIT_DATA>:<RLIMIT_FSIZE>"，由 worker 调用 ApplyRlimits 设置给自身
+const EnvRlimits = "DWG_SERVICE_POOL_RLIMITS"
+
+// Limits 单次调用的资源限制，0 表示不限。Timeout 在所有平台生效，其余仅 Linux：
+// Memory 以 RLIMIT_DATA 作用于 worker 进程；Output 既是 RLIMIT_FSIZE（单个输出文件），
+// 也是单次调用通知与结果的总字节数；CPU 为单次调用消耗的 CPU 时间
+type Limits struct {
+	Timeout time.Duration
+	CPU     time.Duration
+	Memory  int64
+	Output  int64
+}
+
+func (l *Limits) max(limit string) string {
+	switch limit {
+	case LimitTimeout:
+		return l.Timeout.String()
+	case LimitCPU:
+		return l.CPU.String()
+	case LimitMemory:
+		return fmt.Sprintf("%d bytes", l.Memory)
+	case LimitOutput:
+		return fmt.Sprintf("%d bytes", l.Output)
+	}
+	return ""
+}
+
+// env 返回 EnvRlimits 的取值，没有需要设置的 rlimit 时返回空字符串
+func (l *Limits) env() string {
+	if l.Memory <= 0 && l.Output <= 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d:%d", max(l.Memory, 0), max(l.Output, 0))
+}
+
+// parseRlimits 解析 EnvRlimits 的取值
+func parseRlimits(v string) (data, fsize int64, err error) {
+	if _, err = fmt.Sscanf(v, "%d:%d", &data, &fsize); err != nil || data < 0 || fsize < 0 {
+		return 0, 0, fmt.Errorf("invalid %s %q", EnvRlimits, v)
+	}
+	return data, fsize, nil
+}
+
+// LimitError 调用超出资源限制；Crash 非空表示 worker 因此被结束
+type LimitError struct {
+	Limit string
+	Max   string
+	Crash *CrashError
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s limit exceeded (max %s)", e.Limit, e.Max)
+}
+
+// limitGuard 监视一次调用，超出限制时结束 worker
+type limitGuard struct {
+	limits *Limits
+	proc   *os.Process
+	pid    int
+
+	lock   sync.Mutex
+	breach string
+	output int64
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func (p *Pool) guard(w *worker) *limitGuard {
+	g := &limitGuard{
+		limits: &p.cfg.Limits,
+		proc:   w.cmd.Process,
+		pid:    w.pid(),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	if g.limits.Timeout <= 0 && g.limits.CPU <= 0 {
+		close(g.done)
+		return g
+	}
+	go g.watch()
+	return g
+}
+
+func (g *limitGuard) watch() {
+	defer close(g.done)
+
+	var timeout, poll <-chan time.Time
+	if g.limits.Timeout > 0 {
+		timer := time.NewTimer(g.limits.Timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	var cpuStart time.Duration
+	if g.limits.CPU > 0 {
+		cpuStart = readCPU(g.pid)
+		ticker := time.NewTicker(limitPollInterval)
+		defer ticker.Stop()
+		poll = ticker.C
+	}
+
+	for {
+		select {
+		case <-g.stop:
+			return
+		case <-timeout:
+			g.exceed(LimitTimeout)
+			return
+		case <-poll:
+			if readCPU(g.pid)-cpuStart > g.limits.CPU {
+				g.exceed(LimitCPU)
+				return
+			}
+		}
+	}
+}
+
+// exceed 记录第一个被突破的限制并结束 worker
+func (g *limitGuard) exceed(limit string) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if g.breach != "" {
+		return
+	}
+	g.breach = limit
+	_ = g.proc.Kill()
+}
+
+// notify 统计通知的字节数，超出 Output 后不再转发
+func (g *limitGuard) notify(notify api_stdio.NotifyFunc) api_stdio.NotifyFunc {
+	if g.limits.Output <= 0 {
+		return notify
+	}
+	return func(method string, data json.RawMessage) {
+		g.lock.Lock()
+		g.output += int64(len(data))
+		over := g.output > g.limits.Output
+		g.lock.Unlock()
+		if over {
+			g.exceed(LimitOutput)
+			return
+		}
+		if notify != nil {
+			notify(method, data)
+		}
+	}
+}
+
+// finish 结束监视，返回被突破的限制；结果本身超出 Output 时 worker 不需要结束
+func (g *limitGuard) finish(resultSize int) (breach string, killed bool) {
+	close(g.stop)
+	<-g.done
+
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if g.breach != "" {
+		return g.breach, true
+	}
+	if g.limits.Output > 0 && g.output+int64(resultSize) > g.limits.Output {
+		return LimitOutput, false
+	}
+	return "", false
+}
+
+// crashLimit 判断 worker 的退出是否由 rlimit 引起：SIGXFSZ/SIGXCPU，
+// 或设置了 RLIMIT_DATA 时 Go 运行时/LibreDWG 分配内存失败
+func (p *Pool) crashLimit(state *os.ProcessState, crash *CrashError) string {
+	if limit := signalLimit(state); limit != "" {
+		return limit
+	}
+	if p.cfg.Limits.Memory > 0 {
+		stderr := strings.ToLower(crash.Stderr)
+		if strings.Contains(stderr, "out of memory") || strings.Contains(stderr, "cannot allocate memory") {
+			return LimitMemory
+		}
+	}
+	return ""
+}
@@ -0,0 +1,114 @@
+package dwg_service_pool
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// /proc/<pid>/stat 中 CPU 时间的单位，Linux 上固定为 100Hz
+const clockTicks = 100
+
+// readRSS 从 /proc/<pid>/statm 读取进程常驻内存字节数，读取失败返回 0
+func readRSS(pid int) int64 {
+	if pid <= 0 {
+		return 0
+	}
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/statm", pid))
+	if err != nil {
+		return 0
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) < 2 {
+		return 0
+	}
+	pages, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return 0
+	}
+	return pages * int64(os.Getpagesize())
+}
+
+// exitSignal 进程被信号终止时返回信号名
+func exitSignal(state *os.ProcessState) string {
+	if state == nil {
+		return ""
+	}
+	ws, ok := state.Sys().(syscall.WaitStatus)
+	if !ok || !ws.Signaled() {
+		return ""
+	}
+	return ws.Signal().String()
+}
+
+// signalLimit 被 rlimit 触发的信号终止时返回对应的限制
+func signalLimit(state *os.ProcessState) string {
+	if state == nil {
+		return ""
+	}
+	ws, ok := state.Sys().(syscall.WaitStatus)
+	if !ok || !ws.Signaled() {
+		return ""
+	}
+	switch ws.Signal() {
+	case syscall.SIGXFSZ:
+		return LimitOutput
+	case syscall.SIGXCPU:
+		return LimitCPU
+	}
+	return ""
+}
+
+// ApplyRlimits 由 worker 在处理任何请求之前调用，按 EnvRlimits 为自身设置 RLIMIT_DATA 与 RLIMIT_FSIZE，
+// 0 表示不限。返回错误时 worker 应当退出，而不是在没有限制的情况下处理输入
+func ApplyRlimits() error {
+	v := os.Getenv(EnvRlimits)
+	if v == "" {
+		return nil
+	}
+	data, fsize, err := parseRlimits(v)
+	if err != nil {
+		return err
+	}
+	set := func(name string, resource int, value int64) error {
+		if value == 0 {
+			return nil
+		}
+		lim := syscall.Rlimit{Cur: uint64(value), Max: uint64(value)}
+		if err := syscall.Setrlimit(resource, &lim); err != nil {
+			return fmt.Errorf("setrlimit %s: %w", name, err)
+		}
+		return nil
+	}
+	if err = set("RLIMIT_DATA", syscall.RLIMIT_DATA, data); err != nil {
+		return err
+	}
+	return set("RLIMIT_FSIZE", syscall.RLIMIT_FSIZE, fsize)
+}
+
+// readCPU 从 /proc/<pid>/stat 读取进程累计的用户态与内核态 CPU 时间
+func readCPU(pid int) time.Duration {
+	if pid <= 0 {
+		return 0
+	}
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return 0
+	}
+	// comm 字段可能包含空格，从最后一个 ')' 之后开始数：state 为第 3 个字段，utime/stime 为第 14、15 个
+	s := string(data)
+	i := strings.LastIndexByte(s, ')')
+	if i < 0 {
+		return 0
+	}
+	fields := strings.Fields(s[i+1:])
+	if len(fields) < 13 {
+		return 0
+	}
+	utime, _ := strconv.ParseInt(fields[11], 10, 64)
+	stime, _ := strconv.ParseInt(fields[12], 10, 64)
+	return time.Duration(utime+stime) * time.Second / clockTicks
+}
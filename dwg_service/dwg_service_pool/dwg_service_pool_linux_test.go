@@ -0,0 +1,35 @@
+package dwg_service_pool
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+// procLimit 从 /proc/<pid>/limits 读取 name 一行的软限制
+func procLimit(t *testing.T, pid int, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/limits", pid))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.HasPrefix(line, name) {
+			return strings.Fields(line[len(name):])[0]
+		}
+	}
+	t.Fatalf("%s not found in /proc/%d/limits", name, pid)
+	return ""
+}
+
+func TestPoolRlimits(t *testing.T) {
+	p := newTestPool(t, Config{Workers: 1, Limits: Limits{Memory: 512 << 20, Output: 1 << 20}})
+	pid, _ := callPID(t, p, 0, "test.pid")
+	if got := procLimit(t, pid, "Max data size"); got != "536870912" {
+		t.Errorf("RLIMIT_DATA = %s", got)
+	}
+	if got := procLimit(t, pid, "Max file size"); got != "1048576" {
+		t.Errorf("RLIMIT_FSIZE = %s", got)
+	}
+}
@@ -0,0 +1,33 @@
+//go:build !linux
+
+package dwg_service_pool
+
+import (
+	"os"
+	"time"
+)
+
+// readRSS 非 Linux 平台不按内存回收
+func readRSS(pid int) int64 {
+	return 0
+}
+
+// exitSignal 非 Linux 平台不区分信号
+func exitSignal(state *os.ProcessState) string {
+	return ""
+}
+
+// signalLimit 非 Linux 平台没有 rlimit 信号
+func signalLimit(state *os.ProcessState) string {
+	return ""
+}
+
+// ApplyRlimits 非 Linux 平台不设置 rlimit
+func ApplyRlimits() error {
+	return nil
+}
+
+// readCPU 非 Linux 平台不统计 CPU 时间
+func readCPU(pid int) time.Duration {
+	return 0
+}
@@ -0,0 +1,418 @@
+package dwg_service_pool
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/BlockLucky/dwg-go/api/api_method"
+	"github.com/BlockLucky/dwg-go/api/api_rpc"
+	"github.com/BlockLucky/dwg-go/api/api_stdio"
+)
+
+// 设置该环境变量时测试程序作为 worker 运行
+const envTestWorker = "DWG_POOL_TEST_WORKER"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(envTestWorker) == "1" {
+		if err := ApplyRlimits(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		runTestWorker()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+type testParams struct {
+	Size int `json:"size"`
+}
+
+// runTestWorker 提供测试用的方法：
+// test.pid 返回进程号，test.crash 写 stderr 后退出，test.wait 等到调用被取消，
+// test.hang 忽略取消，test.big 返回 size 字节的结果，test.open/test.close 增减常驻会话
+func runTestWorker() {
+	var sessions int
+	var lock sync.Mutex
+	method := func(name string, fn func(ctx context.Context, p testParams) (interface{}, error)) {
+		api_method.RegisterMethod(name, func(ctx context.Context, reqModel *api_rpc.RPCRequest, notify api_method.Notifier) (interface{}, error) {
+			var p testParams
+			if len(reqModel.Params) > 0 {
+				if err := api_method.DecodeParams(reqModel, &p); err != nil {
+					return nil, err
+				}
+			}
+			return fn(ctx, p)
+		})
+	}
+	method("test.pid", func(ctx context.Context, p testParams) (interface{}, error) {
+		return os.Getpid(), nil
+	})
+	method("test.crash", func(ctx context.Context, p testParams) (interface{}, error) {
+		fmt.Fprintln(os.Stderr, "segfault in test worker")
+		os.Exit(3)
+		return nil, nil
+	})
+	method("test.wait", func(ctx context.Context, p testParams) (interface{}, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	method("test.hang", func(ctx context.Context, p testParams) (interface{}, error) {
+		time.Sleep(time.Hour)
+		return nil, nil
+	})
+	method("test.big", func(ctx context.Context, p testParams) (interface{}, error) {
+		return strings.Repeat("x", p.Size), nil
+	})
+	method("test.open", func(ctx context.Context, p testParams) (interface{}, error) {
+		lock.Lock()
+		defer lock.Unlock()
+		sessions++
+		return os.Getpid(), nil
+	})
+	method("test.close", func(ctx context.Context, p testParams) (interface{}, error) {
+		lock.Lock()
+		defer lock.Unlock()
+		sessions--
+		return os.Getpid(), nil
+	})
+	method(MethodWorkerStats, func(ctx context.Context, p testParams) (interface{}, error) {
+		lock.Lock()
+		defer lock.Unlock()
+		return &WorkerStats{Sessions: sessions}, nil
+	})
+	_ = api_stdio.Serve(os.Stdin, os.Stdout)
+}
+
+func newTestPool(t *testing.T, cfg Config) *Pool {
+	t.Helper()
+	t.Setenv(envTestWorker, "1")
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Path = exe
+	p, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(p.Close)
+	return p
+}
+
+func callPID(t *testing.T, p *Pool, slot int, method string) (int, int) {
+	t.Helper()
+	raw, got, err := p.Call(context.Background(), slot, method, nil, nil)
+	if err != nil {
+		t.Fatalf("%s on worker %d: %v", method, slot, err)
+	}
+	var pid int
+	if err = json.Unmarshal(raw, &pid); err != nil {
+		t.Fatal(err)
+	}
+	return pid, got
+}
+
+// waitIdle 等待全部 worker 重启完成
+func waitIdle(t *testing.T, p *Pool) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		idle := true
+		for _, w := range p.Stats().Workers {
+			idle = idle && w.State != "restarting" && w.State != "busy"
+		}
+		if idle {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("workers did not become idle")
+}
+
+func TestPoolCalls(t *testing.T) {
+	p := newTestPool(t, Config{Workers: 2})
+
+	pid0, slot := callPID(t, p, 0, "test.pid")
+	if slot != 0 {
+		t.Fatalf("pinned call ran on worker %d", slot)
+	}
+	pid1, _ := callPID(t, p, 1, "test.pid")
+	if pid0 == pid1 {
+		t.Fatal("workers share a process")
+	}
+
+	// 两个 worker 同时处理调用，第三个调用等到其中一个空闲
+	var wg sync.WaitGroup
+	slots := make(chan int, 4)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, slot, err := p.Call(context.Background(), AnyWorker, "test.pid", nil, nil)
+			if err != nil {
+				t.Error(err)
+			}
+			slots <- slot
+		}()
+	}
+	wg.Wait()
+	close(slots)
+	for slot := range slots {
+		if slot != 0 && slot != 1 {
+			t.Errorf("call ran on worker %d", slot)
+		}
+	}
+
+	st := p.Stats()
+	if st.Requests != 6 || st.Crashed != 0 || st.Waiting != 0 {
+		t.Errorf("stats = %+v", st)
+	}
+	if _, _, err := p.Call(context.Background(), 5, "test.pid", nil, nil); err == nil {
+		t.Error("call on a missing worker succeeded")
+	}
+}
+
+func TestPoolCrashRestartsWorker(t *testing.T) {
+	p := newTestPool(t, Config{Workers: 1})
+	before, _ := callPID(t, p, AnyWorker, "test.pid")
+
+	_, _, err := p.Call(context.Background(), AnyWorker, "test.crash", nil, nil)
+	var crash *CrashError
+	if !errors.As(err, &crash) {
+		t.Fatalf("error = %v, want *CrashError", err)
+	}
+	if crash.PID != before || !strings.Contains(crash.Stderr, "segfault in test worker") {
+		t.Errorf("crash = %+v", crash)
+	}
+
+	after, _ := callPID(t, p, AnyWorker, "test.pid")
+	if after == before {
+		t.Error("crashed worker was not replaced")
+	}
+	if st := p.Stats(); st.Crashed != 1 {
+		t.Errorf("crashed = %d, want 1", st.Crashed)
+	}
+}
+
+func TestPoolRecycle(t *testing.T) {
+	p := newTestPool(t, Config{Workers: 1, MaxRequests: 2})
+
+	first, _ := callPID(t, p, AnyWorker, "test.pid")
+	if again, _ := callPID(t, p, AnyWorker, "test.pid"); again != first {
+		t.Fatal("worker recycled before MaxRequests")
+	}
+	waitIdle(t, p)
+	if next, _ := callPID(t, p, AnyWorker, "test.pid"); next == first {
+		t.Fatal("worker was not recycled after MaxRequests")
+	}
+	if st := p.Stats(); st.Recycled != 1 {
+		t.Errorf("recycled = %d, want 1", st.Recycled)
+	}
+}
+
+func TestPoolRecycleWaitsForSessions(t *testing.T) {
+	p := newTestPool(t, Config{Workers: 1, MaxRequests: 1})
+
+	pid, _ := callPID(t, p, 0, "test.open")
+	st := p.Stats()
+	if st.Recycled != 0 || st.Workers[0].State != "draining" || st.Workers[0].Sessions != 1 {
+		t.Fatalf("worker with a session: %+v", st.Workers[0])
+	}
+
+	// 回收中的 worker 不接收新调用，会话调用仍然交给它
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, _, err := p.Call(ctx, AnyWorker, "test.pid", nil, nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("call on a draining pool: %v", err)
+	}
+	if same, _ := callPID(t, p, 0, "test.close"); same != pid {
+		t.Fatal("session call did not reach the draining worker")
+	}
+
+	waitIdle(t, p)
+	if next, _ := callPID(t, p, AnyWorker, "test.pid"); next == pid {
+		t.Fatal("worker was not recycled after its sessions closed")
+	}
+}
+
+func TestPoolLimits(t *testing.T) {
+	tests := []struct {
+		name       string
+		limits     Limits
+		method     string
+		params     interface{}
+		wantLimit  string
+		wantKilled bool
+	}{
+		{"timeout", Limits{Timeout: 100 * time.Millisecond}, "test.hang", nil, LimitTimeout, true},
+		{"result over output limit", Limits{Output: 1000}, "test.big", &testParams{Size: 2000}, LimitOutput, false},
+		{"within limits", Limits{Timeout: time.Minute, Output: 1000}, "test.big", &testParams{Size: 10}, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestPool(t, Config{Workers: 1, Limits: tt.limits})
+			before, _ := callPID(t, p, 0, "test.pid")
+
+			_, _, err := p.Call(context.Background(), 0, tt.method, tt.params, nil)
+			var limitErr *LimitError
+			if tt.wantLimit == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			} else if !errors.As(err, &limitErr) || limitErr.Limit != tt.wantLimit {
+				t.Fatalf("error = %v, want %s limit", err, tt.wantLimit)
+			}
+
+			waitIdle(t, p)
+			after, _ := callPID(t, p, 0, "test.pid")
+			if killed := after != before; killed != tt.wantKilled {
+				t.Errorf("worker replaced = %v, want %v", killed, tt.wantKilled)
+			}
+			if st := p.Stats(); st.Crashed != 0 || (st.Killed == 1) != tt.wantKilled {
+				t.Errorf("stats = %+v", st)
+			}
+		})
+	}
+}
+
+func TestPoolCancel(t *testing.T) {
+	if testing.Short() {
+		t.Skip("waits for cancelGrace")
+	}
+	tests := []struct {
+		method      string
+		wantReplace bool
+	}{
+		{"test.wait", false},
+		{"test.hang", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			p := newTestPool(t, Config{Workers: 1})
+			before, _ := callPID(t, p, 0, "test.pid")
+
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			if _, _, err := p.Call(ctx, 0, tt.method, nil, nil); !errors.Is(err, context.DeadlineExceeded) {
+				t.Fatalf("error = %v, want %v", err, context.DeadlineExceeded)
+			}
+
+			waitIdle(t, p)
+			after, _ := callPID(t, p, 0, "test.pid")
+			if replaced := after != before; replaced != tt.wantReplace {
+				t.Errorf("worker replaced = %v, want %v", replaced, tt.wantReplace)
+			}
+		})
+	}
+}
+
+func TestPoolClose(t *testing.T) {
+	if testing.Short() {
+		t.Skip("waits for stopTimeout")
+	}
+	p := newTestPool(t, Config{Workers: 1})
+
+	started := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		close(started)
+		_, _, err := p.Call(context.Background(), 0, "test.wait", nil, nil)
+		done <- err
+	}()
+	<-started
+	waiter := make(chan error, 1)
+	go func() {
+		// 等 test.wait 占用 worker 后再排队
+		for p.Stats().Workers[0].State != "busy" {
+			time.Sleep(time.Millisecond)
+		}
+		_, _, err := p.Call(context.Background(), AnyWorker, "test.pid", nil, nil)
+		waiter <- err
+	}()
+	for p.Stats().Waiting == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	p.Close()
+	if err := <-waiter; !errors.Is(err, ErrPoolClosed) {
+		t.Errorf("queued call: %v, want %v", err, ErrPoolClosed)
+	}
+	if err := <-done; err == nil {
+		t.Error("in-flight call succeeded after Close")
+	}
+	if _, _, err := p.Call(context.Background(), AnyWorker, "test.pid", nil, nil); !errors.Is(err, ErrPoolClosed) {
+		t.Errorf("call after Close: %v, want %v", err, ErrPoolClosed)
+	}
+}
+
+func TestRlimitsEnv(t *testing.T) {
+	tests := []struct {
+		limits    Limits
+		env       string
+		data, out int64
+	}{
+		{Limits{}, "", 0, 0},
+		{Limits{Timeout: time.Second, CPU: time.Second}, "", 0, 0},
+		{Limits{Memory: 256 << 20}, "268435456:0", 256 << 20, 0},
+		{Limits{Memory: 256 << 20, Output: 1 << 20}, "268435456:1048576", 256 << 20, 1 << 20},
+	}
+	for _, tt := range tests {
+		env := tt.limits.env()
+		if env != tt.env {
+			t.Errorf("env(%+v) = %q, want %q", tt.limits, env, tt.env)
+			continue
+		}
+		if env == "" {
+			continue
+		}
+		data, out, err := parseRlimits(env)
+		if err != nil || data != tt.data || out != tt.out {
+			t.Errorf("parseRlimits(%q) = %d, %d, %v", env, data, out, err)
+		}
+	}
+	for _, v := range []string{"", "x", "1", "-1:0", "1:-1"} {
+		if _, _, err := parseRlimits(v); err == nil {
+			t.Errorf("parseRlimits(%q) succeeded", v)
+		}
+	}
+}
+
+func TestNewRejectsEmptyPool(t *testing.T) {
+	if _, err := New(Config{}); err == nil {
+		t.Fatal("New without workers succeeded")
+	}
+}
+
+func TestTailBuffer(t *testing.T) {
+	tests := []struct {
+		size   int
+		writes []string
+		want   string
+	}{
+		{8, nil, ""},
+		{8, []string{"abc"}, "abc"},
+		{8, []string{"abcd", "efgh"}, "abcdefgh"},
+		{8, []string{"abcd", "efgh", "ij"}, "cdefghij"},
+		{4, []string{"abcdefghij"}, "ghij"},
+		{4, []string{"ab", "", "cdef"}, "cdef"},
+	}
+	for _, tt := range tests {
+		tb := &tailBuffer{size: tt.size}
+		for _, w := range tt.writes {
+			if n, err := tb.Write([]byte(w)); n != len(w) || err != nil {
+				t.Fatalf("Write(%q) = %d, %v", w, n, err)
+			}
+		}
+		if got := tb.String(); got != tt.want {
+			t.Errorf("size %d writes %q: got %q, want %q", tt.size, tt.writes, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package dwg_service_quarantine
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BlockLucky/dwg-go/protocol"
+)
+
+const manifestName = "manifest.json"
+
+// 隔离原因
+const (
+	ReasonCrash   = protocol.QuarantineCrash
+	ReasonTimeout = protocol.QuarantineTimeout
+	ReasonLimit   = protocol.QuarantineLimit
+)
+
+var ErrNotFound = errors.New("quarantine entry not found")
+
+// Manifest 复现包清单，ID 为输入文件的 sha256，同一文件再次出问题时累加 Count
+type Manifest = protocol.QuarantineEntry
+
+// Store 隔离区：每个输入一个目录，包含输入文件副本与 manifest.json；
+// 超过 MaxEntries 时删除最久未出问题的条目
+type Store struct {
+	dir        string
+	maxEntries int
+
+	lock sync.Mutex
+}
+
+func NewStore(dir string, maxEntries int) (*Store, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	if err = os.MkdirAll(dir, 0750); err != nil {
+		return nil, err
+	}
+	return &Store{dir: dir, maxEntries: maxEntries}, nil
+}
+
+// validID ID 只能是 sha256 十六进制串，防止拼出隔离区以外的路径
+func validID(id string) bool {
+	if len(id) != 64 {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil
+}
+
+// Add 记录一次出问题的调用；条目不存在时复制 path 指向的输入文件
+func (s *Store) Add(path string, m *Manifest) (*Manifest, error) {
+	if !validID(m.ID) {
+		return nil, errors.New("invalid quarantine id")
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	bundle := filepath.Join(s.dir, m.ID)
+	now := time.Now()
+	prev, err := s.readLocked(m.ID)
+	switch {
+	case err == nil:
+		m.File = prev.File
+		m.Size = prev.Size
+		m.Count = prev.Count + 1
+		m.FirstAt = prev.FirstAt
+	case errors.Is(err, ErrNotFound):
+		if err = os.MkdirAll(bundle, 0750); err != nil {
+			return nil, err
+		}
+		m.File = "input" + strings.ToLower(filepath.Ext(path))
+		if m.Size, err = copyFile(path, filepath.Join(bundle, m.File)); err != nil {
+			_ = os.RemoveAll(bundle)
+			return nil, err
+		}
+		m.Count = 1
+		m.FirstAt = now
+	default:
+		return nil, err
+	}
+	m.Path = path
+	m.LastAt = now
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err = os.WriteFile(filepath.Join(bundle, manifestName), data, 0640); err != nil {
+		return nil, err
+	}
+	m.Bundle = bundle
+
+	s.pruneLocked()
+	return m, nil
+}
+
+func copyFile(src, dst string) (int64, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return 0, err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0640)
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(out, in)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	return n, err
+}
+
+func (s *Store) readLocked(id string) (*Manifest, error) {
+	bundle := filepath.Join(s.dir, id)
+	data, err := os.ReadFile(filepath.Join(bundle, manifestName))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	m := &Manifest{}
+	if err = json.Unmarshal(data, m); err != nil {
+		return nil, err
+	}
+	m.Bundle = bundle
+	return m, nil
+}
+
+func (s *Store) listLocked() []*Manifest {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil
+	}
+	out := make([]*Manifest, 0, len(entries))
+	for _, e := range entries {
+		if !e.IsDir() || !validID(e.Name()) {
+			continue
+		}
+		if m, err := s.readLocked(e.Name()); err == nil {
+			out = append(out, m)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].LastAt.After(out[j].LastAt) })
+	return out
+}
+
+func (s *Store) pruneLocked() {
+	if s.maxEntries <= 0 {
+		return
+	}
+	list := s.listLocked()
+	for _, m := range list[min(len(list), s.maxEntries):] {
+		_ = os.RemoveAll(m.Bundle)
+	}
+}
+
+// List 全部条目，最近出问题的在前
+func (s *Store) List() []*Manifest {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.listLocked()
+}
+
+// Get 读取单个条目
+func (s *Store) Get(id string) (*Manifest, error) {
+	if !validID(id) {
+		return nil, ErrNotFound
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.readLocked(id)
+}
+
+// Purge 删除条目，id 为空时清空隔离区，返回删除的 ID
+func (s *Store) Purge(id string) ([]string, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	ids := []string{}
+	if id == "" {
+		for _, m := range s.listLocked() {
+			ids = append(ids, m.ID)
+		}
+	} else {
+		if !validID(id) {
+			return nil, ErrNotFound
+		}
+		if _, err := s.readLocked(id); err != nil {
+			return nil, err
+		}
+		ids = []string{id}
+	}
+
+	for _, id := range ids {
+		if err := os.RemoveAll(filepath.Join(s.dir, id)); err != nil {
+			return nil, err
+		}
+	}
+	return ids, nil
+}
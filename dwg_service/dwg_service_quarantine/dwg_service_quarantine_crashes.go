@@ -0,0 +1,165 @@
+package dwg_service_quarantine
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/BlockLucky/dwg-go/protocol"
+)
+
+// CrashRecord 导致 worker 崩溃或因超出资源限制被结束的输入文件，按内容哈希记录
+type CrashRecord struct {
+	Hash      string    `json:"hash"`
+	Path      string    `json:"path"`
+	Method    string    `json:"method"`
+	Count     int       `json:"count"`
+	LastError string    `json:"last_error"`
+	FirstAt   time.Time `json:"first_at"`
+	LastAt    time.Time `json:"last_at"`
+}
+
+// fileKey 路径、大小、修改时间都没变时复用已计算的哈希
+type fileKey struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// CrashTracker 记录崩溃过的输入；同一内容崩溃或超限 maxCrashes 次后直接拒绝，不再交给 worker
+type CrashTracker struct {
+	maxCrashes int
+	ttl        time.Duration
+
+	lock    sync.Mutex
+	records map[string]*CrashRecord
+	hashes  map[fileKey]string
+}
+
+func NewCrashTracker(maxCrashes int, ttl time.Duration) *CrashTracker {
+	return &CrashTracker{
+		maxCrashes: maxCrashes,
+		ttl:        ttl,
+		records:    make(map[string]*CrashRecord),
+		hashes:     make(map[fileKey]string),
+	}
+}
+
+// hashFile 计算文件内容的 sha256
+func (r *CrashTracker) hashFile(path string) (string, error) {
+	st, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	key := fileKey{path: path, size: st.Size(), modTime: st.ModTime()}
+
+	r.lock.Lock()
+	hash, ok := r.hashes[key]
+	r.lock.Unlock()
+	if ok {
+		return hash, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return "", err
+	}
+	hash = hex.EncodeToString(h.Sum(nil))
+
+	r.lock.Lock()
+	r.hashes[key] = hash
+	r.lock.Unlock()
+	return hash, nil
+}
+
+// Check 输入已多次导致崩溃时返回 service_crashed 错误；没有崩溃记录时不计算哈希
+func (r *CrashTracker) Check(path string) error {
+	if path == "" || r.maxCrashes <= 0 {
+		return nil
+	}
+	r.lock.Lock()
+	r.expireLocked()
+	empty := len(r.records) == 0
+	r.lock.Unlock()
+	if empty {
+		return nil
+	}
+
+	hash, err := r.hashFile(path)
+	if err != nil {
+		return nil
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	rec := r.records[hash]
+	if rec == nil || rec.Count < r.maxCrashes {
+		return nil
+	}
+	return fmt.Errorf("%w: input sha256:%s brought down a dwg_service worker %d times, last: %s", protocol.ErrServiceCrashed, hash, rec.Count, rec.LastError)
+}
+
+// Record 记录一次崩溃或超限，返回输入的哈希
+func (r *CrashTracker) Record(path, method string, crash error) string {
+	if path == "" {
+		return ""
+	}
+	hash, err := r.hashFile(path)
+	if err != nil {
+		return ""
+	}
+
+	now := time.Now()
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	rec := r.records[hash]
+	if rec == nil {
+		rec = &CrashRecord{Hash: hash, FirstAt: now}
+		r.records[hash] = rec
+	}
+	rec.Path = path
+	rec.Method = method
+	rec.Count++
+	rec.LastError = crash.Error()
+	rec.LastAt = now
+	return hash
+}
+
+// Restore 恢复持久化的崩溃记录（来自隔离区）
+func (r *CrashTracker) Restore(rec *CrashRecord) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.records[rec.Hash] = rec
+}
+
+// Forget 删除崩溃记录，之后该输入可以重新交给 worker 处理
+func (r *CrashTracker) Forget(hash string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	delete(r.records, hash)
+}
+
+func (r *CrashTracker) expireLocked() {
+	if r.ttl <= 0 {
+		return
+	}
+	deadline := time.Now().Add(-r.ttl)
+	for hash, rec := range r.records {
+		if rec.LastAt.Before(deadline) {
+			delete(r.records, hash)
+		}
+	}
+	// 哈希缓存只为有崩溃记录时服务，没有记录时一并清空
+	if len(r.records) == 0 {
+		clear(r.hashes)
+	}
+}
@@ -0,0 +1,206 @@
+package dwg_service_quarantine
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/BlockLucky/dwg-go/protocol"
+)
+
+// writeInput 写入测试用的输入文件，返回路径与内容的 sha256
+func writeInput(t *testing.T, name, content string) (string, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256([]byte(content))
+	return path, hex.EncodeToString(sum[:])
+}
+
+func TestStoreAdd(t *testing.T) {
+	s, err := NewStore(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path, id := writeInput(t, "Site.DWG", "AC1015 crash")
+
+	first, err := s.Add(path, &Manifest{ID: id, Reason: ReasonCrash, Method: "dwg.read", Signal: "segmentation fault"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Count != 1 || first.File != "input.dwg" || first.Size != int64(len("AC1015 crash")) {
+		t.Fatalf("first add = %+v", first)
+	}
+	copied, err := os.ReadFile(filepath.Join(first.Bundle, first.File))
+	if err != nil || string(copied) != "AC1015 crash" {
+		t.Fatalf("bundle copy = %q, %v", copied, err)
+	}
+
+	// 原文件已被删除时仍然累加计数，保留第一次的副本
+	if err = os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	second, err := s.Add(path, &Manifest{ID: id, Reason: ReasonTimeout, Limit: "timeout", Method: "dwg.read"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.Count != 2 || !second.FirstAt.Equal(first.FirstAt) || second.File != first.File {
+		t.Fatalf("second add = %+v", second)
+	}
+
+	got, err := s.Get(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Count != 2 || got.Reason != ReasonTimeout || got.Limit != "timeout" {
+		t.Errorf("Get = %+v", got)
+	}
+}
+
+func TestStoreInvalidID(t *testing.T) {
+	s, err := NewStore(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path, _ := writeInput(t, "a.dwg", "x")
+	tests := []string{"", "abc", "../../etc/passwd", "zz" + string(make([]byte, 62))}
+	for _, id := range tests {
+		if _, err := s.Add(path, &Manifest{ID: id}); err == nil {
+			t.Errorf("Add(%q) succeeded", id)
+		}
+		if _, err := s.Get(id); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Get(%q) = %v, want %v", id, err, ErrNotFound)
+		}
+		if _, err := s.Purge(id); id != "" && !errors.Is(err, ErrNotFound) {
+			t.Errorf("Purge(%q) = %v, want %v", id, err, ErrNotFound)
+		}
+	}
+}
+
+func TestStorePruneAndPurge(t *testing.T) {
+	s, err := NewStore(t.TempDir(), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, content := range []string{"one", "two", "three"} {
+		path, id := writeInput(t, content+".dwg", content)
+		if _, err = s.Add(path, &Manifest{ID: id, Reason: ReasonCrash}); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	list := s.List()
+	if len(list) != 2 || list[0].ID != ids[2] || list[1].ID != ids[1] {
+		t.Fatalf("List after prune = %v", list)
+	}
+	if _, err = s.Get(ids[0]); !errors.Is(err, ErrNotFound) {
+		t.Errorf("oldest entry was not pruned: %v", err)
+	}
+
+	tests := []struct {
+		id   string
+		want int
+		err  error
+	}{
+		{ids[0], 0, ErrNotFound},
+		{ids[1], 1, nil},
+		{"", 1, nil},
+		{"", 0, nil},
+	}
+	for _, tt := range tests {
+		purged, err := s.Purge(tt.id)
+		if !errors.Is(err, tt.err) || len(purged) != tt.want {
+			t.Errorf("Purge(%q) = %v, %v; want %d ids, error %v", tt.id, purged, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestCrashTrackerCheck(t *testing.T) {
+	path, id := writeInput(t, "bad.dwg", "crashes libredwg")
+	other, _ := writeInput(t, "good.dwg", "fine")
+	crash := errors.New("signal: segmentation fault")
+
+	tests := []struct {
+		name    string
+		max     int
+		records int
+		path    string
+		wantErr bool
+	}{
+		{"no records", 2, 0, path, false},
+		{"below threshold", 2, 1, path, false},
+		{"threshold reached", 2, 2, path, true},
+		{"other file", 2, 2, other, false},
+		{"no path", 2, 2, "", false},
+		{"tracking disabled", 0, 5, path, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewCrashTracker(tt.max, time.Hour)
+			for i := 0; i < tt.records; i++ {
+				if got := r.Record(path, "dwg.read", crash); got != id {
+					t.Fatalf("Record() = %q, want %q", got, id)
+				}
+			}
+			err := r.Check(tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Check() = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, protocol.ErrServiceCrashed) {
+				t.Errorf("error %v does not match ErrServiceCrashed", err)
+			}
+		})
+	}
+}
+
+func TestCrashTrackerContentHash(t *testing.T) {
+	path, _ := writeInput(t, "a.dwg", "same content")
+	copyPath, _ := writeInput(t, "b.dwg", "same content")
+	r := NewCrashTracker(1, time.Hour)
+	r.Record(path, "dwg.read", errors.New("crash"))
+
+	if err := r.Check(copyPath); err == nil {
+		t.Error("a copy of a crashing file was accepted")
+	}
+	// 文件内容变化后按新内容判断
+	if err := os.WriteFile(path, []byte("fixed content"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, time.Now().Add(time.Minute), time.Now().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Check(path); err != nil {
+		t.Errorf("changed file rejected: %v", err)
+	}
+	if got := r.Record(filepath.Join(t.TempDir(), "missing.dwg"), "dwg.read", errors.New("crash")); got != "" {
+		t.Errorf("Record of a missing file = %q", got)
+	}
+}
+
+func TestCrashTrackerRestoreForgetExpire(t *testing.T) {
+	path, id := writeInput(t, "bad.dwg", "bad")
+	r := NewCrashTracker(2, time.Hour)
+
+	r.Restore(&CrashRecord{Hash: id, Count: 2, LastError: "timeout limit exceeded", LastAt: time.Now()})
+	if err := r.Check(path); err == nil {
+		t.Fatal("restored record was ignored")
+	}
+	r.Forget(id)
+	if err := r.Check(path); err != nil {
+		t.Fatalf("forgotten record still rejects: %v", err)
+	}
+
+	r.Restore(&CrashRecord{Hash: id, Count: 5, LastAt: time.Now().Add(-2 * time.Hour)})
+	if err := r.Check(path); err != nil {
+		t.Errorf("expired record still rejects: %v", err)
+	}
+}
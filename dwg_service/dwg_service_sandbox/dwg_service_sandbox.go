@@ -0,0 +1,13 @@
+package dwg_service_sandbox
+
+// EnvStage exec 后的 worker 通过该环境变量得知 Landlock 已经生效
+const EnvStage = "DWG_SERVICE_SANDBOX_STAGE"
+
+// Config 沙箱配置：worker 只能读取 ReadPaths、读写 WritePaths 下的文件，
+// 不能创建网络 socket、不能 exec；以 root 启动时切换到 UID/GID
+type Config struct {
+	ReadPaths  []string
+	WritePaths []string
+	UID        int
+	GID        int
+}
@@ -0,0 +1,261 @@
+package dwg_service_sandbox
+
+import (
+	"encoding/binary"
+	"fmt"
+	"log"
+	"os"
+	"runtime"
+	"syscall"
+	"unsafe"
+)
+
+// Landlock 的调用号在所有架构上相同
+const (
+	sysLandlockCreateRuleset = 444
+	sysLandlockAddRule       = 445
+	sysLandlockRestrictSelf  = 446
+
+	landlockCreateRulesetVersion = 1 << 0
+	landlockRulePathBeneath      = 1
+)
+
+// Landlock 文件系统权限，REFER 需要 ABI 2，TRUNCATE 需要 ABI 3
+const (
+	accessExecute    = 1 << 0
+	accessWriteFile  = 1 << 1
+	accessReadFile   = 1 << 2
+	accessReadDir    = 1 << 3
+	accessRemoveDir  = 1 << 4
+	accessRemoveFile = 1 << 5
+	accessMakeChar   = 1 << 6
+	accessMakeDir    = 1 << 7
+	accessMakeReg    = 1 << 8
+	accessMakeSock   = 1 << 9
+	accessMakeFifo   = 1 << 10
+	accessMakeBlock  = 1 << 11
+	accessMakeSym    = 1 << 12
+	accessRefer      = 1 << 13
+	accessTruncate   = 1 << 14
+
+	// 只对普通文件有意义的权限，给文件（而不是目录）添加规则时只能使用这些
+	accessFileOnly = accessExecute | accessWriteFile | accessReadFile | accessTruncate
+)
+
+const (
+	prSetNoNewPrivs = 38
+	oPath           = 0x200000 // O_PATH，syscall 包中没有定义
+
+	seccompSetModeFilter   = 1
+	seccompFilterFlagTsync = 1
+	seccompRetAllow        = 0x7fff0000
+	seccompRetErrno        = 0x00050000
+
+	bpfLdAbsW = 0x20 // BPF_LD | BPF_W | BPF_ABS
+	bpfJeqK   = 0x15 // BPF_JMP | BPF_JEQ | BPF_K
+	bpfJgeK   = 0x35 // BPF_JMP | BPF_JGE | BPF_K
+	bpfRetK   = 0x06 // BPF_RET | BPF_K
+
+	// x32 ABI 的调用号带有该标志位，统一拒绝
+	x32SyscallBit = 0x40000000
+
+	// 以 root 启动且未配置 UID/GID 时切换到 nobody
+	nobody = 65534
+)
+
+// systemPaths 动态链接的可执行文件 exec 时需要读取的系统目录
+var systemPaths = []string{"/lib", "/lib64", "/usr/lib", "/usr/lib64", "/etc/ld.so.cache"}
+
+// Enter 在 worker 开始处理请求前调用。Landlock 只作用于调用线程，而 Go 进程启动时已经有多个线程，
+// 所以第一次调用时在锁定的线程上降权并应用 Landlock 后重新 exec 自身，exec 后的所有线程都继承限制；
+// 第二次调用（exec 之后）安装 seccomp 过滤器。内核不支持时输出警告并继续运行
+func Enter(cfg *Config) error {
+	if os.Getenv(EnvStage) == "" {
+		return restrictAndExec(cfg)
+	}
+	installSeccomp()
+	return nil
+}
+
+func restrictAndExec(cfg *Config) error {
+	runtime.LockOSThread()
+
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if err = dropPrivileges(cfg); err != nil {
+		return err
+	}
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prSetNoNewPrivs, 1, 0); errno != 0 {
+		log.Printf("sandbox: prctl(PR_SET_NO_NEW_PRIVS) failed: %v", errno)
+	}
+	if err = landlock(cfg, exe); err != nil {
+		log.Printf("sandbox: landlock unavailable (%v), filesystem access is not restricted", err)
+	}
+
+	env := append(os.Environ(), EnvStage+"=1")
+	if err = syscall.Exec(exe, os.Args, env); err != nil {
+		return fmt.Errorf("sandbox: re-exec %s: %w", exe, err)
+	}
+	return nil
+}
+
+// dropPrivileges 以 root 启动时切换到配置的 UID/GID
+func dropPrivileges(cfg *Config) error {
+	if os.Getuid() != 0 {
+		return nil
+	}
+	uid, gid := cfg.UID, cfg.GID
+	if uid == 0 {
+		uid = nobody
+	}
+	if gid == 0 {
+		gid = nobody
+	}
+	if err := syscall.Setgroups(nil); err != nil {
+		return fmt.Errorf("sandbox: setgroups: %w", err)
+	}
+	if err := syscall.Setgid(gid); err != nil {
+		return fmt.Errorf("sandbox: setgid %d: %w", gid, err)
+	}
+	if err := syscall.Setuid(uid); err != nil {
+		return fmt.Errorf("sandbox: setuid %d: %w", uid, err)
+	}
+	return nil
+}
+
+func landlock(cfg *Config, exe string) error {
+	abi, _, errno := syscall.Syscall(sysLandlockCreateRuleset, 0, 0, landlockCreateRulesetVersion)
+	if errno != 0 {
+		return errno
+	}
+
+	handled := uint64(accessExecute | accessWriteFile | accessReadFile | accessReadDir | accessRemoveDir |
+		accessRemoveFile | accessMakeChar | accessMakeDir | accessMakeReg | accessMakeSock | accessMakeFifo |
+		accessMakeBlock | accessMakeSym)
+	read := uint64(accessReadFile | accessReadDir)
+	write := read | accessWriteFile | accessRemoveDir | accessRemoveFile | accessMakeDir | accessMakeReg
+	if abi >= 2 {
+		handled |= accessRefer
+		write |= accessRefer
+	}
+	if abi >= 3 {
+		handled |= accessTruncate
+		write |= accessTruncate
+	}
+
+	attr := struct{ handledAccessFS uint64 }{handled}
+	fd, _, errno := syscall.Syscall(sysLandlockCreateRuleset, uintptr(unsafe.Pointer(&attr)), unsafe.Sizeof(attr), 0)
+	if errno != 0 {
+		return errno
+	}
+	ruleset := int(fd)
+	defer syscall.Close(ruleset)
+
+	if err := addRule(ruleset, exe, accessExecute|accessReadFile); err != nil {
+		return err
+	}
+	for _, path := range systemPaths {
+		if err := addRule(ruleset, path, read|accessExecute); err != nil {
+			return err
+		}
+	}
+	for _, path := range cfg.ReadPaths {
+		if err := addRule(ruleset, path, read); err != nil {
+			return err
+		}
+	}
+	for _, path := range cfg.WritePaths {
+		if err := addRule(ruleset, path, write); err != nil {
+			return err
+		}
+	}
+
+	if _, _, errno = syscall.Syscall(sysLandlockRestrictSelf, uintptr(ruleset), 0, 0); errno != 0 {
+		return fmt.Errorf("restrict self: %w", errno)
+	}
+	return nil
+}
+
+// addRule 允许访问 path 及其下的文件，path 不存在时跳过
+func addRule(ruleset int, path string, access uint64) error {
+	fd, err := syscall.Open(path, oPath|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		if err == syscall.ENOENT {
+			return nil
+		}
+		return fmt.Errorf("open %s: %w", path, err)
+	}
+	defer syscall.Close(fd)
+
+	var st syscall.Stat_t
+	if err = syscall.Fstat(fd, &st); err != nil {
+		return fmt.Errorf("stat %s: %w", path, err)
+	}
+	if st.Mode&syscall.S_IFMT != syscall.S_IFDIR {
+		access &= accessFileOnly
+	}
+
+	// struct landlock_path_beneath_attr 是 packed 的：8 字节权限 + 4 字节 fd
+	var attr [12]byte
+	binary.NativeEndian.PutUint64(attr[0:], access)
+	binary.NativeEndian.PutUint32(attr[8:], uint32(fd))
+	_, _, errno := syscall.Syscall6(sysLandlockAddRule, uintptr(ruleset), landlockRulePathBeneath,
+		uintptr(unsafe.Pointer(&attr[0])), 0, 0, 0)
+	if errno != 0 {
+		return fmt.Errorf("add rule %s: %w", path, errno)
+	}
+	return nil
+}
+
+type sockFilter struct {
+	code uint16
+	jt   uint8
+	jf   uint8
+	k    uint32
+}
+
+type sockFprog struct {
+	len    uint16
+	filter *sockFilter
+}
+
+// installSeccomp 拒绝创建 AF_UNIX 以外的 socket 以及 execve/execveat，TSYNC 作用于进程的所有线程
+func installSeccomp() {
+	if auditArch == 0 {
+		log.Printf("sandbox: seccomp filter not available on %s", runtime.GOARCH)
+		return
+	}
+
+	// struct seccomp_data：nr 在偏移 0，arch 在偏移 4，args[0] 的低 32 位在偏移 16（小端）
+	filter := []sockFilter{
+		/* 0 */ {bpfLdAbsW, 0, 0, 4},
+		/* 1 */ {bpfJeqK, 1, 0, auditArch},
+		/* 2 */ {bpfRetK, 0, 0, seccompRetErrno | uint32(syscall.EPERM)},
+		/* 3 */ {bpfLdAbsW, 0, 0, 0},
+		/* 4 */ {bpfJgeK, 6, 0, x32SyscallBit},
+		/* 5 */ {bpfJeqK, 0, 2, sysSocket},
+		/* 6 */ {bpfLdAbsW, 0, 0, 16},
+		/* 7 */ {bpfJeqK, 2, 4, syscall.AF_UNIX},
+		/* 8 */ {bpfJeqK, 2, 0, sysExecve},
+		/* 9 */ {bpfJeqK, 1, 0, sysExecveat},
+		/* 10 */ {bpfRetK, 0, 0, seccompRetAllow},
+		/* 11 */ {bpfRetK, 0, 0, seccompRetErrno | uint32(syscall.EPERM)},
+		/* 12 */ {bpfRetK, 0, 0, seccompRetErrno | uint32(syscall.EACCES)},
+	}
+	prog := sockFprog{len: uint16(len(filter)), filter: &filter[0]}
+
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prSetNoNewPrivs, 1, 0); errno != 0 {
+		log.Printf("sandbox: prctl(PR_SET_NO_NEW_PRIVS) failed: %v", errno)
+	}
+	r, _, errno := syscall.Syscall(sysSeccomp, seccompSetModeFilter, seccompFilterFlagTsync, uintptr(unsafe.Pointer(&prog)))
+	runtime.KeepAlive(filter)
+	if errno != 0 {
+		log.Printf("sandbox: seccomp unavailable (%v), network and exec are not restricted", errno)
+		return
+	}
+	if r != 0 {
+		log.Printf("sandbox: seccomp could not sync thread %d, network and exec are not restricted", r)
+	}
+}
@@ -0,0 +1,10 @@
+package dwg_service_sandbox
+
+// x86_64 的 seccomp 参数，syscall 包中没有 seccomp/execveat 的调用号
+const (
+	auditArch   = 0xc000003e // AUDIT_ARCH_X86_64
+	sysSocket   = 41
+	sysExecve   = 59
+	sysExecveat = 322
+	sysSeccomp  = 317
+)
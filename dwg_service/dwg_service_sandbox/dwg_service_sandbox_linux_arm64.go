@@ -0,0 +1,10 @@
+package dwg_service_sandbox
+
+// aarch64 的 seccomp 参数
+const (
+	auditArch   = 0xc00000b7 // AUDIT_ARCH_AARCH64
+	sysSocket   = 198
+	sysExecve   = 221
+	sysExecveat = 281
+	sysSeccomp  = 277
+)
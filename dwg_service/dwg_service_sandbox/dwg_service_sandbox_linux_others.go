@@ -0,0 +1,12 @@
+//go:build linux && !amd64 && !arm64
+
+package dwg_service_sandbox
+
+// 其他架构不安装 seccomp 过滤器，auditArch 为 0 时跳过
+const (
+	auditArch   = 0
+	sysSocket   = 0
+	sysExecve   = 0
+	sysExecveat = 0
+	sysSeccomp  = 0
+)
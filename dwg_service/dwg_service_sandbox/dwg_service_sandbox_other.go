@@ -0,0 +1,11 @@
+//go:build !linux
+
+package dwg_service_sandbox
+
+import "log"
+
+// Enter 非 Linux 平台不支持沙箱，仅输出警告
+func Enter(cfg *Config) error {
+	log.Printf("sandbox: not supported on this platform, worker runs unrestricted")
+	return nil
+}
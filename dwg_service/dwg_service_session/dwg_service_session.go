@@ -0,0 +1,278 @@
+package dwg_service_session
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/BlockLucky/dwg-go/protocol"
+)
+
+var (
+	ErrSessionNotFound = errors.New("session not found")
+	ErrSessionLimit    = errors.New("session limit exceeded")
+)
+
+// Resource 会话持有的常驻资源（已解析的图纸），Close 需自行处理并发保护
+type Resource interface {
+	Close()
+}
+
+type Config struct {
+	IdleTTL     time.Duration
+	MaxSessions int
+	MaxMemory   int64
+}
+
+// Info 会话快照
+type Info = protocol.SessionInfo
+
+type session struct {
+	info  Info
+	res   Resource
+	inUse int
+}
+
+// Stats 会话统计
+type Stats struct {
+	Sessions  int   `json:"sessions"`
+	Memory    int64 `json:"memory"`
+	MaxMemory int64 `json:"max_memory"`
+	Evicted   int64 `json:"evicted"`
+}
+
+// Store 会话表，按空闲超时与内存上限淘汰最久未使用的会话
+type Store struct {
+	cfg Config
+
+	lock     sync.Mutex
+	sessions map[string]*session
+	memory   int64
+	evicted  int64
+}
+
+func NewStore(cfg Config) *Store {
+	return &Store{
+		cfg:      cfg,
+		sessions: make(map[string]*session),
+	}
+}
+
+// Open 预留内存后调用 open 加载资源，memory 为预估占用；空间不足时先淘汰空闲会话
+func (s *Store) Open(path string, memory int64, open func() (Resource, error)) (Info, error) {
+	s.lock.Lock()
+	victims, err := s.reserveLocked(memory)
+	s.lock.Unlock()
+	closeAll(victims)
+	if err != nil {
+		return Info{}, err
+	}
+
+	res, err := open()
+	if err != nil {
+		s.lock.Lock()
+		s.memory -= memory
+		s.lock.Unlock()
+		return Info{}, err
+	}
+
+	now := time.Now()
+	sess := &session{
+		info: Info{
+			ID:       newSessionID(),
+			Path:     path,
+			Memory:   memory,
+			OpenedAt: now,
+			LastUsed: now,
+		},
+		res: res,
+	}
+
+	s.lock.Lock()
+	s.sessions[sess.info.ID] = sess
+	info := s.infoLocked(sess)
+	s.lock.Unlock()
+	return info, nil
+}
+
+// reserveLocked 为新会话预留内存，返回需要在锁外关闭的被淘汰会话
+func (s *Store) reserveLocked(memory int64) ([]Resource, error) {
+	if s.cfg.MaxMemory > 0 && memory > s.cfg.MaxMemory {
+		return nil, fmt.Errorf("%w: drawing needs %d bytes, limit is %d", ErrSessionLimit, memory, s.cfg.MaxMemory)
+	}
+
+	var victims []Resource
+	for s.overLimitLocked(memory) {
+		victim := s.lruIdleLocked()
+		if victim == nil {
+			return victims, fmt.Errorf("%w: %d sessions using %d bytes", ErrSessionLimit, len(s.sessions), s.memory)
+		}
+		victims = append(victims, s.removeLocked(victim))
+		s.evicted++
+	}
+	s.memory += memory
+	return victims, nil
+}
+
+func (s *Store) overLimitLocked(memory int64) bool {
+	if s.cfg.MaxSessions > 0 && len(s.sessions)+1 > s.cfg.MaxSessions {
+		return true
+	}
+	return s.cfg.MaxMemory > 0 && s.memory+memory > s.cfg.MaxMemory
+}
+
+func (s *Store) lruIdleLocked() *session {
+	var victim *session
+	for _, sess := range s.sessions {
+		if sess.inUse > 0 {
+			continue
+		}
+		if victim == nil || sess.info.LastUsed.Before(victim.info.LastUsed) {
+			victim = sess
+		}
+	}
+	return victim
+}
+
+func (s *Store) removeLocked(sess *session) Resource {
+	delete(s.sessions, sess.info.ID)
+	s.memory -= sess.info.Memory
+	return sess.res
+}
+
+// Acquire 取出会话资源，使用期间不会被淘汰，用完必须调用 release
+func (s *Store) Acquire(id string) (res Resource, release func(), err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	sess, ok := s.sessions[id]
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: %s", ErrSessionNotFound, id)
+	}
+	sess.inUse++
+	sess.info.LastUsed = time.Now()
+
+	var once sync.Once
+	release = func() {
+		once.Do(func() {
+			s.lock.Lock()
+			defer s.lock.Unlock()
+			sess.inUse--
+			sess.info.LastUsed = time.Now()
+		})
+	}
+	return sess.res, release, nil
+}
+
+// Close 关闭会话，会话正在被使用时返回错误
+func (s *Store) Close(id string) error {
+	s.lock.Lock()
+	sess, ok := s.sessions[id]
+	if !ok {
+		s.lock.Unlock()
+		return fmt.Errorf("%w: %s", ErrSessionNotFound, id)
+	}
+	if sess.inUse > 0 {
+		s.lock.Unlock()
+		return fmt.Errorf("session %s is busy", id)
+	}
+	res := s.removeLocked(sess)
+	s.lock.Unlock()
+
+	res.Close()
+	return nil
+}
+
+// Get 会话快照
+func (s *Store) Get(id string) (Info, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	sess, ok := s.sessions[id]
+	if !ok {
+		return Info{}, fmt.Errorf("%w: %s", ErrSessionNotFound, id)
+	}
+	return s.infoLocked(sess), nil
+}
+
+// List 全部会话快照，按打开时间排序
+func (s *Store) List() []Info {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	out := make([]Info, 0, len(s.sessions))
+	for _, sess := range s.sessions {
+		out = append(out, s.infoLocked(sess))
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].OpenedAt.Before(out[j].OpenedAt) })
+	return out
+}
+
+// Stats 会话统计
+func (s *Store) Stats() Stats {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return Stats{
+		Sessions:  len(s.sessions),
+		Memory:    s.memory,
+		MaxMemory: s.cfg.MaxMemory,
+		Evicted:   s.evicted,
+	}
+}
+
+func (s *Store) infoLocked(sess *session) Info {
+	info := sess.info
+	if s.cfg.IdleTTL > 0 {
+		info.ExpireAt = info.LastUsed.Add(s.cfg.IdleTTL)
+	}
+	return info
+}
+
+// EvictIdle 关闭空闲超过 IdleTTL 的会话，返回关闭数量
+func (s *Store) EvictIdle() int {
+	if s.cfg.IdleTTL <= 0 {
+		return 0
+	}
+
+	deadline := time.Now().Add(-s.cfg.IdleTTL)
+	var victims []Resource
+
+	s.lock.Lock()
+	for _, sess := range s.sessions {
+		if sess.inUse == 0 && sess.info.LastUsed.Before(deadline) {
+			victims = append(victims, s.removeLocked(sess))
+			s.evicted++
+		}
+	}
+	s.lock.Unlock()
+
+	closeAll(victims)
+	return len(victims)
+}
+
+// StartJanitor 后台定期清理空闲会话
+func (s *Store) StartJanitor(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			s.EvictIdle()
+		}
+	}()
+}
+
+func closeAll(resources []Resource) {
+	for _, res := range resources {
+		res.Close()
+	}
+}
+
+func newSessionID() string {
+	buf := make([]byte, 16)
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
@@ -0,0 +1,218 @@
+package dwg_service_session
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+type fakeResource struct {
+	name   string
+	closed bool
+}
+
+func (r *fakeResource) Close() {
+	r.closed = true
+}
+
+// openAll 依次打开 names，每个会话占用 memory，LastUsed 按顺序递增
+func openAll(t *testing.T, s *Store, memory int64, names ...string) map[string]*fakeResource {
+	t.Helper()
+	res := make(map[string]*fakeResource)
+	base := time.Now().Add(-time.Hour)
+	for i, name := range names {
+		r := &fakeResource{name: name}
+		info, err := s.Open(name, memory, func() (Resource, error) { return r, nil })
+		if err != nil {
+			t.Fatalf("open %s: %v", name, err)
+		}
+		s.sessions[info.ID].info.LastUsed = base.Add(time.Duration(i) * time.Second)
+		res[name] = r
+	}
+	return res
+}
+
+func sessionID(s *Store, path string) string {
+	for id, sess := range s.sessions {
+		if sess.info.Path == path {
+			return id
+		}
+	}
+	return ""
+}
+
+func TestStoreEvictsLRU(t *testing.T) {
+	tests := []struct {
+		name        string
+		cfg         Config
+		memory      int64
+		open        []string
+		touch       string
+		next        int64
+		wantErr     error
+		wantEvicted []string
+	}{
+		{
+			name:        "session count evicts oldest",
+			cfg:         Config{MaxSessions: 2},
+			memory:      1,
+			open:        []string{"a", "b"},
+			next:        1,
+			wantEvicted: []string{"a"},
+		},
+		{
+			name:        "recently used session is kept",
+			cfg:         Config{MaxSessions: 2},
+			memory:      1,
+			open:        []string{"a", "b"},
+			touch:       "a",
+			next:        1,
+			wantEvicted: []string{"b"},
+		},
+		{
+			name:        "memory evicts until it fits",
+			cfg:         Config{MaxMemory: 100},
+			memory:      40,
+			open:        []string{"a", "b"},
+			next:        70,
+			wantEvicted: []string{"a", "b"},
+		},
+		{
+			name:    "drawing larger than the limit",
+			cfg:     Config{MaxMemory: 100},
+			memory:  10,
+			open:    []string{"a"},
+			next:    101,
+			wantErr: ErrSessionLimit,
+		},
+		{
+			name:   "no limits",
+			memory: 1 << 40,
+			open:   []string{"a", "b", "c"},
+			next:   1 << 40,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewStore(tt.cfg)
+			res := openAll(t, s, tt.memory, tt.open...)
+			if tt.touch != "" {
+				_, release, err := s.Acquire(sessionID(s, tt.touch))
+				if err != nil {
+					t.Fatal(err)
+				}
+				release()
+			}
+
+			_, err := s.Open("next", tt.next, func() (Resource, error) { return &fakeResource{}, nil })
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("open next: error = %v, want %v", err, tt.wantErr)
+			}
+
+			evicted := map[string]bool{}
+			for _, name := range tt.wantEvicted {
+				evicted[name] = true
+			}
+			for name, r := range res {
+				if r.closed != evicted[name] {
+					t.Errorf("%s closed = %v, want %v", name, r.closed, evicted[name])
+				}
+				if (sessionID(s, name) == "") != evicted[name] {
+					t.Errorf("%s still in store = %v", name, sessionID(s, name) != "")
+				}
+			}
+			if got := s.Stats().Evicted; got != int64(len(tt.wantEvicted)) {
+				t.Errorf("evicted = %d, want %d", got, len(tt.wantEvicted))
+			}
+		})
+	}
+}
+
+func TestStoreBusySessionsAreNotEvicted(t *testing.T) {
+	s := NewStore(Config{MaxSessions: 1, IdleTTL: time.Minute})
+	res := openAll(t, s, 1, "a")
+	_, release, err := s.Acquire(sessionID(s, "a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = s.Open("b", 1, func() (Resource, error) { return &fakeResource{}, nil }); !errors.Is(err, ErrSessionLimit) {
+		t.Fatalf("open while busy: error = %v, want %v", err, ErrSessionLimit)
+	}
+	if err = s.Close(sessionID(s, "a")); err == nil {
+		t.Fatal("closing a busy session succeeded")
+	}
+	s.sessions[sessionID(s, "a")].info.LastUsed = time.Now().Add(-time.Hour)
+	if n := s.EvictIdle(); n != 0 || res["a"].closed {
+		t.Fatalf("idle eviction closed a busy session")
+	}
+
+	release()
+	release()
+	if sess := s.sessions[sessionID(s, "a")]; sess.inUse != 0 {
+		t.Fatalf("inUse = %d after release, want 0", sess.inUse)
+	}
+	if _, err = s.Open("b", 1, func() (Resource, error) { return &fakeResource{}, nil }); err != nil {
+		t.Fatalf("open after release: %v", err)
+	}
+	if !res["a"].closed {
+		t.Error("released session was not evicted")
+	}
+}
+
+func TestStoreEvictIdle(t *testing.T) {
+	s := NewStore(Config{IdleTTL: 10 * time.Minute})
+	res := openAll(t, s, 5, "old", "fresh")
+	s.sessions[sessionID(s, "old")].info.LastUsed = time.Now().Add(-11 * time.Minute)
+	s.sessions[sessionID(s, "fresh")].info.LastUsed = time.Now().Add(-9 * time.Minute)
+
+	if n := s.EvictIdle(); n != 1 {
+		t.Fatalf("EvictIdle() = %d, want 1", n)
+	}
+	if !res["old"].closed || res["fresh"].closed {
+		t.Errorf("closed old=%v fresh=%v, want true false", res["old"].closed, res["fresh"].closed)
+	}
+	st := s.Stats()
+	if st.Sessions != 1 || st.Memory != 5 {
+		t.Errorf("stats = %+v, want 1 session using 5 bytes", st)
+	}
+
+	info, err := s.Get(sessionID(s, "fresh"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := info.LastUsed.Add(10 * time.Minute); !info.ExpireAt.Equal(want) {
+		t.Errorf("ExpireAt = %s, want %s", info.ExpireAt, want)
+	}
+
+	if n := NewStore(Config{}).EvictIdle(); n != 0 {
+		t.Errorf("EvictIdle without TTL = %d", n)
+	}
+}
+
+func TestStoreOpenFailureReleasesMemory(t *testing.T) {
+	s := NewStore(Config{MaxMemory: 10})
+	boom := errors.New("boom")
+	if _, err := s.Open("bad", 10, func() (Resource, error) { return nil, boom }); !errors.Is(err, boom) {
+		t.Fatalf("error = %v, want %v", err, boom)
+	}
+	if st := s.Stats(); st.Memory != 0 || st.Sessions != 0 {
+		t.Fatalf("stats after failed open = %+v", st)
+	}
+	if _, err := s.Open("good", 10, func() (Resource, error) { return &fakeResource{}, nil }); err != nil {
+		t.Fatalf("open after failure: %v", err)
+	}
+}
+
+func TestStoreNotFound(t *testing.T) {
+	s := NewStore(Config{})
+	if _, _, err := s.Acquire("missing"); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("Acquire: %v", err)
+	}
+	if err := s.Close("missing"); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("Close: %v", err)
+	}
+	if _, err := s.Get("missing"); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("Get: %v", err)
+	}
+}
@@ -0,0 +1,653 @@
+package main
+
+/*
+#include <stdlib.h>
+#include <dwg.h>
+#include <dwg_api.h>
+
+// dwg_add_* 返回类型结构，其第一个字段 parent 指向实体或对象的公共结构，公共结构以 objid 开头
+static Dwg_Object *dwge_object(Dwg_Data *dwg, void *typed) {
+  BITCODE_BL *objid = *(BITCODE_BL **)typed;
+  return &dwg->object[*objid];
+}
+static Dwg_Object_Entity *dwge_entity(Dwg_Object *o) { return o->tio.entity; }
+static Dwg_Object_LAYER *dwge_layer(Dwg_Object *o) { return o->tio.object->tio.LAYER; }
+static Dwg_Object_BLOCK_HEADER *dwge_block_header(Dwg_Object *o) { return o->tio.object->tio.BLOCK_HEADER; }
+static Dwg_Entity_LINE *dwge_line(Dwg_Object *o) { return o->tio.entity->tio.LINE; }
+static Dwg_Entity_CIRCLE *dwge_circle(Dwg_Object *o) { return o->tio.entity->tio.CIRCLE; }
+static Dwg_Entity_ARC *dwge_arc(Dwg_Object *o) { return o->tio.entity->tio.ARC; }
+static Dwg_Entity_POINT *dwge_point(Dwg_Object *o) { return o->tio.entity->tio.POINT; }
+static Dwg_Entity_TEXT *dwge_text(Dwg_Object *o) { return o->tio.entity->tio.TEXT; }
+static Dwg_Entity_MTEXT *dwge_mtext(Dwg_Object *o) { return o->tio.entity->tio.MTEXT; }
+static Dwg_Entity_INSERT *dwge_insert(Dwg_Object *o) { return o->tio.entity->tio.INSERT; }
+static Dwg_Entity_LWPOLYLINE *dwge_lwpolyline(Dwg_Object *o) { return o->tio.entity->tio.LWPOLYLINE; }
+
+static void dwge_set_string(BITCODE_T *slot, BITCODE_T value) {
+  free(*slot);
+  *slot = value;
+}
+
+// R2004 及以上版本按 rgb 的高字节区分随层（0xc0）、随块（0xc1）与索引色（0xc3）
+static void dwge_set_color(Dwg_Color *c, int index) {
+  int aci = index < 0 ? -index : index;
+  c->index = index;
+  c->flag = 0;
+  c->rgb = aci == 256 ? 0xc0000000 : aci == 0 ? 0xc1000000 : 0xc3000000 | (aci & 0xff);
+}
+
+static void dwge_set_layer_flags(Dwg_Object_LAYER *l, int off, int frozen, int locked) {
+  l->on = !off;
+  l->frozen = frozen;
+  l->locked = locked;
+  l->flag = (l->flag & ~5) | (frozen ? 1 : 0) | (locked ? 4 : 0);
+}
+
+// 替换 LWPOLYLINE 的顶点，顶点数变化时清空凸度
+static int dwge_set_lwpoints(Dwg_Entity_LWPOLYLINE *pl, const dwg_point_2d *pts, BITCODE_BL n) {
+  BITCODE_2RD *points = (BITCODE_2RD *)calloc(n, sizeof(BITCODE_2RD));
+  if (!points)
+    return -1;
+  for (BITCODE_BL i = 0; i < n; i++) {
+    points[i].x = pts[i].x;
+    points[i].y = pts[i].y;
+  }
+  free(pl->points);
+  pl->points = points;
+  if (pl->num_points != n) {
+    free(pl->bulges);
+    pl->bulges = NULL;
+    pl->num_bulges = 0;
+  }
+  pl->num_points = n;
+  return 0;
+}
+*/
+import "C"
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"unsafe"
+
+	"github.com/BlockLucky/dwg-go/api/api_method"
+	"github.com/BlockLucky/dwg-go/api/api_rpc"
+	"github.com/BlockLucky/dwg-go/protocol"
+)
+
+// 实体颜色号：0 随块，256 随层；图层默认颜色为 7（白）
+const (
+	colorByBlock      = 0
+	colorByLayer      = 256
+	defaultLayerColor = 7
+)
+
+// LWPOLYLINE 的闭合标志位
+const lwpolylineClosed = 512
+
+func methodDocEdit(ctx context.Context, reqModel *api_rpc.RPCRequest, notify api_method.Notifier) (interface{}, error) {
+	var p protocol.EditParams
+	if err := api_method.DecodeParams(reqModel, &p); err != nil {
+		return nil, err
+	}
+	return withDrawing(p.Session, "", notify, func(d *drawing) (interface{}, error) {
+		return d.edit(ctx, p.Ops)
+	})
+}
+
+// edit 按顺序执行编辑操作，调用方须持有 dwgLock。某个操作失败时撤销此前已执行的操作，
+// 图纸回到调用前的状态
+func (d *drawing) edit(ctx context.Context, ops []*protocol.EditOp) (*protocol.EditResult, error) {
+	result := &protocol.EditResult{
+		Handles: make([]protocol.Handle, 0, len(ops)),
+		Applied: make([]*protocol.EditOp, 0, len(ops)),
+		Undo:    make([]*protocol.EditOp, 0, len(ops)),
+	}
+	seed := d.handseed()
+	for i, op := range ops {
+		if err := ctx.Err(); err != nil {
+			return nil, d.rollback(result.Undo, seed, err)
+		}
+		inverse, err := d.inverse(op)
+		var h protocol.Handle
+		if err == nil {
+			h, err = d.apply(ctx, op)
+		}
+		d.graph = nil
+		if err != nil {
+			return nil, d.rollback(result.Undo, seed, fmt.Errorf("op %d (%s): %w", i, op.Op, err))
+		}
+		if inverse == nil {
+			inverse = undoAdd(op.Op, h)
+		}
+
+		applied := *op
+		applied.Handle = h
+		result.Handles = append(result.Handles, h)
+		result.Applied = append(result.Applied, &applied)
+		result.Undo = append(inverse, result.Undo...)
+	}
+	result.HandSeed = d.handseed()
+	return result, nil
+}
+
+func (d *drawing) apply(ctx context.Context, op *protocol.EditOp) (protocol.Handle, error) {
+	switch op.Op {
+	case protocol.EditAddEntity:
+		return d.addEntity(op.Handle, op.Entity)
+	case protocol.EditModifyEntity:
+		return op.Handle, d.modifyEntity(op.Handle, op.Entity)
+	case protocol.EditDeleteEntity:
+		return op.Handle, d.deleteEntity(op.Handle)
+	case protocol.EditAddLayer:
+		return d.addLayer(op.Handle, op.Layer)
+	case protocol.EditModifyLayer:
+		return op.Handle, d.modifyLayer(op.Handle, op.Layer)
+	case protocol.EditDeleteLayer:
+		return op.Handle, d.deleteLayer(ctx, op.Handle)
+	case protocol.EditAddBlock:
+		return d.addBlock(op.Handle, op.Block)
+	case protocol.EditDeleteBlock:
+		return op.Handle, d.deleteBlock(ctx, op.Handle)
+	case protocol.EditRestore:
+		return op.Handle, d.restore(op.Handle)
+	default:
+		return 0, fmt.Errorf("unknown edit op %q", op.Op)
+	}
+}
+
+// checkNewHandle 检查新建对象指定的句柄没有被使用
+func (d *drawing) checkNewHandle(h protocol.Handle) error {
+	if h != 0 && d.resolve(h) != nil {
+		return fmt.Errorf("handle %X is already in use", uint64(h))
+	}
+	return nil
+}
+
+// added 完成新建：h 非 0 时改用 h，LibreDWG 分配的句柄与已有对象冲突时改用 $HANDSEED；
+// 然后将 before 之后新增的对象加入索引，并保证 $HANDSEED 大于所有句柄
+func (d *drawing) added(obj *C.Dwg_Object, h protocol.Handle, before int) protocol.Handle {
+	if _, dup := d.handles[d.handleOf(obj)]; h == 0 && dup {
+		h = d.nextHandle()
+	}
+	if h != 0 {
+		d.rehandle(obj, h)
+	}
+
+	last := d.handseed()
+	n := d.numObjects()
+	for i := before; i < n; i++ {
+		d.indexObject(i)
+		if added := d.handleOf(d.object(i)); added >= last {
+			last = added + 1
+		}
+	}
+	d.setHandseed(last)
+	return d.handleOf(obj)
+}
+
+// nextHandle 下一个可用的句柄
+func (d *drawing) nextHandle() protocol.Handle {
+	if seed := d.handseed(); seed != 0 {
+		return seed
+	}
+	return d.maxHandle() + 1
+}
+
+// targetBlock 新建实体所在的块：模型空间、图纸空间或名为 block 的块定义
+func (d *drawing) targetBlock(space, block string) (*C.Dwg_Object_BLOCK_HEADER, error) {
+	var obj *C.Dwg_Object
+	switch space {
+	case "", protocol.SpaceModel:
+		obj = d.resolveType(d.modelBlk, C.DWG_TYPE_BLOCK_HEADER)
+	case protocol.SpacePaper:
+		obj = d.resolveType(d.paperBlk, C.DWG_TYPE_BLOCK_HEADER)
+	case protocol.SpaceBlock:
+		if block == "" {
+			return nil, errors.New("block name is required")
+		}
+		if obj = d.tableEntry(C.DWG_TYPE_BLOCK_HEADER, block); obj == nil {
+			return nil, fmt.Errorf("block %q not found", block)
+		}
+	default:
+		return nil, fmt.Errorf("unknown space %q", space)
+	}
+	if obj == nil {
+		return nil, fmt.Errorf("drawing has no %s space", space)
+	}
+	return C.dwge_block_header(obj), nil
+}
+
+// layerByName 名称对应的图层句柄，name 为空时返回 0
+func (d *drawing) layerByName(name string) (protocol.Handle, error) {
+	if name == "" {
+		return 0, nil
+	}
+	obj := d.tableEntry(C.DWG_TYPE_LAYER, name)
+	if obj == nil {
+		return 0, fmt.Errorf("layer %q not found", name)
+	}
+	return d.handleOf(obj), nil
+}
+
+// checkGeometry 检查实体类型所需的几何字段
+func checkGeometry(e *protocol.Entity) error {
+	need := func(n int) error {
+		if len(e.Points) < n {
+			return fmt.Errorf("%s needs %d points, got %d", e.Type, n, len(e.Points))
+		}
+		return nil
+	}
+	switch strings.ToUpper(e.Type) {
+	case "LINE", "LWPOLYLINE":
+		return need(2)
+	case "POINT", "TEXT", "MTEXT":
+		return need(1)
+	case "INSERT":
+		if e.Name == "" {
+			return errors.New("INSERT needs a block name")
+		}
+		return need(1)
+	case "CIRCLE", "ARC":
+		if e.Center == nil || e.Radius <= 0 {
+			return fmt.Errorf("%s needs a center and a positive radius", e.Type)
+		}
+		return nil
+	default:
+		return fmt.Errorf("editing %s entities is not supported", e.Type)
+	}
+}
+
+func checkColor(color, lo, hi int) error {
+	if color < lo || color > hi {
+		return fmt.Errorf("color %d out of range [%d, %d]", color, lo, hi)
+	}
+	return nil
+}
+
+// addEntity 新建实体，Color 与读出时相同：0 随块，256 随层
+func (d *drawing) addEntity(h protocol.Handle, e *protocol.Entity) (protocol.Handle, error) {
+	if e == nil {
+		return 0, errors.New("entity is required")
+	}
+	if err := d.checkNewHandle(h); err != nil {
+		return 0, err
+	}
+	if err := checkGeometry(e); err != nil {
+		return 0, err
+	}
+	if err := checkColor(e.Color, 0, colorByLayer); err != nil {
+		return 0, err
+	}
+	layer, err := d.layerByName(e.Layer)
+	if err != nil {
+		return 0, err
+	}
+	blk, err := d.targetBlock(e.Space, e.Block)
+	if err != nil {
+		return 0, err
+	}
+
+	before := d.numObjects()
+	var typed unsafe.Pointer
+	switch strings.ToUpper(e.Type) {
+	case "LINE":
+		start, end := apiPoint3(e.Points[0]), apiPoint3(e.Points[1])
+		typed = unsafe.Pointer(C.dwg_add_LINE(blk, &start, &end))
+	case "CIRCLE":
+		center := apiPoint3(*e.Center)
+		typed = unsafe.Pointer(C.dwg_add_CIRCLE(blk, &center, C.double(e.Radius)))
+	case "ARC":
+		center := apiPoint3(*e.Center)
+		typed = unsafe.Pointer(C.dwg_add_ARC(blk, &center, C.double(e.Radius), C.double(e.StartAngle), C.double(e.EndAngle)))
+	case "POINT":
+		pt := apiPoint3(e.Points[0])
+		typed = unsafe.Pointer(C.dwg_add_POINT(blk, &pt))
+	case "TEXT":
+		pt := apiPoint3(e.Points[0])
+		text := C.CString(e.Text)
+		defer C.free(unsafe.Pointer(text))
+		typed = unsafe.Pointer(C.dwg_add_TEXT(blk, text, &pt, C.double(e.Height)))
+	case "MTEXT":
+		pt := apiPoint3(e.Points[0])
+		text := C.CString(e.Text)
+		defer C.free(unsafe.Pointer(text))
+		typed = unsafe.Pointer(C.dwg_add_MTEXT(blk, &pt, 0, text))
+	case "INSERT":
+		if d.tableEntry(C.DWG_TYPE_BLOCK_HEADER, e.Name) == nil {
+			return 0, fmt.Errorf("block %q not found", e.Name)
+		}
+		pt, scale := apiPoint3(e.Points[0]), insertScale(e)
+		name := C.CString(e.Name)
+		defer C.free(unsafe.Pointer(name))
+		typed = unsafe.Pointer(C.dwg_add_INSERT(blk, &pt, name, C.double(scale.X), C.double(scale.Y), C.double(scale.Z), C.double(e.Rotation)))
+	case "LWPOLYLINE":
+		pts := apiPoints2(e.Points)
+		typed = unsafe.Pointer(C.dwg_add_LWPOLYLINE(blk, C.int(len(pts)), &pts[0]))
+	}
+	if typed == nil {
+		return 0, fmt.Errorf("libredwg could not add %s", e.Type)
+	}
+
+	obj := C.dwge_object(d.dwg, typed)
+	if err := d.setGeometry(obj, e); err != nil {
+		return 0, err
+	}
+	d.setEntityStyle(obj, layer, e.Color)
+	return d.added(obj, h, before), nil
+}
+
+// modifyEntity 用 e 替换实体的图层、颜色与几何数据，Layer 为空时图层不变
+func (d *drawing) modifyEntity(h protocol.Handle, e *protocol.Entity) error {
+	if e == nil {
+		return errors.New("entity is required")
+	}
+	obj := d.resolve(h)
+	if obj == nil || !d.isEntity(obj) {
+		return fmt.Errorf("entity %X not found", uint64(h))
+	}
+	name := C.GoString(obj.name)
+	if e.Type == "" {
+		e.Type = name
+	} else if !strings.EqualFold(e.Type, name) {
+		return fmt.Errorf("entity %X is %s, not %s", uint64(h), name, e.Type)
+	}
+	if err := checkGeometry(e); err != nil {
+		return err
+	}
+	if err := checkColor(e.Color, 0, colorByLayer); err != nil {
+		return err
+	}
+	layer, err := d.layerByName(e.Layer)
+	if err != nil {
+		return err
+	}
+	if err = d.setGeometry(obj, e); err != nil {
+		return err
+	}
+	d.setEntityStyle(obj, layer, e.Color)
+	return nil
+}
+
+// deleteEntity 删除实体及其扩展字典，数据保留到撤销或会话关闭
+func (d *drawing) deleteEntity(h protocol.Handle) error {
+	obj := d.resolve(h)
+	if obj == nil || !d.isEntity(obj) {
+		return fmt.Errorf("entity %X not found", uint64(h))
+	}
+	var objs []*C.Dwg_Object
+	if xdic := d.resolve(d.xdic(obj)); xdic != nil && d.owner(xdic) == h {
+		objs = append(objs, xdic)
+	}
+	d.park(h, append(objs, obj)...)
+	return nil
+}
+
+// setEntityStyle 设置实体的图层与颜色，layer 为 0 时图层不变
+func (d *drawing) setEntityStyle(obj *C.Dwg_Object, layer protocol.Handle, color int) {
+	if layer != 0 {
+		d.setLayerRef(obj, layer)
+	}
+	C.dwge_set_color(&C.dwge_entity(obj).color, C.int(color))
+}
+
+// setGeometry 按 e 设置实体的几何数据，调用前已由 checkGeometry 检查
+func (d *drawing) setGeometry(obj *C.Dwg_Object, e *protocol.Entity) error {
+	switch obj.fixedtype {
+	case C.DWG_TYPE_LINE:
+		line := C.dwge_line(obj)
+		line.start, line.end = bd3(e.Points[0]), bd3(e.Points[1])
+	case C.DWG_TYPE_CIRCLE:
+		circle := C.dwge_circle(obj)
+		circle.center = bd3(*e.Center)
+		circle.radius = C.BITCODE_BD(e.Radius)
+	case C.DWG_TYPE_ARC:
+		arc := C.dwge_arc(obj)
+		arc.center = bd3(*e.Center)
+		arc.radius = C.BITCODE_BD(e.Radius)
+		arc.start_angle = C.BITCODE_BD(e.StartAngle)
+		arc.end_angle = C.BITCODE_BD(e.EndAngle)
+	case C.DWG_TYPE_POINT:
+		pt := C.dwge_point(obj)
+		pt.x, pt.y, pt.z = C.BITCODE_BD(e.Points[0].X), C.BITCODE_BD(e.Points[0].Y), C.BITCODE_BD(e.Points[0].Z)
+	case C.DWG_TYPE_TEXT:
+		text := C.dwge_text(obj)
+		text.ins_pt = rd2(e.Points[0])
+		text.elevation = C.BITCODE_RD(e.Points[0].Z)
+		text.height = C.BITCODE_RD(e.Height)
+		text.rotation = C.BITCODE_RD(e.Rotation)
+		d.setString(&text.text_value, e.Text)
+	case C.DWG_TYPE_MTEXT:
+		mtext := C.dwge_mtext(obj)
+		mtext.ins_pt = bd3(e.Points[0])
+		mtext.text_height = C.BITCODE_BD(e.Height)
+		d.setString(&mtext.text, e.Text)
+	case C.DWG_TYPE_INSERT:
+		blk := d.tableEntry(C.DWG_TYPE_BLOCK_HEADER, e.Name)
+		if blk == nil {
+			return fmt.Errorf("block %q not found", e.Name)
+		}
+		insert := C.dwge_insert(obj)
+		insert.ins_pt = bd3(e.Points[0])
+		insert.scale = bd3(insertScale(e))
+		insert.rotation = C.BITCODE_BD(e.Rotation)
+		d.setRef(&insert.block_header, refHardPointer, d.handleOf(blk))
+	case C.DWG_TYPE_LWPOLYLINE:
+		pline := C.dwge_lwpolyline(obj)
+		pts := apiPoints2(e.Points)
+		if C.dwge_set_lwpoints(pline, &pts[0], C.BITCODE_BL(len(pts))) != 0 {
+			return errors.New("out of memory")
+		}
+		pline.elevation = C.BITCODE_BD(e.Points[0].Z)
+		if e.Closed {
+			pline.flag |= lwpolylineClosed
+		} else {
+			pline.flag &^= lwpolylineClosed
+		}
+	default:
+		return fmt.Errorf("editing %s entities is not supported", C.GoString(obj.name))
+	}
+	return nil
+}
+
+// setString 设置字符串字段，按图纸版本转换编码
+func (d *drawing) setString(slot *C.BITCODE_T, s string) {
+	cs := C.CString(s)
+	defer C.free(unsafe.Pointer(cs))
+	C.dwge_set_string(slot, C.dwg_add_u8_input(d.dwg, cs))
+}
+
+// addLayer 新建图层，Color 为 0 时为白色
+func (d *drawing) addLayer(h protocol.Handle, l *protocol.Layer) (protocol.Handle, error) {
+	if l == nil || l.Name == "" {
+		return 0, errors.New("layer name is required")
+	}
+	if err := d.checkNewHandle(h); err != nil {
+		return 0, err
+	}
+	if d.tableEntry(C.DWG_TYPE_LAYER, l.Name) != nil {
+		return 0, fmt.Errorf("layer %q already exists", l.Name)
+	}
+	color, err := layerColor(l)
+	if err != nil {
+		return 0, err
+	}
+
+	before := d.numObjects()
+	name := C.CString(l.Name)
+	defer C.free(unsafe.Pointer(name))
+	layer := C.dwg_add_LAYER(d.dwg, name)
+	if layer == nil {
+		return 0, fmt.Errorf("libredwg could not add layer %q", l.Name)
+	}
+	setLayerProps(layer, l, color)
+	return d.added(C.dwge_object(d.dwg, unsafe.Pointer(layer)), h, before), nil
+}
+
+// modifyLayer 用 l 替换图层的名称、颜色与开关状态，Name 为空时不改名；图层 0 不能改名
+func (d *drawing) modifyLayer(h protocol.Handle, l *protocol.Layer) error {
+	if l == nil {
+		return errors.New("layer is required")
+	}
+	obj := d.resolveType(h, C.DWG_TYPE_LAYER)
+	if obj == nil {
+		return fmt.Errorf("layer %X not found", uint64(h))
+	}
+	color, err := layerColor(l)
+	if err != nil {
+		return err
+	}
+	layer := C.dwge_layer(obj)
+	if current := d.tableName(obj); l.Name != "" && l.Name != current {
+		if current == "0" {
+			return errors.New("layer 0 cannot be renamed")
+		}
+		if other := d.tableEntry(C.DWG_TYPE_LAYER, l.Name); other != nil && other != obj {
+			return fmt.Errorf("layer %q already exists", l.Name)
+		}
+		d.setString(&layer.name, l.Name)
+		d.layers[h] = l.Name
+	}
+	setLayerProps(layer, l, color)
+	return nil
+}
+
+// deleteLayer 删除没有被使用的图层，图层 0 不能删除
+func (d *drawing) deleteLayer(ctx context.Context, h protocol.Handle) error {
+	obj := d.resolveType(h, C.DWG_TYPE_LAYER)
+	if obj == nil {
+		return fmt.Errorf("layer %X not found", uint64(h))
+	}
+	name := d.tableName(obj)
+	if name == "0" {
+		return errors.New("layer 0 cannot be deleted")
+	}
+	if err := d.checkUnused(ctx, h, "layer", name); err != nil {
+		return err
+	}
+	d.park(h, obj)
+	return nil
+}
+
+func layerColor(l *protocol.Layer) (int, error) {
+	color := l.Color
+	if color == 0 {
+		color = defaultLayerColor
+	}
+	return color, checkColor(color, 1, 255)
+}
+
+// setLayerProps 设置图层颜色与开关状态，关闭的图层颜色号存为负数
+func setLayerProps(layer *C.Dwg_Object_LAYER, l *protocol.Layer, color int) {
+	if l.Off {
+		color = -color
+	}
+	C.dwge_set_color(&layer.color, C.int(color))
+	C.dwge_set_layer_flags(layer, cBool(l.Off), cBool(l.Frozen), cBool(l.Locked))
+}
+
+// addBlock 新建空的块定义，随后用 Space 为 block 的 add_entity 向其中添加实体
+func (d *drawing) addBlock(h protocol.Handle, b *protocol.Block) (protocol.Handle, error) {
+	if b == nil || b.Name == "" {
+		return 0, errors.New("block name is required")
+	}
+	if strings.HasPrefix(b.Name, "*") {
+		return 0, fmt.Errorf("cannot add anonymous block %q", b.Name)
+	}
+	if err := d.checkNewHandle(h); err != nil {
+		return 0, err
+	}
+	if d.tableEntry(C.DWG_TYPE_BLOCK_HEADER, b.Name) != nil {
+		return 0, fmt.Errorf("block %q already exists", b.Name)
+	}
+
+	before := d.numObjects()
+	name := C.CString(b.Name)
+	defer C.free(unsafe.Pointer(name))
+	hdr := C.dwg_add_BLOCK_HEADER(d.dwg, name)
+	if hdr == nil || C.dwg_add_BLOCK(hdr, name) == nil || C.dwg_add_ENDBLK(hdr) == nil {
+		return 0, fmt.Errorf("libredwg could not add block %q", b.Name)
+	}
+	hdr.base_pt = bd3(b.BasePoint)
+	return d.added(C.dwge_object(d.dwg, unsafe.Pointer(hdr)), h, before), nil
+}
+
+// deleteBlock 删除没有被参照的块定义及其中的实体，模型空间、图纸空间与匿名块不能删除
+func (d *drawing) deleteBlock(ctx context.Context, h protocol.Handle) error {
+	obj := d.resolveType(h, C.DWG_TYPE_BLOCK_HEADER)
+	if obj == nil {
+		return fmt.Errorf("block %X not found", uint64(h))
+	}
+	name := d.tableName(obj)
+	if strings.HasPrefix(name, "*") {
+		return fmt.Errorf("block %q cannot be deleted", name)
+	}
+	if err := d.checkUnused(ctx, h, "block", name); err != nil {
+		return err
+	}
+	g, err := d.buildGraph(ctx)
+	if err != nil {
+		return err
+	}
+	var objs []*C.Dwg_Object
+	for _, child := range g.children[h] {
+		if member := d.resolve(child); member != nil {
+			objs = append(objs, member)
+		}
+	}
+	d.park(h, append(objs, obj)...)
+	return nil
+}
+
+// checkUnused 表项被服务端能解析的引用（不含所有者与反应器）使用时返回错误
+func (d *drawing) checkUnused(ctx context.Context, h protocol.Handle, kind, name string) error {
+	g, err := d.buildGraph(ctx)
+	if err != nil {
+		return err
+	}
+	users := 0
+	for _, in := range g.inbound[h] {
+		if !structuralFields[in.ref.Field] {
+			users++
+		}
+	}
+	if users > 0 {
+		return fmt.Errorf("%s %q is used by %d objects", kind, name, users)
+	}
+	return nil
+}
+
+func insertScale(e *protocol.Entity) protocol.Point {
+	if e.Scale == nil {
+		return protocol.Point{X: 1, Y: 1, Z: 1}
+	}
+	return *e.Scale
+}
+
+func cBool(b bool) C.int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func bd3(p protocol.Point) C.BITCODE_3BD {
+	return C.BITCODE_3BD{x: C.double(p.X), y: C.double(p.Y), z: C.double(p.Z)}
+}
+
+func rd2(p protocol.Point) C.BITCODE_2RD {
+	return C.BITCODE_2RD{x: C.double(p.X), y: C.double(p.Y)}
+}
+
+func apiPoint3(p protocol.Point) C.dwg_point_3d {
+	return C.dwg_point_3d{x: C.double(p.X), y: C.double(p.Y), z: C.double(p.Z)}
+}
+
+func apiPoints2(pts []protocol.Point) []C.dwg_point_2d {
+	out := make([]C.dwg_point_2d, len(pts))
+	for i, p := range pts {
+		out[i] = C.dwg_point_2d{x: C.double(p.X), y: C.double(p.Y)}
+	}
+	return out
+}
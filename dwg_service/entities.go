@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/BlockLucky/dwg-go/api/api_method"
+	"github.com/BlockLucky/dwg-go/api/api_rpc"
+	"github.com/BlockLucky/dwg-go/protocol"
+)
+
+const (
+	defaultPageSize = 1000
+	maxPageSize     = 10000
+)
+
+// entityMatcher 预处理后的过滤条件
+type entityMatcher struct {
+	layers map[string]bool
+	types  map[string]bool
+	spaces map[string]bool
+	bbox   *protocol.Bounds
+}
+
+func newEntityMatcher(f *protocol.EntityFilter) *entityMatcher {
+	toSet := func(items []string) map[string]bool {
+		if len(items) == 0 {
+			return nil
+		}
+		set := make(map[string]bool, len(items))
+		for _, item := range items {
+			set[strings.ToUpper(item)] = true
+		}
+		return set
+	}
+	return &entityMatcher{
+		layers: toSet(f.Layers),
+		types:  toSet(f.Types),
+		spaces: toSet(f.Spaces),
+		bbox:   f.BBox,
+	}
+}
+
+func (m *entityMatcher) match(e *protocol.Entity) bool {
+	if m.layers != nil && !m.layers[strings.ToUpper(e.Layer)] {
+		return false
+	}
+	if m.types != nil && !m.types[strings.ToUpper(e.Type)] {
+		return false
+	}
+	if m.spaces != nil && !m.spaces[strings.ToUpper(e.Space)] {
+		return false
+	}
+	if m.bbox != nil {
+		// 与查询范围相交即命中，没有几何范围的实体不参与范围查询
+		b := e.Bounds
+		if b == nil || b.Max.X < m.bbox.Min.X || b.Min.X > m.bbox.Max.X ||
+			b.Max.Y < m.bbox.Min.Y || b.Min.Y > m.bbox.Max.Y {
+			return false
+		}
+	}
+	return true
+}
+
+// 游标记录下一次扫描的对象下标与对象总数，总数不一致说明游标不属于这份图纸
+func encodeCursor(index, total int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d:%d", index, total)))
+}
+
+func decodeCursor(cursor string, total int) (int, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, errors.New("invalid cursor")
+	}
+	var index, n int
+	if _, err = fmt.Sscanf(string(raw), "%d:%d", &index, &n); err != nil || n != total || index < 0 || index > total {
+		return 0, errors.New("invalid cursor")
+	}
+	return index, nil
+}
+
+// entityPage 从游标位置扫描，返回一页命中的实体与下一页游标，调用方须持有 dwgLock
+func (d *drawing) entityPage(ctx context.Context, p *protocol.EntitiesParams) (*protocol.EntitiesResult, error) {
+	total := d.numObjects()
+	start, err := decodeCursor(p.Cursor, total)
+	if err != nil {
+		return nil, err
+	}
+	result, next, err := d.scanPage(ctx, start, p)
+	if err != nil {
+		return nil, err
+	}
+	if next > 0 {
+		result.NextCursor = encodeCursor(next, total)
+	}
+	return result, nil
+}
+
+// scanPage 从第 start 个对象开始扫描一页命中的实体，返回下一页开始的下标，已到最后一页时为 0
+func (d *drawing) scanPage(ctx context.Context, start int, p *protocol.EntitiesParams) (*protocol.EntitiesResult, int, error) {
+	size := p.PageSize
+	if size <= 0 {
+		size = defaultPageSize
+	}
+	if size > maxPageSize {
+		size = maxPageSize
+	}
+
+	total := d.numObjects()
+	matcher := newEntityMatcher(&p.Filter)
+	result := &protocol.EntitiesResult{Entities: make([]*protocol.Entity, 0, size)}
+	for i := start; i < total; i++ {
+		if i%progressEvery == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, 0, err
+			}
+		}
+		ent := d.entity(i)
+		if ent == nil || !matcher.match(ent) {
+			continue
+		}
+		result.Entities = append(result.Entities, ent)
+		if len(result.Entities) == size {
+			if i+1 < total {
+				return result, i + 1, nil
+			}
+			break
+		}
+	}
+	return result, 0, nil
+}
+
+// withDrawing 传 session 时使用常驻会话，否则临时解析 path；fn 在 dwgLock 保护下执行
+func withDrawing(session, path string, notify api_method.Notifier, fn func(d *drawing) (interface{}, error)) (interface{}, error) {
+	if session != "" {
+		res, release, err := sessions.Acquire(session)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+
+		dwgLock.Lock()
+		defer dwgLock.Unlock()
+		return fn(res.(*sessionDrawing).drawing)
+	}
+
+	if path == "" {
+		return nil, errors.New("session or path is required")
+	}
+
+	dwgLock.Lock()
+	defer dwgLock.Unlock()
+
+	d, err := loadDrawing(path, false, notify)
+	if err != nil {
+		return nil, err
+	}
+	defer d.free()
+	return fn(d)
+}
+
+// methodEntities 分页列出实体；不传 session 时按 path 分页，解析结果在页之间缓存，见 pathPage
+func methodEntities(ctx context.Context, reqModel *api_rpc.RPCRequest, notify api_method.Notifier) (interface{}, error) {
+	var p protocol.EntitiesParams
+	if err := api_method.DecodeParams(reqModel, &p); err != nil {
+		return nil, err
+	}
+	if p.Session == "" && p.Path != "" {
+		return pathPage(ctx, &p, notify)
+	}
+	return withDrawing(p.Session, p.Path, notify, func(d *drawing) (interface{}, error) {
+		return d.entityPage(ctx, &p)
+	})
+}
+
+// methodStream 遍历 Dwg_Data 时逐条以 $/item 通知推送命中的实体，不在内存中拼装结果
+func methodStream(ctx context.Context, reqModel *api_rpc.RPCRequest, notify api_method.Notifier) (interface{}, error) {
+	var p protocol.EntitiesParams
+	if err := api_method.DecodeParams(reqModel, &p); err != nil {
+		return nil, err
+	}
+	return withDrawing(p.Session, p.Path, notify, func(d *drawing) (interface{}, error) {
+		matcher := newEntityMatcher(&p.Filter)
+		result := &protocol.StreamResult{}
+		n := d.numObjects()
+		for i := 0; i < n; i++ {
+			if i%progressEvery == 0 {
+				if err := ctx.Err(); err != nil {
+					return nil, err
+				}
+				progress(notify, "extract", d, i)
+			}
+			if ent := d.entity(i); ent != nil && matcher.match(ent) {
+				notify(protocol.NotifyItem, ent)
+				result.Count++
+			}
+		}
+		return result, nil
+	})
+}
@@ -0,0 +1,172 @@
+package main
+
+/*
+#include <dwg.h>
+*/
+import "C"
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/BlockLucky/dwg-go/api/api_method"
+	"github.com/BlockLucky/dwg-go/api/api_rpc"
+	"github.com/BlockLucky/dwg-go/protocol"
+)
+
+// 对象的 Children 与 ReferencedBy 默认返回的条数
+const defaultObjectLimit = 1000
+
+// 有名称的表项类型
+var tableTypes = map[C.Dwg_Object_Type]bool{
+	C.DWG_TYPE_LAYER:        true,
+	C.DWG_TYPE_LTYPE:        true,
+	C.DWG_TYPE_STYLE:        true,
+	C.DWG_TYPE_DIMSTYLE:     true,
+	C.DWG_TYPE_BLOCK_HEADER: true,
+	C.DWG_TYPE_APPID:        true,
+}
+
+// refGraph 引用的反向索引，第一次查询时建立，图纸被修改后由 indexTables 清空
+type refGraph struct {
+	children map[protocol.Handle][]protocol.Handle
+	inbound  map[protocol.Handle][]inboundRef
+}
+
+// inboundRef 指向某个对象的引用，from 为 0 表示头变量
+type inboundRef struct {
+	from protocol.Handle
+	ref  objectRef
+}
+
+func methodDocObject(ctx context.Context, reqModel *api_rpc.RPCRequest, notify api_method.Notifier) (interface{}, error) {
+	var p protocol.ObjectParams
+	if err := api_method.DecodeParams(reqModel, &p); err != nil {
+		return nil, err
+	}
+	return withDrawing(p.Session, "", notify, func(d *drawing) (interface{}, error) {
+		return d.objectNode(ctx, p.Handle, p.Limit)
+	})
+}
+
+// refKind 句柄码对应的引用类别，相对句柄（6、8、0xA、0xC）只用于软指针
+func refKind(code int) protocol.RefKind {
+	switch code {
+	case refSoftOwner:
+		return protocol.RefSoftOwner
+	case refHardOwner:
+		return protocol.RefHardOwner
+	case refHardPointer:
+		return protocol.RefHardPointer
+	default:
+		return protocol.RefSoftPointer
+	}
+}
+
+// buildGraph 返回反向索引，没有时遍历全部对象建立
+func (d *drawing) buildGraph(ctx context.Context) (*refGraph, error) {
+	if d.graph != nil {
+		return d.graph, nil
+	}
+	g := &refGraph{
+		children: make(map[protocol.Handle][]protocol.Handle),
+		inbound:  make(map[protocol.Handle][]inboundRef),
+	}
+	n := d.numObjects()
+	for i := 0; i < n; i++ {
+		if i%progressEvery == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
+		obj := d.object(i)
+		if !d.live(obj) {
+			continue
+		}
+		h := d.handleOf(obj)
+		for _, r := range d.refsFrom(obj) {
+			if r.Field == "owner" {
+				g.children[r.Handle] = append(g.children[r.Handle], h)
+				continue
+			}
+			g.inbound[r.Handle] = append(g.inbound[r.Handle], inboundRef{from: h, ref: r})
+		}
+	}
+	for _, r := range d.headerRefs() {
+		g.inbound[r.Handle] = append(g.inbound[r.Handle], inboundRef{ref: r})
+	}
+	d.graph = g
+	return g, nil
+}
+
+// objectNode 对象及其出入方向的引用，h 为 0 时为命名对象字典
+func (d *drawing) objectNode(ctx context.Context, h protocol.Handle, limit int) (*protocol.Object, error) {
+	if h == 0 {
+		h = refHandle(d.dwg.header_vars.DICTIONARY_NAMED_OBJECT)
+	}
+	obj := d.resolve(h)
+	if obj == nil {
+		return nil, fmt.Errorf("object %X not found", uint64(h))
+	}
+	if limit <= 0 {
+		limit = defaultObjectLimit
+	}
+	g, err := d.buildGraph(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	node := &protocol.Object{
+		Handle:       h,
+		Type:         objectTypeName(obj),
+		Owner:        d.owner(obj),
+		Refs:         make([]*protocol.ObjectRef, 0),
+		Children:     make([]protocol.Handle, 0),
+		ReferencedBy: make([]*protocol.ObjectRef, 0),
+	}
+	if tableTypes[obj.fixedtype] {
+		node.Name = d.tableName(obj)
+	}
+	if d.isEntity(obj) {
+		node.Entity = d.entity(d.handles[h])
+	}
+	for _, r := range d.refsFrom(obj) {
+		if r.Field == "owner" {
+			continue
+		}
+		node.Refs = append(node.Refs, &protocol.ObjectRef{
+			Field:  r.Field,
+			Kind:   refKind(r.Code),
+			Handle: r.Handle,
+			Type:   d.typeName(r.Handle),
+			Name:   r.Name,
+		})
+	}
+
+	children := g.children[h]
+	if len(children) > limit {
+		children, node.Truncated = children[:limit], true
+	}
+	node.Children = append(node.Children, children...)
+
+	inbound := g.inbound[h]
+	if len(inbound) > limit {
+		inbound, node.Truncated = inbound[:limit], true
+	}
+	for _, in := range inbound {
+		ref := &protocol.ObjectRef{Field: in.ref.Field, Kind: refKind(in.ref.Code), Handle: in.from, Type: "header"}
+		if in.from != 0 {
+			ref.Type = d.typeName(in.from)
+		}
+		node.ReferencedBy = append(node.ReferencedBy, ref)
+	}
+	return node, nil
+}
+
+// typeName 句柄对应对象的类型名，对象不存在时为空
+func (d *drawing) typeName(h protocol.Handle) string {
+	if obj := d.resolve(h); obj != nil {
+		return objectTypeName(obj)
+	}
+	return ""
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/BlockLucky/dwg-go/api/api_config"
+	"github.com/BlockLucky/dwg-go/api/api_method"
+	"github.com/BlockLucky/dwg-go/api/api_rpc"
+	"github.com/BlockLucky/dwg-go/config"
+	"github.com/BlockLucky/dwg-go/protocol"
+)
+
+// dwg.read 可读取与 dwg.convert 可写出的格式，以及 LibreDWG 能写出的 DWG 版本
+var (
+	inputFormats  = []string{"dwg", "dxf"}
+	outputFormats = []string{"dwg", "dxf", "json"}
+	writeReleases = []string{"r13", "r14", "r2000"}
+)
+
+// 方法与能力的对应关系，方法可用时具备该能力
+var methodCapabilities = map[string]protocol.Capability{
+	protocol.MethodRead:           protocol.CapRecover,
+	protocol.MethodDocOpen:        protocol.CapSessions,
+	protocol.MethodStream:         protocol.CapStream,
+	protocol.MethodJobSubmit:      protocol.CapJobs,
+	protocol.MethodPoolStats:      protocol.CapPool,
+	protocol.MethodQuarantineList: protocol.CapQuarantine,
+}
+
+func registerHello() {
+	api_method.RegisterMethod(protocol.MethodHello, methodHello)
+}
+
+// methodHello 返回服务版本、协议版本与当前连接上可用的方法；客户端协议版本不兼容时返回 incompatible_protocol
+func methodHello(ctx context.Context, reqModel *api_rpc.RPCRequest, notify api_method.Notifier) (interface{}, error) {
+	var p protocol.HelloParams
+	if len(reqModel.Params) > 0 {
+		if err := api_method.DecodeParams(reqModel, &p); err != nil {
+			return nil, err
+		}
+	}
+	if p.ProtocolVersion > 0 {
+		if err := protocol.CheckVersion(p.MinProtocolVersion, p.ProtocolVersion); err != nil {
+			return nil, &api_rpc.RPCError{
+				Code:    api_rpc.ErrCodeIncompatible,
+				Message: fmt.Sprintf("dwg_service %s: %v", config.ProjectVersion, err),
+			}
+		}
+	}
+
+	// 只有经由 stdio 帧传输的调用能携带二进制数据，HTTP 调用还受 api_methods_allowed 限制
+	stdio := protocol.BlobSinkFrom(ctx) != nil
+	result := &protocol.HelloResult{
+		ServiceVersion:     config.ProjectVersion,
+		ProtocolVersion:    protocol.Version,
+		MinProtocolVersion: protocol.MinVersion,
+		LibreDWGVersion:    libredwgVersion,
+		LibreDWGCommit:     libredwgCommit,
+		Methods:            []string{},
+		InputFormats:       inputFormats,
+		OutputFormats:      outputFormats,
+		Releases:           writeReleases,
+		Capabilities:       []protocol.Capability{},
+	}
+	if stdio {
+		result.Capabilities = append(result.Capabilities, protocol.CapBlobs)
+	}
+	for _, name := range api_method.Methods() {
+		if name == protocol.MethodWorkerStats {
+			continue
+		}
+		if !stdio && api_config.CurrentApiConfig != nil && !api_config.CheckAllowedMethods(name) {
+			continue
+		}
+		result.Methods = append(result.Methods, name)
+		if c, ok := methodCapabilities[name]; ok {
+			result.Capabilities = append(result.Capabilities, c)
+		}
+	}
+	return result, nil
+}
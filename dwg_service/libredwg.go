@@ -0,0 +1,556 @@
+package main
+
+/*
+#include <stdlib.h>
+#include <string.h>
+#include <dwg.h>
+#include <dwg_api.h>
+
+static Dwg_Data *dwgo_new(void) { return (Dwg_Data *)calloc(1, sizeof(Dwg_Data)); }
+static Dwg_Object *dwgo_object(Dwg_Data *dwg, BITCODE_BL i) { return &dwg->object[i]; }
+// 恢复模式下解码失败的对象可能只分配了外层结构，内层数据为空时按未解码处理
+static int dwgo_is_entity(Dwg_Object *o) { return o->supertype == DWG_SUPERTYPE_ENTITY && o->tio.entity != NULL && o->tio.entity->tio.LINE != NULL; }
+static int dwgo_is_object(Dwg_Object *o) { return o->supertype == DWG_SUPERTYPE_OBJECT && o->tio.object != NULL && o->tio.object->tio.LAYER != NULL; }
+static Dwg_Object_Entity *dwgo_entity(Dwg_Object *o) { return o->tio.entity; }
+static unsigned long dwgo_ref(BITCODE_H ref) { return ref ? ref->absolute_ref : 0; }
+
+// 所有表项共享 COMMON_TABLE_FLAGS 前缀，可统一按 LAYER 读取 name
+static BITCODE_T dwgo_table_name(Dwg_Object *o) { return o->tio.object->tio.LAYER->name; }
+
+static Dwg_Object_LAYER *dwgo_layer(Dwg_Object *o) { return o->tio.object->tio.LAYER; }
+static Dwg_Object_BLOCK_HEADER *dwgo_block_header(Dwg_Object *o) { return o->tio.object->tio.BLOCK_HEADER; }
+static Dwg_Entity_LINE *dwgo_line(Dwg_Object *o) { return o->tio.entity->tio.LINE; }
+static Dwg_Entity_CIRCLE *dwgo_circle(Dwg_Object *o) { return o->tio.entity->tio.CIRCLE; }
+static Dwg_Entity_ARC *dwgo_arc(Dwg_Object *o) { return o->tio.entity->tio.ARC; }
+static Dwg_Entity_POINT *dwgo_point(Dwg_Object *o) { return o->tio.entity->tio.POINT; }
+static Dwg_Entity_TEXT *dwgo_text(Dwg_Object *o) { return o->tio.entity->tio.TEXT; }
+static Dwg_Entity_MTEXT *dwgo_mtext(Dwg_Object *o) { return o->tio.entity->tio.MTEXT; }
+static Dwg_Entity_INSERT *dwgo_insert(Dwg_Object *o) { return o->tio.entity->tio.INSERT; }
+static Dwg_Entity_LWPOLYLINE *dwgo_lwpolyline(Dwg_Object *o) { return o->tio.entity->tio.LWPOLYLINE; }
+static BITCODE_2RD dwgo_2rd_at(BITCODE_2RD *pts, BITCODE_BL i) { return pts[i]; }
+*/
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unicode/utf16"
+	"unsafe"
+
+	"github.com/BlockLucky/dwg-go/protocol"
+)
+
+// LibreDWG 存在全局状态，非线程安全，所有调用必须串行
+var dwgLock sync.Mutex
+
+// libredwgCommit/libredwgVersion 构建时的 LibreDWG 提交与版本，由 build_libredwg 生成的 cgo 文件设置
+var (
+	libredwgCommit  = "unknown"
+	libredwgVersion = "unknown"
+)
+
+// drawing 一份已解析的图纸，调用方持有 dwgLock 期间才能访问
+type drawing struct {
+	path     string
+	size     int64
+	dwg      *C.Dwg_Data
+	layers   map[protocol.Handle]string
+	blocks   map[protocol.Handle]string
+	handles  map[protocol.Handle]int
+	graph    *refGraph
+	modelBlk protocol.Handle
+	paperBlk protocol.Handle
+	warnings []*protocol.Warning
+	// parked 编辑删除后保留数据、可以撤销的对象，按删除操作的句柄分组
+	parked map[protocol.Handle][]*parkedObject
+}
+
+// openDrawing 读取 DWG/DXF 文件，调用方须持有 dwgLock。recover 为 true 时只要 LibreDWG
+// 解码出了对象就不因严重错误失败，错误码与未解码的对象记录在 warnings 中
+func openDrawing(path string, recover bool) (*drawing, error) {
+	st, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	dxf := strings.EqualFold(filepath.Ext(path), ".dxf")
+	if !dxf {
+		if err = checkDWGHeader(path); err != nil {
+			return nil, err
+		}
+	}
+
+	cPath := C.CString(path)
+	defer C.free(unsafe.Pointer(cPath))
+
+	dwg := C.dwgo_new()
+	if dwg == nil {
+		return nil, errors.New("out of memory")
+	}
+
+	var code C.int
+	if dxf {
+		code = C.dxf_read_file(cPath, dwg)
+	} else {
+		code = C.dwg_read_file(cPath, dwg)
+	}
+	salvage := recover && int(code)&(dwgErrIO|dwgErrOutOfMem) == 0 && dwg.num_objects > 0
+	if code >= C.DWG_ERR_CRITICAL && !salvage {
+		C.dwg_free(dwg)
+		C.free(unsafe.Pointer(dwg))
+		return nil, readError(path, dxf, int(code))
+	}
+
+	d := &drawing{
+		path: path,
+		size: st.Size(),
+		dwg:  dwg,
+	}
+	d.indexTables()
+	if recover {
+		d.warnings = append(readWarnings(path, dxf, int(code)), d.objectWarnings()...)
+	}
+	return d, nil
+}
+
+// 新图纸必须有的表项
+var standardEntries = []struct {
+	fixedtype C.Dwg_Object_Type
+	name      string
+}{
+	{C.DWG_TYPE_LAYER, "0"},
+	{C.DWG_TYPE_LTYPE, "CONTINUOUS"},
+	{C.DWG_TYPE_LTYPE, "BYLAYER"},
+	{C.DWG_TYPE_LTYPE, "BYBLOCK"},
+	{C.DWG_TYPE_STYLE, "STANDARD"},
+	{C.DWG_TYPE_DIMSTYLE, "STANDARD"},
+	{C.DWG_TYPE_BLOCK_HEADER, "*MODEL_SPACE"},
+	{C.DWG_TYPE_BLOCK_HEADER, "*PAPER_SPACE"},
+}
+
+// newDrawing 新建只含标准表的空图纸，调用方须持有 dwgLock。release 须为可写出的版本，
+// 空时为 r2000
+func newDrawing(release string, imperial bool) (*drawing, error) {
+	if release == "" {
+		release = "r2000"
+	}
+	var version C.Dwg_Version_Type = C.R_INVALID
+	for _, r := range writeReleases {
+		if strings.EqualFold(r, release) {
+			cRelease := C.CString(r)
+			version = C.dwg_version_as(cRelease)
+			C.free(unsafe.Pointer(cRelease))
+		}
+	}
+	if version == C.R_INVALID {
+		return nil, &protocol.UnsupportedVersionError{Version: release}
+	}
+
+	dwg := C.dwg_add_Document(version, C.int(cBool(imperial)), 0)
+	if dwg == nil {
+		return nil, errors.New("libredwg could not create a drawing")
+	}
+	d := &drawing{dwg: dwg}
+	d.indexTables()
+
+	var missing []string
+	for _, e := range standardEntries {
+		if d.tableEntry(e.fixedtype, e.name) == nil {
+			missing = append(missing, e.name)
+		}
+	}
+	if refHandle(dwg.header_vars.DICTIONARY_NAMED_OBJECT) == 0 {
+		missing = append(missing, "named object dictionary")
+	}
+	if len(missing) > 0 {
+		d.free()
+		return nil, fmt.Errorf("libredwg created a drawing without %s", strings.Join(missing, ", "))
+	}
+	return d, nil
+}
+
+// objectWarnings 列出 LibreDWG 没有解码的对象：未知类型，或解码失败只留下对象记录
+func (d *drawing) objectWarnings() []*protocol.Warning {
+	var out []*protocol.Warning
+	n := d.numObjects()
+	for i := 0; i < n; i++ {
+		obj := d.object(i)
+		var msg string
+		switch {
+		case obj.fixedtype == C.DWG_TYPE_UNKNOWN_ENT || obj.fixedtype == C.DWG_TYPE_UNKNOWN_OBJ:
+			msg = "unknown or damaged object, not decoded"
+		case C.dwgo_is_entity(obj) == 0 && C.dwgo_is_object(obj) == 0:
+			msg = fmt.Sprintf("failed to decode %d bytes at 0x%x", uint32(obj.size), uint64(obj.address))
+		default:
+			continue
+		}
+		out = append(out, &protocol.Warning{
+			Handle:  protocol.Handle(obj.handle.value),
+			Type:    objectTypeName(obj),
+			Section: "objects",
+			Message: msg,
+		})
+	}
+	return out
+}
+
+// objectTypeName 对象的类型名，未知对象优先取类定义中的 DXF 名称
+func objectTypeName(obj *C.Dwg_Object) string {
+	if obj.dxfname != nil {
+		return C.GoString(obj.dxfname)
+	}
+	if obj.name != nil {
+		return C.GoString(obj.name)
+	}
+	return fmt.Sprintf("type %d", uint(obj._type))
+}
+
+// free 释放 LibreDWG 内存，调用方须持有 dwgLock
+func (d *drawing) free() {
+	if d.dwg == nil {
+		return
+	}
+	d.dropAllParked()
+	C.dwg_free(d.dwg)
+	C.free(unsafe.Pointer(d.dwg))
+	d.dwg = nil
+}
+
+func (d *drawing) numObjects() int {
+	return int(d.dwg.num_objects)
+}
+
+func (d *drawing) object(i int) *C.Dwg_Object {
+	return C.dwgo_object(d.dwg, C.BITCODE_BL(i))
+}
+
+// text 将 LibreDWG 字符串转为 UTF-8，R2007 及以上版本为 UTF-16LE
+func (d *drawing) text(s C.BITCODE_T) string {
+	if s == nil {
+		return ""
+	}
+	if d.dwg.header.from_version < C.R_2007 {
+		return C.GoString((*C.char)(unsafe.Pointer(s)))
+	}
+
+	var units []uint16
+	for p := unsafe.Pointer(s); *(*uint16)(p) != 0; p = unsafe.Add(p, 2) {
+		units = append(units, *(*uint16)(p))
+	}
+	return string(utf16.Decode(units))
+}
+
+// indexTables 建立句柄、图层与块的索引，图纸被修改后须重新调用
+func (d *drawing) indexTables() {
+	d.layers = make(map[protocol.Handle]string)
+	d.blocks = make(map[protocol.Handle]string)
+	d.handles = make(map[protocol.Handle]int)
+	d.graph = nil
+	d.modelBlk, d.paperBlk = 0, 0
+
+	n := d.numObjects()
+	for i := 0; i < n; i++ {
+		d.indexObject(i)
+	}
+}
+
+// indexObject 将第 i 个对象加入索引，新建对象后调用
+func (d *drawing) indexObject(i int) {
+	obj := d.object(i)
+	if d.live(obj) {
+		if _, dup := d.handles[protocol.Handle(obj.handle.value)]; !dup {
+			d.handles[protocol.Handle(obj.handle.value)] = i
+		}
+	}
+	if C.dwgo_is_object(obj) == 0 {
+		return
+	}
+	switch obj.fixedtype {
+	case C.DWG_TYPE_LAYER:
+		d.layers[protocol.Handle(obj.handle.value)] = d.text(C.dwgo_table_name(obj))
+	case C.DWG_TYPE_BLOCK_HEADER:
+		name := d.text(C.dwgo_table_name(obj))
+		handle := protocol.Handle(obj.handle.value)
+		d.blocks[handle] = name
+		switch strings.ToUpper(name) {
+		case "*MODEL_SPACE":
+			d.modelBlk = handle
+		case "*PAPER_SPACE":
+			d.paperBlk = handle
+		}
+	}
+}
+
+// refHandle 引用指向的句柄，空引用为 0
+func refHandle(ref C.BITCODE_H) protocol.Handle {
+	return protocol.Handle(C.dwgo_ref(ref))
+}
+
+// live 对象已解码且未被删除
+func (d *drawing) live(obj *C.Dwg_Object) bool {
+	return obj.fixedtype != C.DWG_TYPE_FREED && (C.dwgo_is_entity(obj) != 0 || C.dwgo_is_object(obj) != 0)
+}
+
+// resolve 按句柄查找已解码的对象，不存在时返回 nil
+func (d *drawing) resolve(h protocol.Handle) *C.Dwg_Object {
+	i, ok := d.handles[h]
+	if !ok {
+		return nil
+	}
+	return d.object(i)
+}
+
+// resolveType 按句柄查找指定类型的对象
+func (d *drawing) resolveType(h protocol.Handle, fixedtype C.Dwg_Object_Type) *C.Dwg_Object {
+	if obj := d.resolve(h); obj != nil && obj.fixedtype == fixedtype {
+		return obj
+	}
+	return nil
+}
+
+// tableName 表项的名称
+func (d *drawing) tableName(obj *C.Dwg_Object) string {
+	return d.text(C.dwgo_table_name(obj))
+}
+
+// tableEntry 按名称（不区分大小写）查找表项
+func (d *drawing) tableEntry(fixedtype C.Dwg_Object_Type, name string) *C.Dwg_Object {
+	n := d.numObjects()
+	for i := 0; i < n; i++ {
+		obj := d.object(i)
+		if obj.fixedtype == fixedtype && C.dwgo_is_object(obj) != 0 && strings.EqualFold(d.tableName(obj), name) {
+			return obj
+		}
+	}
+	return nil
+}
+
+func (d *drawing) header() *protocol.Header {
+	vars := &d.dwg.header_vars
+	return &protocol.Header{
+		Version:    C.GoString(C.dwg_version_type(d.dwg.header.from_version)),
+		CodePage:   int(d.dwg.header.codepage),
+		InsUnits:   int(vars.INSUNITS),
+		HandSeed:   protocol.Handle(C.dwgo_ref(vars.HANDSEED)),
+		ExtMin:     point3(vars.EXTMIN),
+		ExtMax:     point3(vars.EXTMAX),
+		NumObjects: d.numObjects(),
+	}
+}
+
+func (d *drawing) layerList() []*protocol.Layer {
+	var out []*protocol.Layer
+	n := d.numObjects()
+	for i := 0; i < n; i++ {
+		obj := d.object(i)
+		if obj.fixedtype != C.DWG_TYPE_LAYER || C.dwgo_is_object(obj) == 0 {
+			continue
+		}
+		if layer := d.layerOf(obj); layer != nil {
+			out = append(out, layer)
+		}
+	}
+	return out
+}
+
+// layerOf 图层表项的信息
+func (d *drawing) layerOf(obj *C.Dwg_Object) *protocol.Layer {
+	layer := C.dwgo_layer(obj)
+	if layer == nil {
+		return nil
+	}
+	// 颜色号为负表示图层关闭
+	color, off := int(layer.color.index), false
+	if color < 0 {
+		color, off = -color, true
+	}
+	return &protocol.Layer{
+		Handle: protocol.Handle(obj.handle.value),
+		Name:   d.text(layer.name),
+		Color:  color,
+		Off:    off,
+		Frozen: layer.flag&1 != 0,
+		Locked: layer.flag&4 != 0,
+	}
+}
+
+func (d *drawing) blockList() []*protocol.Block {
+	var out []*protocol.Block
+	n := d.numObjects()
+	for i := 0; i < n; i++ {
+		obj := d.object(i)
+		if obj.fixedtype != C.DWG_TYPE_BLOCK_HEADER || C.dwgo_is_object(obj) == 0 {
+			continue
+		}
+		if blk := d.blockOf(obj); blk != nil {
+			out = append(out, blk)
+		}
+	}
+	return out
+}
+
+// blockOf 块定义的信息
+func (d *drawing) blockOf(obj *C.Dwg_Object) *protocol.Block {
+	blk := C.dwgo_block_header(obj)
+	if blk == nil {
+		return nil
+	}
+	return &protocol.Block{
+		Handle:      protocol.Handle(obj.handle.value),
+		Name:        d.text(blk.name),
+		BasePoint:   point3(blk.base_pt),
+		NumEntities: int(blk.num_owned),
+	}
+}
+
+// entity 提取第 i 个对象的实体信息，非实体返回 nil
+func (d *drawing) entity(i int) *protocol.Entity {
+	obj := d.object(i)
+	if C.dwgo_is_entity(obj) == 0 {
+		return nil
+	}
+	ent := C.dwgo_entity(obj)
+
+	info := &protocol.Entity{
+		Handle: protocol.Handle(obj.handle.value),
+		Type:   C.GoString(obj.name),
+		Layer:  d.layers[protocol.Handle(C.dwgo_ref(ent.layer))],
+		Owner:  protocol.Handle(C.dwgo_ref(ent.ownerhandle)),
+		Color:  int(ent.color.index),
+	}
+
+	switch {
+	case ent.entmode == 2 || (info.Owner != 0 && info.Owner == d.modelBlk):
+		info.Space = protocol.SpaceModel
+	case ent.entmode == 1 || (info.Owner != 0 && info.Owner == d.paperBlk):
+		info.Space = protocol.SpacePaper
+	default:
+		info.Space = protocol.SpaceBlock
+		info.Block = d.blocks[info.Owner]
+	}
+
+	switch obj.fixedtype {
+	case C.DWG_TYPE_LINE:
+		line := C.dwgo_line(obj)
+		info.Points = []protocol.Point{point3(line.start), point3(line.end)}
+	case C.DWG_TYPE_CIRCLE:
+		circle := C.dwgo_circle(obj)
+		center := point3(circle.center)
+		info.Center = &center
+		info.Radius = float64(circle.radius)
+	case C.DWG_TYPE_ARC:
+		arc := C.dwgo_arc(obj)
+		center := point3(arc.center)
+		info.Center = &center
+		info.Radius = float64(arc.radius)
+		info.StartAngle = float64(arc.start_angle)
+		info.EndAngle = float64(arc.end_angle)
+	case C.DWG_TYPE_POINT:
+		pt := C.dwgo_point(obj)
+		info.Points = []protocol.Point{{X: float64(pt.x), Y: float64(pt.y), Z: float64(pt.z)}}
+	case C.DWG_TYPE_TEXT:
+		text := C.dwgo_text(obj)
+		info.Points = []protocol.Point{{X: float64(text.ins_pt.x), Y: float64(text.ins_pt.y), Z: float64(text.elevation)}}
+		info.Text = d.text(text.text_value)
+		info.Height = float64(text.height)
+		info.Rotation = float64(text.rotation)
+	case C.DWG_TYPE_MTEXT:
+		mtext := C.dwgo_mtext(obj)
+		info.Points = []protocol.Point{point3(mtext.ins_pt)}
+		info.Text = d.text(mtext.text)
+		info.Height = float64(mtext.text_height)
+	case C.DWG_TYPE_INSERT:
+		insert := C.dwgo_insert(obj)
+		scale := point3(insert.scale)
+		info.Points = []protocol.Point{point3(insert.ins_pt)}
+		info.Scale = &scale
+		info.Rotation = float64(insert.rotation)
+		info.Name = d.blocks[protocol.Handle(C.dwgo_ref(insert.block_header))]
+	case C.DWG_TYPE_LWPOLYLINE:
+		pline := C.dwgo_lwpolyline(obj)
+		for j := C.BITCODE_BL(0); j < pline.num_points; j++ {
+			pt := C.dwgo_2rd_at(pline.points, j)
+			info.Points = append(info.Points, protocol.Point{X: float64(pt.x), Y: float64(pt.y), Z: float64(pline.elevation)})
+		}
+		// LibreDWG 中 LWPOLYLINE 的闭合标志位为 512
+		info.Closed = pline.flag&512 != 0
+	}
+
+	info.Bounds = entityBounds(info)
+	return info
+}
+
+// setRelease 设置写出的版本，release 为空时不变
+func (d *drawing) setRelease(release string) error {
+	if release == "" {
+		return nil
+	}
+	cRelease := C.CString(release)
+	defer C.free(unsafe.Pointer(cRelease))
+	version := C.dwg_version_as(cRelease)
+	if version == C.R_INVALID {
+		return &protocol.UnsupportedVersionError{Version: release}
+	}
+	d.dwg.header.version = version
+	return nil
+}
+
+// write 以指定版本写出 DWG，release 为空时保持 LibreDWG 默认版本
+func (d *drawing) write(path string, release string) error {
+	if err := d.setRelease(release); err != nil {
+		return err
+	}
+
+	cPath := C.CString(path)
+	defer C.free(unsafe.Pointer(cPath))
+	if code := C.dwg_write_file(cPath, d.dwg); code >= C.DWG_ERR_CRITICAL {
+		return fmt.Errorf("libredwg write %s failed: error 0x%x", path, int(code))
+	}
+	return nil
+}
+
+// writeDXF 写出 DXF，版本为图纸当前的版本
+func (d *drawing) writeDXF(path string) error {
+	cPath := C.CString(path)
+	defer C.free(unsafe.Pointer(cPath))
+	if code := C.dxf_write_file(cPath, d.dwg); code >= C.DWG_ERR_CRITICAL {
+		return fmt.Errorf("libredwg write %s failed: error 0x%x", path, int(code))
+	}
+	return nil
+}
+
+func point3(p C.BITCODE_3BD) protocol.Point {
+	return protocol.Point{X: float64(p.x), Y: float64(p.y), Z: float64(p.z)}
+}
+
+// entityBounds 按几何数据计算包围盒，无几何信息时返回 nil
+func entityBounds(e *protocol.Entity) *protocol.Bounds {
+	var pts []protocol.Point
+	pts = append(pts, e.Points...)
+	if e.Center != nil {
+		c := *e.Center
+		pts = append(pts,
+			protocol.Point{X: c.X - e.Radius, Y: c.Y - e.Radius, Z: c.Z},
+			protocol.Point{X: c.X + e.Radius, Y: c.Y + e.Radius, Z: c.Z},
+		)
+	}
+	if len(pts) == 0 {
+		return nil
+	}
+
+	b := &protocol.Bounds{Min: pts[0], Max: pts[0]}
+	for _, p := range pts[1:] {
+		b.Min.X = math.Min(b.Min.X, p.X)
+		b.Min.Y = math.Min(b.Min.Y, p.Y)
+		b.Min.Z = math.Min(b.Min.Z, p.Z)
+		b.Max.X = math.Max(b.Max.X, p.X)
+		b.Max.Y = math.Max(b.Max.Y, p.Y)
+		b.Max.Z = math.Max(b.Max.Z, p.Z)
+	}
+	return b
+}
@@ -1 +1,93 @@
 package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"github.com/BlockLucky/dwg-go/api"
+	"github.com/BlockLucky/dwg-go/api/api_stdio"
+	"github.com/BlockLucky/dwg-go/dwg_service/dwg_service_conf"
+	"github.com/BlockLucky/dwg-go/dwg_service/dwg_service_pool"
+	"github.com/BlockLucky/dwg-go/dwg_service/dwg_service_sandbox"
+)
+
+var (
+	configPath = flag.String("c", "dwg_service.json", "config file path")
+	stdioMode  = flag.Bool("stdio", false, "serve JSON-RPC on stdin/stdout instead of HTTP")
+	workerMode = flag.Bool("worker", false, "run as a pool worker started by the supervisor")
+)
+
+func main() {
+	flag.Parse()
+
+	// rlimit 在读取配置与任何输入之前生效，设置失败时退出，不在没有限制的情况下运行
+	if *workerMode {
+		if err := dwg_service_pool.ApplyRlimits(); err != nil {
+			log.Fatalf("apply worker rlimits failed: %v", err)
+		}
+	}
+
+	cfg, err := dwg_service_conf.LoadConfig(*configPath)
+	if err != nil {
+		log.Fatalf("load config %s failed: %v", *configPath, err)
+	}
+	dwg_service_conf.CurrentServiceConfig = cfg
+
+	// 配置了 worker 时本进程只做转发，LibreDWG 在 worker 进程中运行
+	if cfg.Pool.Workers > 0 && !*workerMode {
+		if err = initPool(&cfg.Pool, &cfg.Quarantine, *configPath); err != nil {
+			log.Fatalf("start worker pool failed: %v", err)
+		}
+		defer pool.Close()
+	} else {
+		if !*workerMode && !*stdioMode {
+			// 默认不启用进程池，LibreDWG 在 HTTP 服务进程内崩溃会导致整个服务退出
+			log.Printf("warning: pool.workers is 0, LibreDWG runs in the service process and a crash stops the service; set pool.workers to isolate it")
+		}
+		if cfg.Sandbox.Enabled && (*workerMode || *stdioMode) {
+			enterSandbox(&cfg.Sandbox)
+		}
+		registerMethods()
+		initSessions(&cfg.Session)
+		registerWorkerStats()
+	}
+	registerHello()
+
+	// stdio 模式下 stdout 专用于协议，日志只能写 stderr
+	if *stdioMode || *workerMode {
+		if err = api_stdio.Serve(os.Stdin, os.Stdout); err != nil {
+			log.Printf("stdio serve failed: %v", err)
+		}
+		return
+	}
+
+	if !cfg.Api.Enabled {
+		log.Fatalf("api is disabled, nothing to serve")
+	}
+	api.StartAPIService(&cfg.Api)
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	<-sig
+}
+
+// enterSandbox 限制本进程只能访问配置的目录；第一次调用会重新 exec，config 文件需要在 exec 后再次读取
+func enterSandbox(cfg *dwg_service_conf.SandboxConfig) {
+	readPaths := cfg.ReadPaths
+	if abs, err := filepath.Abs(*configPath); err == nil {
+		readPaths = append(readPaths, abs)
+	}
+	err := dwg_service_sandbox.Enter(&dwg_service_sandbox.Config{
+		ReadPaths:  readPaths,
+		WritePaths: cfg.WritePaths,
+		UID:        cfg.UID,
+		GID:        cfg.GID,
+	})
+	if err != nil {
+		log.Fatalf("enter sandbox failed: %v", err)
+	}
+}
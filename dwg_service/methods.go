@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BlockLucky/dwg-go/api/api_job"
+	"github.com/BlockLucky/dwg-go/api/api_method"
+	"github.com/BlockLucky/dwg-go/api/api_rpc"
+	"github.com/BlockLucky/dwg-go/protocol"
+)
+
+// 提取实体时每处理多少个对象上报一次进度
+const progressEvery = 2000
+
+func registerMethods() {
+	api_method.RegisterMethod(protocol.MethodRead, methodRead)
+	api_method.RegisterMethod(protocol.MethodConvert, methodConvert)
+	api_method.RegisterMethod(protocol.MethodEntities, methodEntities)
+	api_method.RegisterMethod(protocol.MethodStream, methodStream)
+	api_method.RegisterMethod(protocol.MethodAudit, methodAudit)
+}
+
+// progress 上报阶段进度。LibreDWG 一次读完整个文件，不提供读取的字节数，进度只按对象计算
+func progress(notify api_method.Notifier, stage string, d *drawing, decoded int) {
+	ev := api_job.Event{Type: api_job.EventProgress, Stage: stage}
+	if d != nil {
+		ev.ObjectsDecoded = int64(decoded)
+		ev.ObjectsTotal = int64(d.numObjects())
+	}
+	notify(api_job.NotifyProgress, ev)
+}
+
+// loadDrawing 读取图纸并上报 open/decode 阶段，调用方须持有 dwgLock
+func loadDrawing(path string, recover bool, notify api_method.Notifier) (*drawing, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	notify(api_job.NotifyProgress, api_job.Event{Type: api_job.EventProgress, Stage: "decode"})
+
+	d, err := openDrawing(path, recover)
+	if err != nil {
+		return nil, err
+	}
+	progress(notify, "decoded", d, d.numObjects())
+	return d, nil
+}
+
+func (d *drawing) extract(ctx context.Context, notify api_method.Notifier) (*protocol.Document, error) {
+	entities, err := d.entityList(ctx, notify)
+	if err != nil {
+		return nil, err
+	}
+	return &protocol.Document{
+		Header:   d.header(),
+		Layers:   d.layerList(),
+		Blocks:   d.blockList(),
+		Entities: entities,
+		Warnings: d.warnings,
+	}, nil
+}
+
+// entityList 提取全部实体并上报 extract 阶段进度
+func (d *drawing) entityList(ctx context.Context, notify api_method.Notifier) ([]*protocol.Entity, error) {
+	entities := make([]*protocol.Entity, 0)
+	n := d.numObjects()
+	for i := 0; i < n; i++ {
+		if i%progressEvery == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			progress(notify, "extract", d, i)
+		}
+		if ent := d.entity(i); ent != nil {
+			entities = append(entities, ent)
+		}
+	}
+	progress(notify, "extract", d, n)
+	return entities, nil
+}
+
+func methodRead(ctx context.Context, reqModel *api_rpc.RPCRequest, notify api_method.Notifier) (interface{}, error) {
+	var p protocol.ReadParams
+	if err := api_method.DecodeParams(reqModel, &p); err != nil {
+		return nil, err
+	}
+
+	if p.InputBlob != "" {
+		path, cleanup, err := blobInput(ctx, p.InputBlob)
+		if err != nil {
+			return nil, err
+		}
+		defer cleanup()
+		p.Path = path
+	}
+
+	dwgLock.Lock()
+	defer dwgLock.Unlock()
+
+	d, err := loadDrawing(p.Path, p.Recover, notify)
+	if err != nil {
+		return nil, err
+	}
+	defer d.free()
+
+	return d.extract(ctx, notify)
+}
+
+func methodConvert(ctx context.Context, reqModel *api_rpc.RPCRequest, notify api_method.Notifier) (interface{}, error) {
+	var p protocol.ConvertParams
+	if err := api_method.DecodeParams(reqModel, &p); err != nil {
+		return nil, err
+	}
+	if (p.Input == "" && p.InputBlob == "") || (p.Output == "" && p.OutputBlob == "") {
+		return nil, errors.New("input and output are required")
+	}
+	if p.Format == "" {
+		p.Format = strings.TrimPrefix(strings.ToLower(filepath.Ext(p.Output)), ".")
+	}
+	if p.InputBlob != "" {
+		path, cleanup, err := blobInput(ctx, p.InputBlob)
+		if err != nil {
+			return nil, err
+		}
+		defer cleanup()
+		p.Input = path
+	}
+	if p.OutputBlob != "" {
+		if p.Format == "" {
+			return nil, errors.New("format is required for output_blob")
+		}
+		path, cleanup, err := blobOutput(ctx, p.Format)
+		if err != nil {
+			return nil, err
+		}
+		defer cleanup()
+		p.Output = path
+	}
+
+	dwgLock.Lock()
+	defer dwgLock.Unlock()
+
+	d, err := loadDrawing(p.Input, false, notify)
+	if err != nil {
+		return nil, err
+	}
+	defer d.free()
+
+	switch p.Format {
+	case "dwg":
+		progress(notify, "write", d, d.numObjects())
+		if err = d.write(p.Output, p.Release); err != nil {
+			return nil, err
+		}
+	case "dxf":
+		progress(notify, "write", d, d.numObjects())
+		if err = d.writeDXF(p.Output); err != nil {
+			return nil, err
+		}
+	case "json":
+		result, err := d.extract(ctx, notify)
+		if err != nil {
+			return nil, err
+		}
+		progress(notify, "write", d, d.numObjects())
+		data, err := json.Marshal(result)
+		if err != nil {
+			return nil, err
+		}
+		if err = os.WriteFile(p.Output, data, 0644); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New("unsupported output format: " + p.Format)
+	}
+
+	st, err := os.Stat(p.Output)
+	if err != nil {
+		return nil, err
+	}
+	result := &protocol.ConvertResult{Output: p.Output, Format: p.Format, Size: st.Size()}
+	if p.OutputBlob != "" {
+		if err = attachFile(ctx, p.OutputBlob, p.Output); err != nil {
+			return nil, err
+		}
+		result.Output, result.Blob = "", p.OutputBlob
+	}
+	progress(notify, "done", d, d.numObjects())
+	return result, nil
+}
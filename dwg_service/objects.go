@@ -0,0 +1,423 @@
+package main
+
+/*
+#include <stdlib.h>
+#include <string.h>
+#include <dwg.h>
+
+static int dwgo_is_entity_type(Dwg_Object *o) { return o->supertype == DWG_SUPERTYPE_ENTITY; }
+
+static BITCODE_H *dwgo_owner_slot(Dwg_Object *o) {
+  return o->supertype == DWG_SUPERTYPE_ENTITY ? &o->tio.entity->ownerhandle : &o->tio.object->ownerhandle;
+}
+static BITCODE_H *dwgo_xdic_slot(Dwg_Object *o) {
+  return o->supertype == DWG_SUPERTYPE_ENTITY ? &o->tio.entity->xdicobjhandle : &o->tio.object->xdicobjhandle;
+}
+static BITCODE_BL *dwgo_num_reactors(Dwg_Object *o) {
+  return o->supertype == DWG_SUPERTYPE_ENTITY ? &o->tio.entity->num_reactors : &o->tio.object->num_reactors;
+}
+static BITCODE_H *dwgo_reactors(Dwg_Object *o) {
+  return o->supertype == DWG_SUPERTYPE_ENTITY ? o->tio.entity->reactors : o->tio.object->reactors;
+}
+static void dwgo_set_xdic_missing(Dwg_Object *o, BITCODE_B missing) {
+  if (o->supertype == DWG_SUPERTYPE_ENTITY)
+    o->tio.entity->is_xdic_missing = missing;
+  else
+    o->tio.object->is_xdic_missing = missing;
+}
+static BITCODE_BB dwgo_entmode(Dwg_Object *o) { return o->tio.entity->entmode; }
+static void dwgo_set_entmode(Dwg_Object *o, BITCODE_BB mode) { o->tio.entity->entmode = mode; }
+static BITCODE_H *dwgo_layer_slot(Dwg_Object *o) { return &o->tio.entity->layer; }
+static BITCODE_H *dwgo_ltype_slot(Dwg_Object *o) { return &o->tio.entity->ltype; }
+static BITCODE_H *dwgo_insert_block_slot(Dwg_Object *o) { return &o->tio.entity->tio.INSERT->block_header; }
+static Dwg_Object_BLOCK_HEADER *dwgo_owning_block(Dwg_Object *o) { return o->tio.object->tio.BLOCK_HEADER; }
+// 各表的控制对象结构相同，统一按 LAYER_CONTROL 读取 entries
+static int dwgo_is_control(Dwg_Object *o) {
+  switch (o->fixedtype) {
+  case DWG_TYPE_BLOCK_CONTROL:
+  case DWG_TYPE_LAYER_CONTROL:
+  case DWG_TYPE_STYLE_CONTROL:
+  case DWG_TYPE_LTYPE_CONTROL:
+  case DWG_TYPE_APPID_CONTROL:
+  case DWG_TYPE_DIMSTYLE_CONTROL:
+    return 1;
+  default:
+    return 0;
+  }
+}
+static Dwg_Object_LAYER_CONTROL *dwgo_control(Dwg_Object *o) { return o->tio.object->tio.LAYER_CONTROL; }
+static BITCODE_H dwgo_ref_at(BITCODE_H *refs, BITCODE_BL i) { return refs[i]; }
+static void dwgo_set_ref_at(BITCODE_H *refs, BITCODE_BL i, BITCODE_H ref) { refs[i] = ref; }
+static BITCODE_H *dwgo_ref_slot(BITCODE_H *refs, BITCODE_BL i) { return &refs[i]; }
+static int dwgo_ref_code(BITCODE_H ref) { return ref ? ref->handleref.code : 0; }
+
+// 引用对象可能被多个对象共享（dwg_add_handleref 按 code 与句柄复用），只能替换不能就地修改
+static void dwgo_set_ref(Dwg_Data *dwg, BITCODE_H *slot, BITCODE_RC code, unsigned long value) {
+  *slot = value ? dwg_add_handleref(dwg, code, value, NULL) : NULL;
+}
+
+static void dwgo_set_handle(Dwg_Object *o, unsigned long value) {
+  BITCODE_RC size = 0;
+  while (size < sizeof(value) && (value >> (8 * size)) != 0)
+    size++;
+  o->handle.value = value;
+  o->handle.size = size;
+}
+
+static void dwgo_set_handseed(Dwg_Data *dwg, unsigned long value) {
+  if (dwg->header_vars.HANDSEED) {
+    dwg->header_vars.HANDSEED->handleref.value = value;
+    dwg->header_vars.HANDSEED->absolute_ref = value;
+  } else {
+    dwg->header_vars.HANDSEED = dwg_add_handleref(dwg, 0, value, NULL);
+  }
+}
+
+// 在引用列表的 pos 处插入一个空位，列表由 LibreDWG 用 malloc 分配
+static int dwgo_insert_slot(BITCODE_H **list, BITCODE_BL n, BITCODE_BL pos) {
+  BITCODE_H *l = (BITCODE_H *)realloc(*list, (n + 1) * sizeof(BITCODE_H));
+  if (!l)
+    return -1;
+  memmove(&l[pos + 1], &l[pos], (n - pos) * sizeof(BITCODE_H));
+  l[pos] = NULL;
+  *list = l;
+  return 0;
+}
+
+static void dwgo_erase(Dwg_Object *o) {
+  dwg_free_object(o);
+  o->tio.entity = NULL;
+  o->fixedtype = DWG_TYPE_FREED;
+}
+*/
+import "C"
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/BlockLucky/dwg-go/protocol"
+)
+
+// 引用的句柄码：软所有者、硬所有者、软指针、硬指针
+const (
+	refSoftOwner   = 2
+	refHardOwner   = 3
+	refSoftPointer = 4
+	refHardPointer = 5
+)
+
+// 实体的 entmode：1 图纸空间，2 模型空间，0 由所有者决定
+const (
+	entModePaper = 1
+	entModeModel = 2
+)
+
+// 对象中引用字段的位置，供其它文件读取句柄码
+func ownerSlot(obj *C.Dwg_Object) *C.BITCODE_H { return C.dwgo_owner_slot(obj) }
+func xdicSlot(obj *C.Dwg_Object) *C.BITCODE_H  { return C.dwgo_xdic_slot(obj) }
+func layerSlot(obj *C.Dwg_Object) *C.BITCODE_H { return C.dwgo_layer_slot(obj) }
+func ltypeSlot(obj *C.Dwg_Object) *C.BITCODE_H { return C.dwgo_ltype_slot(obj) }
+
+func reactorList(obj *C.Dwg_Object) (*C.BITCODE_H, C.BITCODE_BL) {
+	return C.dwgo_reactors(obj), *C.dwgo_num_reactors(obj)
+}
+
+func (d *drawing) handleOf(obj *C.Dwg_Object) protocol.Handle {
+	return protocol.Handle(obj.handle.value)
+}
+
+func (d *drawing) isEntity(obj *C.Dwg_Object) bool {
+	return C.dwgo_is_entity_type(obj) != 0
+}
+
+// maxHandle 已使用的最大句柄
+func (d *drawing) maxHandle() protocol.Handle {
+	var last protocol.Handle
+	for h := range d.handles {
+		if h > last {
+			last = h
+		}
+	}
+	return last
+}
+
+func (d *drawing) handseed() protocol.Handle {
+	return refHandle(d.dwg.header_vars.HANDSEED)
+}
+
+func (d *drawing) setHandseed(h protocol.Handle) {
+	C.dwgo_set_handseed(d.dwg, C.ulong(h))
+}
+
+// setHandle 修改对象自身的句柄，调用方随后须重建索引
+func (d *drawing) setHandle(obj *C.Dwg_Object, h protocol.Handle) {
+	C.dwgo_set_handle(obj, C.ulong(h))
+}
+
+func (d *drawing) owner(obj *C.Dwg_Object) protocol.Handle {
+	return refHandle(*C.dwgo_owner_slot(obj))
+}
+
+func (d *drawing) setOwner(obj *C.Dwg_Object, h protocol.Handle) {
+	d.setRef(C.dwgo_owner_slot(obj), refSoftPointer, h)
+}
+
+func (d *drawing) entmode(obj *C.Dwg_Object) int {
+	return int(C.dwgo_entmode(obj))
+}
+
+// moveToModelSpace 将实体归入模型空间
+func (d *drawing) moveToModelSpace(obj *C.Dwg_Object) {
+	d.setOwner(obj, d.modelBlk)
+	C.dwgo_set_entmode(obj, entModeModel)
+}
+
+func (d *drawing) xdic(obj *C.Dwg_Object) protocol.Handle {
+	return refHandle(*C.dwgo_xdic_slot(obj))
+}
+
+// clearXdic 去掉对象的扩展字典
+func (d *drawing) clearXdic(obj *C.Dwg_Object) {
+	d.setRef(C.dwgo_xdic_slot(obj), refHardOwner, 0)
+	C.dwgo_set_xdic_missing(obj, 1)
+}
+
+func (d *drawing) reactors(obj *C.Dwg_Object) []protocol.Handle {
+	n := int(*C.dwgo_num_reactors(obj))
+	refs := C.dwgo_reactors(obj)
+	if refs == nil {
+		return nil
+	}
+	out := make([]protocol.Handle, n)
+	for i := range out {
+		out[i] = refHandle(C.dwgo_ref_at(refs, C.BITCODE_BL(i)))
+	}
+	return out
+}
+
+// keepReactors 只保留 keep 返回 true 的反应器，返回去掉的个数
+func (d *drawing) keepReactors(obj *C.Dwg_Object, keep func(h protocol.Handle) bool) int {
+	num := C.dwgo_num_reactors(obj)
+	refs := C.dwgo_reactors(obj)
+	if refs == nil {
+		return 0
+	}
+	n := C.BITCODE_BL(0)
+	for i := C.BITCODE_BL(0); i < *num; i++ {
+		ref := C.dwgo_ref_at(refs, i)
+		if keep(refHandle(ref)) {
+			C.dwgo_set_ref_at(refs, n, ref)
+			n++
+		}
+	}
+	removed := int(*num - n)
+	*num = n
+	return removed
+}
+
+func (d *drawing) layerRef(obj *C.Dwg_Object) protocol.Handle {
+	return refHandle(*C.dwgo_layer_slot(obj))
+}
+
+func (d *drawing) setLayerRef(obj *C.Dwg_Object, h protocol.Handle) {
+	d.setRef(C.dwgo_layer_slot(obj), refHardPointer, h)
+}
+
+func (d *drawing) ltypeRef(obj *C.Dwg_Object) protocol.Handle {
+	return refHandle(*C.dwgo_ltype_slot(obj))
+}
+
+func (d *drawing) setLtypeRef(obj *C.Dwg_Object, h protocol.Handle) {
+	d.setRef(C.dwgo_ltype_slot(obj), refHardPointer, h)
+}
+
+// insertBlock INSERT 引用的块定义
+func (d *drawing) insertBlock(obj *C.Dwg_Object) protocol.Handle {
+	return refHandle(*C.dwgo_insert_block_slot(obj))
+}
+
+// setRef 将引用改为 h，h 为 0 时清除
+func (d *drawing) setRef(slot *C.BITCODE_H, code int, h protocol.Handle) {
+	C.dwgo_set_ref(d.dwg, slot, C.BITCODE_RC(code), C.ulong(h))
+}
+
+// erase 删除对象：实体从所属块的实体列表中移除，表项从表的控制对象中移除，
+// 然后释放对象数据，对象记录保留为 DWG_TYPE_FREED，写出时跳过
+func (d *drawing) erase(obj *C.Dwg_Object) {
+	h := d.handleOf(obj)
+	d.unlink(obj)
+	C.dwgo_erase(obj)
+	d.unindex(h)
+}
+
+// unindex 从索引中去掉句柄 h
+func (d *drawing) unindex(h protocol.Handle) {
+	delete(d.handles, h)
+	delete(d.layers, h)
+	delete(d.blocks, h)
+}
+
+// unlink 将对象从所属块的实体列表或表的控制对象中去掉，返回原来的位置与句柄码，不在列表中时位置为 -1
+func (d *drawing) unlink(obj *C.Dwg_Object) (int, int) {
+	h := d.handleOf(obj)
+	if d.isEntity(obj) {
+		if blk := d.resolveType(d.owner(obj), C.DWG_TYPE_BLOCK_HEADER); blk != nil {
+			return d.unlinkEntity(blk, h)
+		}
+	} else if ctl := d.resolve(d.owner(obj)); ctl != nil && C.dwgo_is_control(ctl) != 0 {
+		return d.unlinkEntry(ctl, h)
+	}
+	return -1, 0
+}
+
+// link 按 unlink 返回的位置与句柄码将对象放回所属块的实体列表或表的控制对象
+func (d *drawing) link(obj *C.Dwg_Object, pos, code int) error {
+	if pos < 0 {
+		return nil
+	}
+	h, owner := d.handleOf(obj), d.owner(obj)
+	if d.isEntity(obj) {
+		blk := d.resolveType(owner, C.DWG_TYPE_BLOCK_HEADER)
+		if blk == nil {
+			return fmt.Errorf("owner block %X not found", uint64(owner))
+		}
+		return d.linkEntity(blk, h, pos, code)
+	}
+	ctl := d.resolve(owner)
+	if ctl == nil || C.dwgo_is_control(ctl) == 0 {
+		return fmt.Errorf("table control object %X not found", uint64(owner))
+	}
+	return d.linkEntry(ctl, h, pos, code)
+}
+
+// rehandle 将刚新建、尚未加入索引的对象改用句柄 h，并改写所有者列表中的引用
+// 以及以它为所有者的对象（新建块定义的 BLOCK 与 ENDBLK）
+func (d *drawing) rehandle(obj *C.Dwg_Object, h protocol.Handle) {
+	old := d.handleOf(obj)
+	d.setHandle(obj, h)
+	if d.isEntity(obj) {
+		if blk := d.resolveType(d.owner(obj), C.DWG_TYPE_BLOCK_HEADER); blk != nil {
+			if bh := C.dwgo_owning_block(blk); bh != nil {
+				d.relink(bh.entities, bh.num_owned, old, h)
+			}
+		}
+	} else if ctl := d.resolve(d.owner(obj)); ctl != nil && C.dwgo_is_control(ctl) != 0 {
+		if c := C.dwgo_control(ctl); c != nil {
+			d.relink(c.entries, C.BITCODE_BL(c.num_entries), old, h)
+		}
+	}
+	if obj.fixedtype != C.DWG_TYPE_BLOCK_HEADER {
+		return
+	}
+	if bh := C.dwgo_owning_block(obj); bh != nil {
+		for _, ref := range []C.BITCODE_H{bh.block_entity, bh.endblk_entity} {
+			if member := d.resolveAny(refHandle(ref)); member != nil && d.owner(member) == old {
+				d.setOwner(member, h)
+			}
+		}
+	}
+}
+
+// relink 将引用列表中指向 old 的引用改为指向 h，句柄码不变
+func (d *drawing) relink(list *C.BITCODE_H, n C.BITCODE_BL, old, h protocol.Handle) {
+	if list == nil {
+		return
+	}
+	for i := C.BITCODE_BL(0); i < n; i++ {
+		slot := C.dwgo_ref_slot(list, i)
+		if refHandle(*slot) == old {
+			d.setRef(slot, int(C.dwgo_ref_code(*slot)), h)
+		}
+	}
+}
+
+// resolveAny 按句柄查找对象，包括尚未加入索引的新对象
+func (d *drawing) resolveAny(h protocol.Handle) *C.Dwg_Object {
+	if obj := d.resolve(h); obj != nil {
+		return obj
+	}
+	if h == 0 {
+		return nil
+	}
+	n := d.numObjects()
+	for i := n - 1; i >= 0; i-- {
+		if obj := d.object(i); d.live(obj) && d.handleOf(obj) == h {
+			return obj
+		}
+	}
+	return nil
+}
+
+// unlinkEntry 从表的控制对象中去掉 h，返回第一次出现的位置与句柄码，没有时位置为 -1
+func (d *drawing) unlinkEntry(ctl *C.Dwg_Object, h protocol.Handle) (int, int) {
+	c := C.dwgo_control(ctl)
+	if c == nil || c.entries == nil {
+		return -1, 0
+	}
+	pos, code := -1, 0
+	n := C.BITCODE_BS(0)
+	for i := C.BITCODE_BS(0); i < c.num_entries; i++ {
+		ref := C.dwgo_ref_at(c.entries, C.BITCODE_BL(i))
+		if refHandle(ref) != h {
+			C.dwgo_set_ref_at(c.entries, C.BITCODE_BL(n), ref)
+			n++
+		} else if pos < 0 {
+			pos, code = int(i), int(C.dwgo_ref_code(ref))
+		}
+	}
+	c.num_entries = n
+	return pos, code
+}
+
+// linkEntry 在表的控制对象的 pos 处插入 h，pos 超出列表时追加到末尾
+func (d *drawing) linkEntry(ctl *C.Dwg_Object, h protocol.Handle, pos, code int) error {
+	c := C.dwgo_control(ctl)
+	if c == nil {
+		return errors.New("table control object has no data")
+	}
+	n := C.BITCODE_BL(c.num_entries)
+	at := min(C.BITCODE_BL(pos), n)
+	if C.dwgo_insert_slot(&c.entries, n, at) != 0 {
+		return errors.New("out of memory")
+	}
+	c.num_entries++
+	d.setRef(C.dwgo_ref_slot(c.entries, at), code, h)
+	return nil
+}
+
+// unlinkEntity 从块定义的实体列表中去掉 h，返回第一次出现的位置与句柄码，没有时位置为 -1
+func (d *drawing) unlinkEntity(blk *C.Dwg_Object, h protocol.Handle) (int, int) {
+	bh := C.dwgo_owning_block(blk)
+	if bh == nil || bh.entities == nil {
+		return -1, 0
+	}
+	pos, code := -1, 0
+	n := C.BITCODE_BL(0)
+	for i := C.BITCODE_BL(0); i < bh.num_owned; i++ {
+		ref := C.dwgo_ref_at(bh.entities, i)
+		if refHandle(ref) != h {
+			C.dwgo_set_ref_at(bh.entities, n, ref)
+			n++
+		} else if pos < 0 {
+			pos, code = int(i), int(C.dwgo_ref_code(ref))
+		}
+	}
+	bh.num_owned = n
+	return pos, code
+}
+
+// linkEntity 在块定义的实体列表的 pos 处插入 h，pos 超出列表时追加到末尾
+func (d *drawing) linkEntity(blk *C.Dwg_Object, h protocol.Handle, pos, code int) error {
+	bh := C.dwgo_owning_block(blk)
+	if bh == nil {
+		return errors.New("block header has no data")
+	}
+	at := min(C.BITCODE_BL(pos), bh.num_owned)
+	if C.dwgo_insert_slot(&bh.entities, bh.num_owned, at) != 0 {
+		return errors.New("out of memory")
+	}
+	bh.num_owned++
+	d.setRef(C.dwgo_ref_slot(bh.entities, at), code, h)
+	return nil
+}
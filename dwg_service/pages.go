@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/BlockLucky/dwg-go/api/api_method"
+	"github.com/BlockLucky/dwg-go/protocol"
+)
+
+const (
+	// 按 path 分页时解析结果在两页之间保留的时间
+	pageCacheTTL = time.Minute
+	// 每个进程最多缓存的解析结果，超出时释放最久没有使用的
+	pageCacheMax = 2
+)
+
+// errCursorStale 生成游标之后文件已被修改（大小或修改时间变化），需从第一页重新开始
+var errCursorStale = errors.New("invalid cursor: the file changed since the first page")
+
+// fileStamp 文件的大小与修改时间，游标以此确认文件没有变化
+type fileStamp struct {
+	size  int64
+	mtime int64
+}
+
+func statFile(path string) (fileStamp, error) {
+	st, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{}, err
+	}
+	return fileStamp{size: st.Size(), mtime: st.ModTime().UnixNano()}, nil
+}
+
+// pathCursor 按 path 分页的游标：缓存 ID、下一次扫描的下标、对象总数与文件的大小和修改时间
+type pathCursor struct {
+	id    string
+	index int
+	total int
+	stamp fileStamp
+}
+
+func (c *pathCursor) encode() string {
+	raw := fmt.Sprintf("p:%s:%d:%d:%d:%d", c.id, c.index, c.total, c.stamp.size, c.stamp.mtime)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodePathCursor(cursor string) (*pathCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	c := &pathCursor{}
+	var id []byte
+	_, err = fmt.Sscanf(string(raw), "p:%x:%d:%d:%d:%d", &id, &c.index, &c.total, &c.stamp.size, &c.stamp.mtime)
+	if err != nil || len(id) == 0 || c.index < 0 || c.index > c.total {
+		return nil, errors.New("invalid cursor")
+	}
+	c.id = hex.EncodeToString(id)
+	return c, nil
+}
+
+// cachedDrawing 按 path 分页时缓存的解析结果
+type cachedDrawing struct {
+	d        *drawing
+	path     string
+	stamp    fileStamp
+	lastUsed time.Time
+}
+
+// pageCache 按游标缓存的解析结果，调用方须持有 dwgLock
+var pageCache = map[string]*cachedDrawing{}
+
+var pageJanitor sync.Once
+
+// takeCached 取出 id 对应且文件没有变化的解析结果，取出后不再留在缓存中
+func takeCached(id, path string, stamp fileStamp) *drawing {
+	c := pageCache[id]
+	if c == nil {
+		return nil
+	}
+	delete(pageCache, id)
+	if c.path != path || c.stamp != stamp {
+		c.d.free()
+		return nil
+	}
+	return c.d
+}
+
+// putCached 缓存解析结果，超出 pageCacheMax 时释放最久没有使用的
+func putCached(id, path string, stamp fileStamp, d *drawing) {
+	pageCache[id] = &cachedDrawing{d: d, path: path, stamp: stamp, lastUsed: time.Now()}
+	for len(pageCache) > pageCacheMax {
+		var oldest string
+		for key, c := range pageCache {
+			if oldest == "" || c.lastUsed.Before(pageCache[oldest].lastUsed) {
+				oldest = key
+			}
+		}
+		pageCache[oldest].d.free()
+		delete(pageCache, oldest)
+	}
+	pageJanitor.Do(func() {
+		go func() {
+			for range time.Tick(pageCacheTTL / 2) {
+				dwgLock.Lock()
+				expirePages(time.Now())
+				dwgLock.Unlock()
+			}
+		}()
+	})
+}
+
+// expirePages 释放超过 pageCacheTTL 没有使用的解析结果
+func expirePages(now time.Time) {
+	for id, c := range pageCache {
+		if now.Sub(c.lastUsed) > pageCacheTTL {
+			c.d.free()
+			delete(pageCache, id)
+		}
+	}
+}
+
+// pathPage 按 path 分页。第一页解析文件，还有下一页时将解析结果按游标缓存 pageCacheTTL，
+// 后续页直接使用，缓存过期或不在本进程时重新解析；文件的大小或修改时间变化时返回 errCursorStale
+func pathPage(ctx context.Context, p *protocol.EntitiesParams, notify api_method.Notifier) (*protocol.EntitiesResult, error) {
+	dwgLock.Lock()
+	defer dwgLock.Unlock()
+	expirePages(time.Now())
+
+	stamp, err := statFile(p.Path)
+	if err != nil {
+		return nil, err
+	}
+	cursor := &pathCursor{stamp: stamp}
+	if p.Cursor != "" {
+		if cursor, err = decodePathCursor(p.Cursor); err != nil {
+			return nil, err
+		}
+		if cursor.stamp != stamp {
+			return nil, errCursorStale
+		}
+	}
+
+	var d *drawing
+	if cursor.id != "" {
+		d = takeCached(cursor.id, p.Path, stamp)
+	}
+	if d == nil {
+		if d, err = loadDrawing(p.Path, false, notify); err != nil {
+			return nil, err
+		}
+	}
+	if p.Cursor != "" && d.numObjects() != cursor.total {
+		d.free()
+		return nil, errors.New("invalid cursor")
+	}
+
+	result, next, err := d.scanPage(ctx, cursor.index, p)
+	if err != nil || next == 0 {
+		d.free()
+		return result, err
+	}
+	if cursor.id == "" {
+		id := make([]byte, 8)
+		_, _ = rand.Read(id)
+		cursor.id = hex.EncodeToString(id)
+	}
+	cursor.index, cursor.total = next, d.numObjects()
+	putCached(cursor.id, p.Path, stamp, d)
+	result.NextCursor = cursor.encode()
+	return result, nil
+}
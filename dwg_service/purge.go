@@ -0,0 +1,253 @@
+package main
+
+/*
+#include <dwg.h>
+*/
+import "C"
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/BlockLucky/dwg-go/api/api_method"
+	"github.com/BlockLucky/dwg-go/api/api_rpc"
+	"github.com/BlockLucky/dwg-go/protocol"
+)
+
+// purgeTypes 可清理的类别与表项类型
+var purgeTypes = map[protocol.PurgeType]C.Dwg_Object_Type{
+	protocol.PurgeLayers:     C.DWG_TYPE_LAYER,
+	protocol.PurgeLinetypes:  C.DWG_TYPE_LTYPE,
+	protocol.PurgeTextStyles: C.DWG_TYPE_STYLE,
+	protocol.PurgeDimStyles:  C.DWG_TYPE_DIMSTYLE,
+	protocol.PurgeBlocks:     C.DWG_TYPE_BLOCK_HEADER,
+	protocol.PurgeAppIDs:     C.DWG_TYPE_APPID,
+}
+
+// purgeProtected 始终保留的表项。此外名称以 * 开头的块（模型空间、图纸空间与匿名块）
+// 以及依赖外部参照的表项（名称含 |）也不清理
+var purgeProtected = map[protocol.PurgeType][]string{
+	protocol.PurgeLayers:     {"0", "DEFPOINTS"},
+	protocol.PurgeLinetypes:  {"CONTINUOUS", "BYLAYER", "BYBLOCK"},
+	protocol.PurgeTextStyles: {"STANDARD"},
+	protocol.PurgeDimStyles:  {"STANDARD"},
+	protocol.PurgeAppIDs:     {"ACAD"},
+}
+
+func methodDocPurge(ctx context.Context, reqModel *api_rpc.RPCRequest, notify api_method.Notifier) (interface{}, error) {
+	var p protocol.PurgeParams
+	if err := api_method.DecodeParams(reqModel, &p); err != nil {
+		return nil, err
+	}
+	return withDrawing(p.Session, "", notify, func(d *drawing) (interface{}, error) {
+		return d.purge(ctx, &p)
+	})
+}
+
+type purgeCandidate struct {
+	obj  *C.Dwg_Object
+	kind protocol.PurgeType
+	name string
+}
+
+// purge 删除没有被使用的命名对象，调用方须持有 dwgLock。删除块定义会连同其中的实体一起删除，
+// 只被已删除对象使用的表项随后也会被删除。LibreDWG 记录的引用多于服务端解析出的引用时，
+// 说明还有服务端不解析的对象在使用该表项，这样的表项保留
+func (d *drawing) purge(ctx context.Context, p *protocol.PurgeParams) (*protocol.PurgeResult, error) {
+	kinds, err := purgeKinds(p.Types)
+	if err != nil {
+		return nil, err
+	}
+	keep, err := purgeKeep(p.Keep)
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := make(map[protocol.Handle]*purgeCandidate)
+	n := d.numObjects()
+	for i := 0; i < n; i++ {
+		obj := d.object(i)
+		if !d.live(obj) || d.isEntity(obj) {
+			continue
+		}
+		kind, ok := kinds[obj.fixedtype]
+		if !ok {
+			continue
+		}
+		name := d.tableName(obj)
+		if purgeKept(kind, name, keep[kind]) {
+			continue
+		}
+		candidates[d.handleOf(obj)] = &purgeCandidate{obj: obj, kind: kind, name: name}
+	}
+
+	result := &protocol.PurgeResult{Purged: make([]*protocol.PurgedObject, 0), DryRun: p.DryRun}
+	if len(candidates) == 0 {
+		return result, nil
+	}
+
+	// users 使用候选项的对象，0 表示头变量；members 块定义拥有的对象，随块定义一起删除
+	users := make(map[protocol.Handle][]protocol.Handle)
+	members := make(map[protocol.Handle][]protocol.Handle)
+	known := make(map[protocol.Handle]int)
+	for i := 0; i < n; i++ {
+		if i%progressEvery == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
+		obj := d.object(i)
+		if !d.live(obj) {
+			continue
+		}
+		h := d.handleOf(obj)
+		for _, r := range d.refsFrom(obj) {
+			c := candidates[r.Handle]
+			if c == nil {
+				continue
+			}
+			known[r.Handle]++
+			if r.Field == "owner" && c.kind == protocol.PurgeBlocks {
+				members[r.Handle] = append(members[r.Handle], h)
+			}
+			if !structuralFields[r.Field] {
+				users[r.Handle] = append(users[r.Handle], h)
+			}
+		}
+	}
+	for _, r := range d.headerRefs() {
+		if candidates[r.Handle] != nil {
+			known[r.Handle]++
+			users[r.Handle] = append(users[r.Handle], 0)
+		}
+	}
+	// 每个表项还被表的控制对象引用一次
+	counts := d.objectRefCounts()
+	for h := range candidates {
+		if counts[h] > known[h]+1 {
+			delete(candidates, h)
+		}
+	}
+
+	order := make([]protocol.Handle, 0, len(candidates))
+	for h := range candidates {
+		order = append(order, h)
+	}
+	sort.Slice(order, func(i, j int) bool { return order[i] < order[j] })
+
+	removed := make(map[protocol.Handle]bool)
+	for changed := true; changed; {
+		changed = false
+		for _, h := range order {
+			if removed[h] || !allRemoved(users[h], removed) {
+				continue
+			}
+			removed[h] = true
+			for _, m := range members[h] {
+				removed[m] = true
+			}
+			changed = true
+		}
+	}
+
+	for _, h := range order {
+		if c := candidates[h]; removed[h] {
+			result.Purged = append(result.Purged, &protocol.PurgedObject{Type: c.kind, Handle: h, Name: c.name})
+		}
+	}
+	result.Objects = len(removed)
+	if p.DryRun {
+		return result, nil
+	}
+	// 客户端在清理后清空撤销记录，删除后保留的对象不再需要
+	d.dropAllParked()
+	if len(removed) == 0 {
+		return result, nil
+	}
+
+	// 先删除实体，块定义释放前要从它的实体列表中移除
+	var entries []*C.Dwg_Object
+	for h := range removed {
+		obj := d.resolve(h)
+		if obj == nil {
+			continue
+		}
+		if d.isEntity(obj) {
+			d.erase(obj)
+		} else {
+			entries = append(entries, obj)
+		}
+	}
+	for _, obj := range entries {
+		d.erase(obj)
+	}
+	d.indexTables()
+	return result, nil
+}
+
+func allRemoved(users []protocol.Handle, removed map[protocol.Handle]bool) bool {
+	for _, u := range users {
+		if u == 0 || !removed[u] {
+			return false
+		}
+	}
+	return true
+}
+
+// purgeKinds 要清理的表项类型，types 为空时为全部类别
+func purgeKinds(types []protocol.PurgeType) (map[C.Dwg_Object_Type]protocol.PurgeType, error) {
+	if len(types) == 0 {
+		for t := range purgeTypes {
+			types = append(types, t)
+		}
+	}
+	kinds := make(map[C.Dwg_Object_Type]protocol.PurgeType)
+	for _, t := range types {
+		fixedtype, ok := purgeTypes[t]
+		if !ok {
+			return nil, fmt.Errorf("unknown purge type %q", t)
+		}
+		kinds[fixedtype] = t
+	}
+	return kinds, nil
+}
+
+// purgeKeep 检查保留名单中的通配符并统一为大写
+func purgeKeep(keep map[protocol.PurgeType][]string) (map[protocol.PurgeType][]string, error) {
+	out := make(map[protocol.PurgeType][]string)
+	for t, patterns := range keep {
+		if _, ok := purgeTypes[t]; !ok {
+			return nil, fmt.Errorf("unknown purge type %q", t)
+		}
+		for _, pattern := range patterns {
+			pattern = strings.ToUpper(pattern)
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("keep %s %q: %w", t, pattern, err)
+			}
+			out[t] = append(out[t], pattern)
+		}
+	}
+	return out, nil
+}
+
+// purgeKept 表项是否受保护或在保留名单中
+func purgeKept(kind protocol.PurgeType, name string, keep []string) bool {
+	name = strings.ToUpper(name)
+	if strings.Contains(name, "|") || (kind == protocol.PurgeBlocks && strings.HasPrefix(name, "*")) {
+		return true
+	}
+	for _, protected := range purgeProtected[kind] {
+		if name == protected {
+			return true
+		}
+	}
+	for _, pattern := range keep {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
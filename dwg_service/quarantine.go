@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+
+	"github.com/BlockLucky/dwg-go/api/api_method"
+	"github.com/BlockLucky/dwg-go/api/api_rpc"
+	"github.com/BlockLucky/dwg-go/dwg_service/dwg_service_conf"
+	"github.com/BlockLucky/dwg-go/dwg_service/dwg_service_pool"
+	"github.com/BlockLucky/dwg-go/dwg_service/dwg_service_quarantine"
+	"github.com/BlockLucky/dwg-go/protocol"
+)
+
+var quarantine *dwg_service_quarantine.Store
+
+// initQuarantine 打开隔离区并恢复全部条目的崩溃记录，重启 supervisor 后已知的问题文件仍会被拒绝
+func initQuarantine(cfg *dwg_service_conf.QuarantineConfig) error {
+	if cfg.Dir == "" {
+		return nil
+	}
+	store, err := dwg_service_quarantine.NewStore(cfg.Dir, cfg.MaxEntries)
+	if err != nil {
+		return err
+	}
+	quarantine = store
+
+	for _, m := range store.List() {
+		lastError := m.ExitState
+		if m.Limit != "" {
+			lastError = m.Limit + " limit exceeded"
+		}
+		crashes.Restore(&dwg_service_quarantine.CrashRecord{
+			Hash:      m.ID,
+			Path:      m.Path,
+			Method:    m.Method,
+			Count:     m.Count,
+			LastError: lastError,
+			FirstAt:   m.FirstAt,
+			LastAt:    m.LastAt,
+		})
+	}
+
+	api_method.RegisterMethod(protocol.MethodQuarantineList, func(ctx context.Context, reqModel *api_rpc.RPCRequest, notify api_method.Notifier) (interface{}, error) {
+		return quarantine.List(), nil
+	})
+	api_method.RegisterMethod(protocol.MethodQuarantineGet, func(ctx context.Context, reqModel *api_rpc.RPCRequest, notify api_method.Notifier) (interface{}, error) {
+		var p protocol.QuarantineParams
+		if err := api_method.DecodeParams(reqModel, &p); err != nil {
+			return nil, err
+		}
+		return quarantine.Get(p.ID)
+	})
+	// 不传 id 时清空隔离区；被清除的文件可以重新交给 worker 处理
+	api_method.RegisterMethod(protocol.MethodQuarantinePurge, func(ctx context.Context, reqModel *api_rpc.RPCRequest, notify api_method.Notifier) (interface{}, error) {
+		var p protocol.QuarantineParams
+		if len(reqModel.Params) > 0 {
+			if err := api_method.DecodeParams(reqModel, &p); err != nil {
+				return nil, err
+			}
+		}
+		ids, err := quarantine.Purge(p.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range ids {
+			crashes.Forget(id)
+		}
+		return &protocol.QuarantinePurgeResult{Purged: ids}, nil
+	})
+	return nil
+}
+
+// quarantineInput 将导致 worker 退出的输入与复现信息放入隔离区，limit 为超出的资源限制
+func quarantineInput(hash, input, method string, params interface{}, reason, limit string, crash *dwg_service_pool.CrashError) {
+	if quarantine == nil || hash == "" {
+		return
+	}
+	raw, _ := json.Marshal(params)
+	m := &dwg_service_quarantine.Manifest{
+		ID:        hash,
+		Reason:    reason,
+		Limit:     limit,
+		Method:    method,
+		Params:    raw,
+		LibreDWG:  libredwgCommit,
+		Signal:    crash.Signal,
+		ExitState: crash.State,
+		Stderr:    crash.Stderr,
+	}
+	if _, err := quarantine.Add(input, m); err != nil {
+		log.Printf("quarantine %s failed: %v", input, err)
+	}
+}
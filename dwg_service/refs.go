@@ -0,0 +1,177 @@
+package main
+
+/*
+#include <dwg.h>
+
+static BITCODE_H dwgr_at(BITCODE_H *refs, BITCODE_BL i) { return refs[i]; }
+static int dwgr_code(BITCODE_H ref) { return ref ? ref->handleref.code : 0; }
+
+static BITCODE_H dwgr_style(Dwg_Object *o) {
+  switch (o->fixedtype) {
+  case DWG_TYPE_TEXT: return o->tio.entity->tio.TEXT->style;
+  case DWG_TYPE_MTEXT: return o->tio.entity->tio.MTEXT->style;
+  case DWG_TYPE_ATTRIB: return o->tio.entity->tio.ATTRIB->style;
+  case DWG_TYPE_ATTDEF: return o->tio.entity->tio.ATTDEF->style;
+  default: return NULL;
+  }
+}
+static int dwgr_is_dimension(Dwg_Object *o) {
+  return o->fixedtype >= DWG_TYPE_DIMENSION_ORDINATE && o->fixedtype <= DWG_TYPE_DIMENSION_DIAMETER;
+}
+static Dwg_DIMENSION_common *dwgr_dimension(Dwg_Object *o) { return o->tio.entity->tio.DIMENSION_common; }
+static Dwg_Object_LAYER *dwgr_layer(Dwg_Object *o) { return o->tio.object->tio.LAYER; }
+static Dwg_Object_DIMSTYLE *dwgr_dimstyle(Dwg_Object *o) { return o->tio.object->tio.DIMSTYLE; }
+static Dwg_Object_BLOCK_HEADER *dwgr_block_header(Dwg_Object *o) { return o->tio.object->tio.BLOCK_HEADER; }
+static Dwg_Object_DICTIONARY *dwgr_dictionary(Dwg_Object *o) { return o->tio.object->tio.DICTIONARY; }
+static Dwg_Entity_INSERT *dwgr_insert(Dwg_Object *o) { return o->tio.entity->tio.INSERT; }
+static BITCODE_T dwgr_text_at(BITCODE_T *texts, BITCODE_BL i) { return texts[i]; }
+
+static Dwg_Eed *dwgr_eed(Dwg_Object *o, BITCODE_BL *n) {
+  if (o->supertype == DWG_SUPERTYPE_ENTITY) {
+    *n = o->tio.entity->num_eed;
+    return o->tio.entity->eed;
+  }
+  *n = o->tio.object->num_eed;
+  return o->tio.object->eed;
+}
+static unsigned long dwgr_eed_appid(Dwg_Eed *eed, BITCODE_BL i) { return eed[i].handle.value; }
+*/
+import "C"
+
+import (
+	"github.com/BlockLucky/dwg-go/protocol"
+)
+
+// objectRef 对象中的一个引用。Code 为句柄码：2/3 软/硬所有者，4/5 软/硬指针；
+// Name 为字典项的键
+type objectRef struct {
+	Field  string
+	Code   int
+	Handle protocol.Handle
+	Name   string
+}
+
+// 不表示“使用”的引用：指向所有者、反应器的回指，以及块定义对其实体的拥有关系
+var structuralFields = map[string]bool{
+	"owner":   true,
+	"reactor": true,
+	"entity":  true,
+}
+
+// refsFrom 列出对象中服务端能解析的引用。所有对象都解析所有者、反应器、扩展字典与 EED 的应用名，
+// 其余字段只解析实体的图层与线型、文字样式、块参照、标注，以及图层、标注样式、块定义与字典
+func (d *drawing) refsFrom(obj *C.Dwg_Object) []objectRef {
+	var refs []objectRef
+	add := func(field string, ref C.BITCODE_H) {
+		if h := refHandle(ref); h != 0 {
+			refs = append(refs, objectRef{Field: field, Code: int(C.dwgr_code(ref)), Handle: h})
+		}
+	}
+	addAll := func(field string, list *C.BITCODE_H, n C.BITCODE_BL) {
+		if list == nil {
+			return
+		}
+		for i := C.BITCODE_BL(0); i < n; i++ {
+			add(field, C.dwgr_at(list, i))
+		}
+	}
+
+	if owner := d.owner(obj); owner != 0 {
+		refs = append(refs, objectRef{Field: "owner", Code: int(C.dwgr_code(*ownerSlot(obj))), Handle: owner})
+	}
+	reactors, numReactors := reactorList(obj)
+	addAll("reactor", reactors, numReactors)
+	add("xdic", *xdicSlot(obj))
+	var numEED C.BITCODE_BL
+	if eed := C.dwgr_eed(obj, &numEED); eed != nil {
+		for i := C.BITCODE_BL(0); i < numEED; i++ {
+			if h := protocol.Handle(C.dwgr_eed_appid(eed, i)); h != 0 {
+				refs = append(refs, objectRef{Field: "eed", Code: refHardPointer, Handle: h})
+			}
+		}
+	}
+
+	if d.isEntity(obj) {
+		add("layer", *layerSlot(obj))
+		add("ltype", *ltypeSlot(obj))
+		add("style", C.dwgr_style(obj))
+		switch {
+		case obj.fixedtype == C.DWG_TYPE_INSERT:
+			add("block", C.dwgr_insert(obj).block_header)
+		case C.dwgr_is_dimension(obj) != 0:
+			dim := C.dwgr_dimension(obj)
+			add("dimstyle", dim.dimstyle)
+			add("block", dim.block)
+		}
+		return refs
+	}
+
+	switch obj.fixedtype {
+	case C.DWG_TYPE_LAYER:
+		add("ltype", C.dwgr_layer(obj).ltype)
+	case C.DWG_TYPE_DIMSTYLE:
+		ds := C.dwgr_dimstyle(obj)
+		add("DIMTXSTY", ds.DIMTXSTY)
+		add("DIMLTYPE", ds.DIMLTYPE)
+		add("DIMLTEX1", ds.DIMLTEX1)
+		add("DIMLTEX2", ds.DIMLTEX2)
+		add("DIMBLK", ds.DIMBLK)
+		add("DIMBLK1", ds.DIMBLK1)
+		add("DIMBLK2", ds.DIMBLK2)
+		add("DIMLDRBLK", ds.DIMLDRBLK)
+	case C.DWG_TYPE_BLOCK_HEADER:
+		bh := C.dwgr_block_header(obj)
+		addAll("entity", bh.entities, bh.num_owned)
+	case C.DWG_TYPE_DICTIONARY:
+		dict := C.dwgr_dictionary(obj)
+		if dict.itemhandles == nil {
+			break
+		}
+		for i := C.BITCODE_BL(0); i < dict.numitems; i++ {
+			ref := C.dwgr_at(dict.itemhandles, i)
+			if h := refHandle(ref); h != 0 {
+				var name string
+				if dict.texts != nil {
+					name = d.text(C.dwgr_text_at(dict.texts, i))
+				}
+				refs = append(refs, objectRef{Field: "item", Code: int(C.dwgr_code(ref)), Handle: h, Name: name})
+			}
+		}
+	}
+	return refs
+}
+
+// headerRefs 头变量中指向表项的引用
+func (d *drawing) headerRefs() []objectRef {
+	vars := &d.dwg.header_vars
+	var refs []objectRef
+	for _, r := range []struct {
+		field string
+		ref   C.BITCODE_H
+	}{
+		{"$CLAYER", vars.CLAYER},
+		{"$CELTYPE", vars.CELTYPE},
+		{"$TEXTSTYLE", vars.TEXTSTYLE},
+		{"$DIMSTYLE", vars.DIMSTYLE},
+		{"$DIMTXSTY", vars.DIMTXSTY},
+	} {
+		if h := refHandle(r.ref); h != 0 {
+			refs = append(refs, objectRef{Field: r.field, Code: int(C.dwgr_code(r.ref)), Handle: h})
+		}
+	}
+	return refs
+}
+
+// objectRefCounts LibreDWG 解码时记录的全部引用按目标句柄计数，包括服务端不解析的字段
+func (d *drawing) objectRefCounts() map[protocol.Handle]int {
+	counts := make(map[protocol.Handle]int)
+	if d.dwg.object_ref == nil {
+		return counts
+	}
+	for i := C.BITCODE_BL(0); i < d.dwg.num_object_refs; i++ {
+		if h := refHandle(C.dwgr_at(d.dwg.object_ref, i)); h != 0 {
+			counts[h]++
+		}
+	}
+	return counts
+}
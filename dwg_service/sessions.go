@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/BlockLucky/dwg-go/api/api_method"
+	"github.com/BlockLucky/dwg-go/api/api_rpc"
+	"github.com/BlockLucky/dwg-go/dwg_service/dwg_service_conf"
+	"github.com/BlockLucky/dwg-go/dwg_service/dwg_service_session"
+	"github.com/BlockLucky/dwg-go/protocol"
+)
+
+var sessions *dwg_service_session.Store
+
+var memoryFactor float64
+
+// newDrawingMemory 新建的空图纸预估占用的内存
+const newDrawingMemory int64 = 1 << 20
+
+// sessionDrawing 常驻会话中的图纸，释放时需要持有 dwgLock
+type sessionDrawing struct {
+	*drawing
+}
+
+func (s *sessionDrawing) Close() {
+	dwgLock.Lock()
+	defer dwgLock.Unlock()
+	s.free()
+}
+
+func initSessions(cfg *dwg_service_conf.SessionConfig) {
+	memoryFactor = cfg.MemoryFactor
+	if memoryFactor <= 0 {
+		memoryFactor = 1
+	}
+
+	sessions = dwg_service_session.NewStore(dwg_service_session.Config{
+		IdleTTL:     time.Duration(cfg.IdleTTLSeconds) * time.Second,
+		MaxSessions: cfg.MaxSessions,
+		MaxMemory:   cfg.MaxMemoryMB << 20,
+	})
+	sessions.StartJanitor(30 * time.Second)
+
+	api_method.RegisterMethod(protocol.MethodDocOpen, methodDocOpen)
+	api_method.RegisterMethod(protocol.MethodDocNew, methodDocNew)
+	api_method.RegisterMethod(protocol.MethodDocClose, methodDocClose)
+	api_method.RegisterMethod(protocol.MethodDocHeader, sessionMethod(func(ctx context.Context, d *drawing, notify api_method.Notifier) (interface{}, error) {
+		return d.header(), nil
+	}))
+	api_method.RegisterMethod(protocol.MethodDocLayers, sessionMethod(func(ctx context.Context, d *drawing, notify api_method.Notifier) (interface{}, error) {
+		return d.layerList(), nil
+	}))
+	api_method.RegisterMethod(protocol.MethodDocBlocks, sessionMethod(func(ctx context.Context, d *drawing, notify api_method.Notifier) (interface{}, error) {
+		return d.blockList(), nil
+	}))
+	// doc.entities 与 dwg.entities 参数一致，按 session 分页
+	api_method.RegisterMethod(protocol.MethodDocEntities, methodEntities)
+	api_method.RegisterMethod(protocol.MethodDocWrite, methodDocWrite)
+	api_method.RegisterMethod(protocol.MethodDocPurge, methodDocPurge)
+	api_method.RegisterMethod(protocol.MethodDocObject, methodDocObject)
+	api_method.RegisterMethod(protocol.MethodDocEdit, methodDocEdit)
+}
+
+func methodDocOpen(ctx context.Context, reqModel *api_rpc.RPCRequest, notify api_method.Notifier) (interface{}, error) {
+	var p protocol.OpenParams
+	if err := api_method.DecodeParams(reqModel, &p); err != nil {
+		return nil, err
+	}
+	st, err := os.Stat(p.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	memory := int64(float64(st.Size()) * memoryFactor)
+	var warnings []*protocol.Warning
+	info, err := sessions.Open(p.Path, memory, func() (dwg_service_session.Resource, error) {
+		dwgLock.Lock()
+		defer dwgLock.Unlock()
+
+		d, err := loadDrawing(p.Path, p.Recover, notify)
+		if err != nil {
+			return nil, err
+		}
+		warnings = d.warnings
+		return &sessionDrawing{drawing: d}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	info.Warnings = warnings
+	return info, nil
+}
+
+// methodDocNew 新建图纸或读取模板，作为新的会话
+func methodDocNew(ctx context.Context, reqModel *api_rpc.RPCRequest, notify api_method.Notifier) (interface{}, error) {
+	var p protocol.NewParams
+	if err := api_method.DecodeParams(reqModel, &p); err != nil {
+		return nil, err
+	}
+
+	memory := newDrawingMemory
+	if p.Template != "" {
+		st, err := os.Stat(p.Template)
+		if err != nil {
+			return nil, err
+		}
+		memory = int64(float64(st.Size()) * memoryFactor)
+	}
+	return sessions.Open(p.Template, memory, func() (dwg_service_session.Resource, error) {
+		dwgLock.Lock()
+		defer dwgLock.Unlock()
+
+		if p.Template == "" {
+			d, err := newDrawing(p.Release, p.Imperial)
+			if err != nil {
+				return nil, err
+			}
+			return &sessionDrawing{drawing: d}, nil
+		}
+		d, err := loadDrawing(p.Template, false, notify)
+		if err != nil {
+			return nil, err
+		}
+		if err = d.setRelease(p.Release); err != nil {
+			d.free()
+			return nil, err
+		}
+		return &sessionDrawing{drawing: d}, nil
+	})
+}
+
+func methodDocClose(ctx context.Context, reqModel *api_rpc.RPCRequest, notify api_method.Notifier) (interface{}, error) {
+	var p protocol.SessionParams
+	if err := api_method.DecodeParams(reqModel, &p); err != nil {
+		return nil, err
+	}
+	if err := sessions.Close(p.Session); err != nil {
+		return nil, err
+	}
+	return true, nil
+}
+
+// methodDocWrite 将会话中的图纸写为 DWG 或 DXF，会话保持打开
+func methodDocWrite(ctx context.Context, reqModel *api_rpc.RPCRequest, notify api_method.Notifier) (interface{}, error) {
+	var p protocol.WriteParams
+	if err := api_method.DecodeParams(reqModel, &p); err != nil {
+		return nil, err
+	}
+	if p.Output == "" {
+		return nil, errors.New("output is required")
+	}
+	if p.Format == "" {
+		p.Format = "dwg"
+		if strings.EqualFold(filepath.Ext(p.Output), ".dxf") {
+			p.Format = "dxf"
+		}
+	}
+	if p.Format != "dwg" && p.Format != "dxf" {
+		return nil, errors.New("unsupported output format: " + p.Format)
+	}
+	return withDrawing(p.Session, "", notify, func(d *drawing) (interface{}, error) {
+		progress(notify, "write", d, d.numObjects())
+		var err error
+		if p.Format == "dxf" {
+			err = d.writeDXF(p.Output)
+		} else {
+			err = d.write(p.Output, p.Release)
+		}
+		if err != nil {
+			return nil, err
+		}
+		st, err := os.Stat(p.Output)
+		if err != nil {
+			return nil, err
+		}
+		return &protocol.ConvertResult{Output: p.Output, Format: p.Format, Size: st.Size()}, nil
+	})
+}
+
+// sessionMethod 包装基于会话的方法：取出会话中的图纸并在 dwgLock 保护下执行
+func sessionMethod(fn func(ctx context.Context, d *drawing, notify api_method.Notifier) (interface{}, error)) api_method.MethodFunc {
+	return func(ctx context.Context, reqModel *api_rpc.RPCRequest, notify api_method.Notifier) (interface{}, error) {
+		var p protocol.SessionParams
+		if err := api_method.DecodeParams(reqModel, &p); err != nil {
+			return nil, err
+		}
+
+		res, release, err := sessions.Acquire(p.Session)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+
+		dwgLock.Lock()
+		defer dwgLock.Unlock()
+		return fn(ctx, res.(*sessionDrawing).drawing, notify)
+	}
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BlockLucky/dwg-go/api/api_method"
+	"github.com/BlockLucky/dwg-go/api/api_rpc"
+	"github.com/BlockLucky/dwg-go/dwg_service/dwg_service_conf"
+	"github.com/BlockLucky/dwg-go/dwg_service/dwg_service_pool"
+	"github.com/BlockLucky/dwg-go/dwg_service/dwg_service_quarantine"
+	"github.com/BlockLucky/dwg-go/dwg_service/dwg_service_session"
+	"github.com/BlockLucky/dwg-go/protocol"
+)
+
+// workerMethods 由 worker 进程执行的方法，其余方法（job.* 等）在 supervisor 中执行
+var workerMethods = []string{
+	protocol.MethodRead,
+	protocol.MethodConvert,
+	protocol.MethodEntities,
+	protocol.MethodStream,
+	protocol.MethodDocOpen,
+	protocol.MethodDocHeader,
+	protocol.MethodDocLayers,
+	protocol.MethodDocBlocks,
+	protocol.MethodDocEntities,
+	protocol.MethodDocWrite,
+	protocol.MethodDocPurge,
+	protocol.MethodDocObject,
+	protocol.MethodDocEdit,
+	protocol.MethodDocNew,
+	protocol.MethodDocClose,
+	protocol.MethodAudit,
+}
+
+var pool *dwg_service_pool.Pool
+
+// crashes 导致 worker 崩溃或超限的输入
+var crashes *dwg_service_quarantine.CrashTracker
+
+// cfgOutputLimit 单个输出文件的大小上限，0 表示不限
+var cfgOutputLimit int64
+
+// initPool 启动 worker 进程池，并将 workerMethods 注册为转发到 worker 的方法
+func initPool(cfg *dwg_service_conf.PoolConfig, qcfg *dwg_service_conf.QuarantineConfig, configPath string) error {
+	if cfg.Limits.MemoryMB > 0 && cfg.Limits.MemoryMB < dwg_service_conf.MinMemoryMB {
+		return fmt.Errorf("pool.limits.memory_mb must be at least %d", dwg_service_conf.MinMemoryMB)
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	pool, err = dwg_service_pool.New(dwg_service_pool.Config{
+		Path:        exe,
+		Args:        []string{"-worker", "-c", configPath},
+		Workers:     cfg.Workers,
+		MaxRequests: cfg.MaxRequests,
+		MaxRSS:      cfg.MaxRSSMB << 20,
+		Stderr:      os.Stderr,
+		Limits: dwg_service_pool.Limits{
+			Timeout: time.Duration(cfg.Limits.TimeoutSeconds) * time.Second,
+			CPU:     time.Duration(cfg.Limits.CPUSeconds) * time.Second,
+			Memory:  cfg.Limits.MemoryMB << 20,
+			Output:  cfg.Limits.MaxOutputMB << 20,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	pool.StartJanitor(30 * time.Second)
+	cfgOutputLimit = cfg.Limits.MaxOutputMB << 20
+	crashes = dwg_service_quarantine.NewCrashTracker(cfg.MaxCrashes, time.Duration(cfg.CrashTTLSeconds)*time.Second)
+	if err = initQuarantine(qcfg); err != nil {
+		return err
+	}
+
+	for _, name := range workerMethods {
+		api_method.RegisterMethod(name, forwardMethod(name))
+	}
+	api_method.RegisterMethod(protocol.MethodPoolStats, func(ctx context.Context, reqModel *api_rpc.RPCRequest, notify api_method.Notifier) (interface{}, error) {
+		return pool.Stats(), nil
+	})
+	return nil
+}
+
+// registerWorkerStats worker 进程提供给 supervisor 的内部方法
+func registerWorkerStats() {
+	api_method.RegisterMethod(dwg_service_pool.MethodWorkerStats, func(ctx context.Context, reqModel *api_rpc.RPCRequest, notify api_method.Notifier) (interface{}, error) {
+		return &dwg_service_pool.WorkerStats{Sessions: sessions.Stats().Sessions}, nil
+	})
+}
+
+// forwardMethod 转发到 worker 执行；会话只存在于打开它的 worker 中，
+// 对外的会话 ID 为 "<slot>-<worker 内的会话 ID>"。worker 崩溃时返回 service_crashed，
+// 崩溃或因超限被结束时记录输入文件，同一文件反复出问题后不再转发
+func forwardMethod(name string) api_method.MethodFunc {
+	return func(ctx context.Context, reqModel *api_rpc.RPCRequest, notify api_method.Notifier) (interface{}, error) {
+		var params interface{}
+		if len(reqModel.Params) > 0 {
+			params = reqModel.Params[0]
+		}
+
+		slot := dwg_service_pool.AnyWorker
+		var input string
+		var pathPaging bool
+		var p map[string]interface{}
+		if err := api_method.DecodeParams(reqModel, &p); err == nil {
+			input = inputPath(p)
+			if id, _ := p["session"].(string); id != "" {
+				var inner string
+				slot, inner = splitSessionID(id)
+				if slot < 0 {
+					return nil, dwg_service_session.ErrSessionNotFound
+				}
+				p["session"] = inner
+				params = p
+			} else if name == protocol.MethodEntities {
+				// 按 path 分页的解析结果缓存在返回上一页的 worker 中
+				pathPaging = true
+				if cursor, _ := p["cursor"].(string); cursor != "" {
+					slot, p["cursor"] = splitCursorSlot(cursor, len(pool.Stats().Workers))
+					params = p
+				}
+			}
+		}
+
+		if err := crashes.Check(input); err != nil {
+			return nil, err
+		}
+
+		result, served, err := pool.Call(ctx, slot, name, params, func(method string, data json.RawMessage) {
+			notify(method, data)
+		})
+		var limitErr *dwg_service_pool.LimitError
+		if !errors.As(err, &limitErr) && err != nil && outputLimitHit(p, cfgOutputLimit) {
+			// Go 运行时忽略 SIGXFSZ，输出文件达到 RLIMIT_FSIZE 时 worker 只会返回写入失败
+			limitErr = &dwg_service_pool.LimitError{Limit: dwg_service_pool.LimitOutput, Max: fmt.Sprintf("%d bytes", cfgOutputLimit)}
+		}
+		if limitErr != nil {
+			// 因超出限制被结束的 worker 与崩溃一样记录输入并放入隔离区，反复超限的文件不再转发
+			if limitErr.Crash != nil {
+				if hash := crashes.Record(input, name, limitErr); hash != "" {
+					reason := dwg_service_quarantine.ReasonLimit
+					if limitErr.Limit == dwg_service_pool.LimitTimeout || limitErr.Limit == dwg_service_pool.LimitCPU {
+						reason = dwg_service_quarantine.ReasonTimeout
+					}
+					quarantineInput(hash, input, name, params, reason, limitErr.Limit, limitErr.Crash)
+				}
+			}
+			return nil, &protocol.LimitError{Limit: limitErr.Limit, Max: limitErr.Max}
+		}
+		var crash *dwg_service_pool.CrashError
+		if errors.As(err, &crash) {
+			msg := crash.Error()
+			if hash := crashes.Record(input, name, crash); hash != "" {
+				msg += ", input sha256:" + hash
+				quarantineInput(hash, input, name, params, dwg_service_quarantine.ReasonCrash, "", crash)
+			}
+			return nil, fmt.Errorf("%w: %s", protocol.ErrServiceCrashed, msg)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if name == protocol.MethodDocOpen || name == protocol.MethodDocNew {
+			return withSessionSlot(result, served)
+		}
+		if pathPaging {
+			return withCursorSlot(result, served)
+		}
+		return result, nil
+	}
+}
+
+// outputLimitHit 输出文件（dwg.convert 的 output）是否已达到大小上限
+func outputLimitHit(p map[string]interface{}, limit int64) bool {
+	output, _ := p["output"].(string)
+	if limit <= 0 || output == "" {
+		return false
+	}
+	st, err := os.Stat(output)
+	return err == nil && st.Size() >= limit
+}
+
+// inputPath 调用读取的文件：dwg.convert 为 input，doc.new 为 template，其余方法为 path
+func inputPath(p map[string]interface{}) string {
+	if path, _ := p["input"].(string); path != "" {
+		return path
+	}
+	if path, _ := p["template"].(string); path != "" {
+		return path
+	}
+	path, _ := p["path"].(string)
+	return path
+}
+
+func splitSessionID(id string) (int, string) {
+	prefix, inner, ok := strings.Cut(id, "-")
+	if !ok {
+		return -1, ""
+	}
+	slot, err := strconv.Atoi(prefix)
+	if err != nil || slot < 0 {
+		return -1, ""
+	}
+	return slot, inner
+}
+
+// withSessionSlot 在 doc.open 与 doc.new 返回的会话 ID 前加上 worker 序号
+func withSessionSlot(result json.RawMessage, slot int) (interface{}, error) {
+	var info map[string]interface{}
+	if err := json.Unmarshal(result, &info); err != nil {
+		return nil, err
+	}
+	if id, _ := info["session"].(string); id != "" {
+		info["session"] = fmt.Sprintf("%d-%s", slot, id)
+	}
+	return info, nil
+}
+
+// splitCursorSlot 拆出 withCursorSlot 加在游标前的 worker 序号，没有序号或序号无效时交给任一 worker
+func splitCursorSlot(cursor string, workers int) (int, string) {
+	prefix, inner, ok := strings.Cut(cursor, ".")
+	if !ok {
+		return dwg_service_pool.AnyWorker, cursor
+	}
+	slot, err := strconv.Atoi(prefix)
+	if err != nil || slot < 0 || slot >= workers {
+		return dwg_service_pool.AnyWorker, inner
+	}
+	return slot, inner
+}
+
+// withCursorSlot 在按 path 分页返回的游标前加上 worker 序号，下一页交给同一个 worker。
+// 游标为 base64url，不含 "."
+func withCursorSlot(result json.RawMessage, slot int) (interface{}, error) {
+	// 实体原样转发，只改写游标
+	var page map[string]json.RawMessage
+	if err := json.Unmarshal(result, &page); err != nil {
+		return nil, err
+	}
+	var cursor string
+	if raw, ok := page["next_cursor"]; ok && json.Unmarshal(raw, &cursor) == nil && cursor != "" {
+		page["next_cursor"], _ = json.Marshal(fmt.Sprintf("%d.%s", slot, cursor))
+	}
+	return page, nil
+}
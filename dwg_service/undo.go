@@ -0,0 +1,172 @@
+package main
+
+/*
+#include <dwg.h>
+
+static void *dwgu_data(Dwg_Object *o) { return o->tio.entity; }
+
+// 与 dwgo_erase 一样将对象记录标记为 DWG_TYPE_FREED，但不释放对象数据
+static void dwgu_park(Dwg_Object *o) {
+  o->tio.entity = NULL;
+  o->fixedtype = DWG_TYPE_FREED;
+}
+
+static void dwgu_unpark(Dwg_Object *o, Dwg_Object_Type fixedtype, void *data) {
+  o->tio.entity = (Dwg_Object_Entity *)data;
+  o->fixedtype = fixedtype;
+}
+
+static void dwgu_free(Dwg_Object *o, Dwg_Object_Type fixedtype, void *data) {
+  dwgu_unpark(o, fixedtype, data);
+  dwg_free_object(o);
+  dwgu_park(o);
+}
+*/
+import "C"
+
+import (
+	"context"
+	"fmt"
+	"unsafe"
+
+	"github.com/BlockLucky/dwg-go/protocol"
+)
+
+// parkedObject 被 delete_* 删除但保留数据的对象，pos 与 code 为它在所有者列表中的位置与句柄码
+type parkedObject struct {
+	index     int
+	handle    protocol.Handle
+	fixedtype C.Dwg_Object_Type
+	data      unsafe.Pointer
+	pos, code int
+}
+
+// park 删除 objs 但不释放数据，按删除操作的句柄 h 保存，restore 时原样放回，
+// 包括服务端不读取的线型、扩展数据与扩展字典。h 此前删除后没有恢复的对象在这时释放
+func (d *drawing) park(h protocol.Handle, objs ...*C.Dwg_Object) {
+	d.dropParked(h)
+	if d.parked == nil {
+		d.parked = make(map[protocol.Handle][]*parkedObject)
+	}
+	for _, obj := range objs {
+		handle := d.handleOf(obj)
+		index, ok := d.handles[handle]
+		if !ok {
+			d.erase(obj)
+			continue
+		}
+		p := &parkedObject{index: index, handle: handle, fixedtype: obj.fixedtype, data: C.dwgu_data(obj)}
+		p.pos, p.code = d.unlink(obj)
+		C.dwgu_park(obj)
+		d.unindex(handle)
+		d.parked[h] = append(d.parked[h], p)
+	}
+}
+
+// restore 按删除的相反顺序放回 h 删除的对象；失败时已放回的对象重新删除，图纸不变
+func (d *drawing) restore(h protocol.Handle) error {
+	objs := d.parked[h]
+	if len(objs) == 0 {
+		return fmt.Errorf("no deleted object %X to restore", uint64(h))
+	}
+	for _, p := range objs {
+		if err := d.checkNewHandle(p.handle); err != nil {
+			return err
+		}
+	}
+	for i := len(objs) - 1; i >= 0; i-- {
+		p := objs[i]
+		obj := d.object(p.index)
+		C.dwgu_unpark(obj, p.fixedtype, p.data)
+		if err := d.link(obj, p.pos, p.code); err != nil {
+			C.dwgu_park(obj)
+			for _, back := range objs[i+1:] {
+				obj = d.object(back.index)
+				d.unlink(obj)
+				C.dwgu_park(obj)
+				d.unindex(back.handle)
+			}
+			return fmt.Errorf("restore %X: %w", uint64(p.handle), err)
+		}
+		d.indexObject(p.index)
+	}
+	delete(d.parked, h)
+	return nil
+}
+
+// dropParked 释放 h 删除后没有恢复的对象
+func (d *drawing) dropParked(h protocol.Handle) {
+	for _, p := range d.parked[h] {
+		C.dwgu_free(d.object(p.index), p.fixedtype, p.data)
+	}
+	delete(d.parked, h)
+}
+
+// dropAllParked 释放所有删除后没有恢复的对象，此后已有的撤销记录不能再恢复删除
+func (d *drawing) dropAllParked() {
+	for h := range d.parked {
+		d.dropParked(h)
+	}
+}
+
+// inverse 撤销 op 的编辑操作，修改与删除在执行前按当前状态生成；新建操作返回 nil，
+// 执行后由 undoAdd 按分配到的句柄生成。删除的撤销为 restore，在同一会话中原样放回被删除的对象
+func (d *drawing) inverse(op *protocol.EditOp) ([]*protocol.EditOp, error) {
+	switch op.Op {
+	case protocol.EditModifyEntity:
+		obj := d.resolve(op.Handle)
+		if obj == nil || !d.isEntity(obj) {
+			return nil, nil
+		}
+		return []*protocol.EditOp{{Op: protocol.EditModifyEntity, Handle: op.Handle, Entity: d.entity(d.handles[op.Handle])}}, nil
+	case protocol.EditModifyLayer:
+		obj := d.resolveType(op.Handle, C.DWG_TYPE_LAYER)
+		if obj == nil {
+			return nil, nil
+		}
+		return []*protocol.EditOp{{Op: protocol.EditModifyLayer, Handle: op.Handle, Layer: d.layerOf(obj)}}, nil
+	case protocol.EditDeleteEntity, protocol.EditDeleteLayer, protocol.EditDeleteBlock:
+		return []*protocol.EditOp{{Op: protocol.EditRestore, Handle: op.Handle}}, nil
+	case protocol.EditRestore:
+		objs := d.parked[op.Handle]
+		if len(objs) == 0 {
+			return nil, nil
+		}
+		// 最后删除的是操作的对象本身，之前的是它的扩展字典或块中的实体
+		kind := protocol.EditDeleteEntity
+		switch objs[len(objs)-1].fixedtype {
+		case C.DWG_TYPE_LAYER:
+			kind = protocol.EditDeleteLayer
+		case C.DWG_TYPE_BLOCK_HEADER:
+			kind = protocol.EditDeleteBlock
+		}
+		return []*protocol.EditOp{{Op: kind, Handle: op.Handle}}, nil
+	}
+	return nil, nil
+}
+
+// undoAdd 撤销新建操作的删除操作
+func undoAdd(kind protocol.EditOpKind, h protocol.Handle) []*protocol.EditOp {
+	del := map[protocol.EditOpKind]protocol.EditOpKind{
+		protocol.EditAddEntity: protocol.EditDeleteEntity,
+		protocol.EditAddLayer:  protocol.EditDeleteLayer,
+		protocol.EditAddBlock:  protocol.EditDeleteBlock,
+	}[kind]
+	return []*protocol.EditOp{{Op: del, Handle: h}}
+}
+
+// rollback 按顺序执行 undo 撤销本批已执行的操作并恢复 $HANDSEED，返回 cause；
+// 撤销也失败时返回的错误说明图纸已被部分修改
+func (d *drawing) rollback(undo []*protocol.EditOp, seed protocol.Handle, cause error) error {
+	for _, op := range undo {
+		_, err := d.apply(context.Background(), op)
+		d.graph = nil
+		if err != nil {
+			return fmt.Errorf("%w (rollback failed, the drawing is partially modified: %v)", cause, err)
+		}
+	}
+	if seed != 0 {
+		d.setHandseed(seed)
+	}
+	return cause
+}
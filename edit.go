@@ -0,0 +1,103 @@
+package dwg_go
+
+import (
+	"context"
+
+	"github.com/BlockLucky/dwg-go/protocol"
+)
+
+// EditOp 一个编辑操作，见 protocol.EditOp
+type EditOp = protocol.EditOp
+
+// EditOpKind 编辑操作的类别
+type EditOpKind = protocol.EditOpKind
+
+// 编辑操作的类别
+const (
+	EditAddEntity    = protocol.EditAddEntity
+	EditModifyEntity = protocol.EditModifyEntity
+	EditDeleteEntity = protocol.EditDeleteEntity
+	EditAddLayer     = protocol.EditAddLayer
+	EditModifyLayer  = protocol.EditModifyLayer
+	EditDeleteLayer  = protocol.EditDeleteLayer
+	EditAddBlock     = protocol.EditAddBlock
+	EditDeleteBlock  = protocol.EditDeleteBlock
+	EditRestore      = protocol.EditRestore
+)
+
+// Edit 按顺序执行编辑操作，返回与 ops 一一对应的对象句柄。新建对象的句柄自动分配，
+// 所有者与 $HANDSEED 由 dwg_service 维护；结果用 WriteDWG 或 WriteDXF 保存。
+// 任一操作失败时整批不生效；成功的调用记为一步撤销，事务中则并入事务
+func (s *Session) Edit(ctx context.Context, ops ...*EditOp) ([]Handle, error) {
+	s.history.lock.Lock()
+	defer s.history.lock.Unlock()
+	if s.history.aborted {
+		return nil, ErrTransactionAborted
+	}
+	result, err := s.edit(ctx, ops)
+	if err != nil {
+		return nil, err
+	}
+	s.history.record(result)
+	return result.Handles, nil
+}
+
+func (s *Session) edit(ctx context.Context, ops []*EditOp) (*protocol.EditResult, error) {
+	result := &protocol.EditResult{}
+	if err := s.client.call(ctx, protocol.MethodDocEdit, &protocol.EditParams{Session: s.id, Ops: ops}, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (s *Session) editOne(ctx context.Context, op *EditOp) (Handle, error) {
+	handles, err := s.Edit(ctx, op)
+	if err != nil {
+		return 0, err
+	}
+	return handles[0], nil
+}
+
+// AddEntity 新建实体，按 e.Space 与 e.Block 放入模型空间（默认）、图纸空间或块定义，
+// 支持 LINE、CIRCLE、ARC、POINT、TEXT、MTEXT、INSERT 与 LWPOLYLINE
+func (s *Session) AddEntity(ctx context.Context, e *Entity) (Handle, error) {
+	return s.editOne(ctx, &EditOp{Op: EditAddEntity, Entity: e})
+}
+
+// ModifyEntity 用 e 替换句柄为 e.Handle 的实体的图层、颜色与几何数据，通常先读出再改写
+func (s *Session) ModifyEntity(ctx context.Context, e *Entity) error {
+	_, err := s.editOne(ctx, &EditOp{Op: EditModifyEntity, Handle: e.Handle, Entity: e})
+	return err
+}
+
+func (s *Session) DeleteEntity(ctx context.Context, h Handle) error {
+	_, err := s.editOne(ctx, &EditOp{Op: EditDeleteEntity, Handle: h})
+	return err
+}
+
+func (s *Session) AddLayer(ctx context.Context, l *Layer) (Handle, error) {
+	return s.editOne(ctx, &EditOp{Op: EditAddLayer, Layer: l})
+}
+
+// ModifyLayer 用 l 替换句柄为 l.Handle 的图层的名称、颜色与开关状态
+func (s *Session) ModifyLayer(ctx context.Context, l *Layer) error {
+	_, err := s.editOne(ctx, &EditOp{Op: EditModifyLayer, Handle: l.Handle, Layer: l})
+	return err
+}
+
+// DeleteLayer 删除图层，仍被使用的图层与图层 0 不能删除
+func (s *Session) DeleteLayer(ctx context.Context, h Handle) error {
+	_, err := s.editOne(ctx, &EditOp{Op: EditDeleteLayer, Handle: h})
+	return err
+}
+
+// AddBlock 新建空的块定义，再用 Space 为 SpaceBlock 的 AddEntity 向其中添加实体
+func (s *Session) AddBlock(ctx context.Context, b *Block) (Handle, error) {
+	return s.editOne(ctx, &EditOp{Op: EditAddBlock, Block: b})
+}
+
+// DeleteBlock 删除块定义及其中的实体，仍被参照的块定义不能删除
+func (s *Session) DeleteBlock(ctx context.Context, h Handle) error {
+	_, err := s.editOne(ctx, &EditOp{Op: EditDeleteBlock, Handle: h})
+	return err
+}
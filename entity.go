@@ -0,0 +1,43 @@
+package dwg_go
+
+import "github.com/BlockLucky/dwg-go/protocol"
+
+// 图纸数据的类型定义在 protocol 中，与 dwg_service 共用
+
+// Handle 对象句柄
+type Handle = protocol.Handle
+
+const (
+	SpaceModel = protocol.SpaceModel
+	SpacePaper = protocol.SpacePaper
+	SpaceBlock = protocol.SpaceBlock
+)
+
+// 实体颜色号 Entity.Color 中的随块与随层，新建实体时不会替换 0，需要随层时显式设置 ColorByLayer
+const (
+	ColorByBlock = protocol.ColorByBlock
+	ColorByLayer = protocol.ColorByLayer
+)
+
+type Point = protocol.Point
+
+// Bounds 轴对齐包围盒
+type Bounds = protocol.Bounds
+
+// Header 图纸头信息
+type Header = protocol.Header
+
+type Layer = protocol.Layer
+
+// Block 块定义
+type Block = protocol.Block
+
+// Entity 图形实体，几何字段按类型取用：
+// LINE/POINT/TEXT/MTEXT/INSERT/LWPOLYLINE 使用 Points，CIRCLE/ARC 使用 Center 与 Radius
+type Entity = protocol.Entity
+
+// Document 一次性读取的完整图纸
+type Document = protocol.Document
+
+// Warning 恢复模式下读取图纸时遇到的问题，见 ReadOptions
+type Warning = protocol.Warning
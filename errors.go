@@ -0,0 +1,118 @@
+package dwg_go
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/BlockLucky/dwg-go/api/api_rpc"
+	"github.com/BlockLucky/dwg-go/protocol"
+)
+
+// 图纸与服务状态的错误类别，与 dwg_service 的 error_code 一一对应，用 errors.Is 判断；
+// 需要细节时用 errors.As 取 *CorruptError、*LimitError 或 *UnsupportedVersionError
+var (
+	// ErrUnsupportedVersion 图纸版本（或 Convert 的目标版本）不受支持，重试没有意义
+	ErrUnsupportedVersion = protocol.ErrUnsupportedVersion
+	// ErrEncrypted 图纸设置了密码，无法读取
+	ErrEncrypted = protocol.ErrEncrypted
+	// ErrCorrupt 图纸损坏，*CorruptError 给出能定位到的节、偏移与校验和
+	ErrCorrupt = protocol.ErrCorrupt
+	// ErrServiceUnavailable dwg_service 暂时不可用：无法连接、无法启动、熔断中或正在关闭，可以稍后重试
+	ErrServiceUnavailable = protocol.ErrServiceUnavailable
+	// ErrServiceCrashed dwg_service（或其 worker）在处理调用时崩溃，通常是输入文件触发了 LibreDWG 的缺陷；
+	// 服务会自动重启，同一文件反复崩溃后会被直接拒绝
+	ErrServiceCrashed = protocol.ErrServiceCrashed
+	// ErrLimitExceeded 调用超出 dwg_service 的资源限制，*LimitError 给出超出的限制
+	ErrLimitExceeded = protocol.ErrLimitExceeded
+)
+
+// CorruptError 图纸损坏的位置，匹配 ErrCorrupt
+type CorruptError = protocol.CorruptError
+
+// LimitError 超出的资源限制，匹配 ErrLimitExceeded
+type LimitError = protocol.LimitError
+
+// UnsupportedVersionError 不受支持的版本，匹配 ErrUnsupportedVersion
+type UnsupportedVersionError = protocol.UnsupportedVersionError
+
+// ErrIncompatibleService dwg_service 的协议版本与本库不兼容，需要升级其中一方
+var ErrIncompatibleService = errors.New("incompatible dwg_service")
+
+// ErrUnsupportedMethod 当前运行的 dwg_service 不提供该方法，调用没有发出
+var ErrUnsupportedMethod = errors.New("method not supported by dwg_service")
+
+// ErrUnauthorized 远程 dwg_service 要求认证，token 缺失或无效
+var ErrUnauthorized = errors.New("dwg_service unauthorized")
+
+// ErrNoTransaction 会话没有进行中的事务
+var ErrNoTransaction = errors.New("no transaction in progress")
+
+// ErrTransactionActive 会话已有进行中的事务，事务不能嵌套，撤销与重做须在事务外进行
+var ErrTransactionActive = errors.New("transaction in progress")
+
+// ErrTransactionAborted 事务中调用了 Purge 或修复模式的 Audit，事务中的修改已无法回滚，
+// 事务结束时 Commit 或 Rollback 返回该错误
+var ErrTransactionAborted = errors.New("transaction aborted by purge or audit fix")
+
+// ErrNothingToUndo 没有可撤销或重做的修改
+var ErrNothingToUndo = errors.New("nothing to undo or redo")
+
+// ErrCircuitOpen 远程 dwg_service 连续失败，熔断期间调用没有发出；匹配 ErrServiceUnavailable
+var ErrCircuitOpen = fmt.Errorf("%w: circuit breaker open", ErrServiceUnavailable)
+
+// serviceErr dwg_service 返回的错误，同时匹配错误类别（或携带 error_data 的结构化错误）与原始的 *api_rpc.RPCError
+type serviceErr struct {
+	rpc  *api_rpc.RPCError
+	kind error
+}
+
+func (e *serviceErr) Error() string {
+	if prefix := e.kind.Error(); !strings.HasPrefix(e.rpc.Message, prefix) {
+		return prefix + ": " + e.rpc.Message
+	}
+	return e.rpc.Message
+}
+
+func (e *serviceErr) Unwrap() []error {
+	return []error{e.kind, e.rpc}
+}
+
+// serviceError 将 dwg_service 返回的错误码映射为包内的错误
+func serviceError(err error) error {
+	var rpcErr *api_rpc.RPCError
+	if !errors.As(err, &rpcErr) {
+		return err
+	}
+
+	var kind error
+	switch rpcErr.Code {
+	case api_rpc.ErrCodeIncompatible:
+		kind = ErrIncompatibleService
+	case api_rpc.ErrCodeUnauthorized:
+		kind = ErrUnauthorized
+	case api_rpc.ErrCodeCorrupt:
+		kind = errorData(rpcErr, &CorruptError{})
+	case api_rpc.ErrCodeLimitExceeded:
+		kind = errorData(rpcErr, &LimitError{})
+	case api_rpc.ErrCodeUnsupportedVersion:
+		kind = errorData(rpcErr, &UnsupportedVersionError{})
+	default:
+		kind = protocol.CodeError(rpcErr.Code)
+	}
+	if kind == nil {
+		return err
+	}
+	return &serviceErr{rpc: rpcErr, kind: kind}
+}
+
+// errorData 将 error_data 解码到 target；没有 error_data 时返回错误码对应的错误类别
+func errorData[T error](rpcErr *api_rpc.RPCError, target T) error {
+	if rpcErr.Data != nil {
+		if raw, err := json.Marshal(rpcErr.Data); err == nil && json.Unmarshal(raw, target) == nil {
+			return target
+		}
+	}
+	return protocol.CodeError(rpcErr.Code)
+}
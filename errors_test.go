@@ -0,0 +1,79 @@
+package dwg_go
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/BlockLucky/dwg-go/api/api_rpc"
+	"github.com/BlockLucky/dwg-go/protocol"
+)
+
+// sentinels 包内全部可由 error_code 还原的错误类别
+var sentinels = []error{
+	ErrUnsupportedVersion, ErrEncrypted, ErrCorrupt, ErrServiceUnavailable,
+	ErrServiceCrashed, ErrLimitExceeded, ErrIncompatibleService, ErrUnauthorized,
+}
+
+func TestServiceError(t *testing.T) {
+	tests := []struct {
+		code string
+		data interface{}
+		want error
+	}{
+		{protocol.ErrCodeUnsupportedVersion, nil, ErrUnsupportedVersion},
+		{protocol.ErrCodeEncrypted, nil, ErrEncrypted},
+		{protocol.ErrCodeCorrupt, nil, ErrCorrupt},
+		{protocol.ErrCodeServiceUnavailable, nil, ErrServiceUnavailable},
+		{protocol.ErrCodeServiceCrashed, nil, ErrServiceCrashed},
+		{protocol.ErrCodeLimitExceeded, nil, ErrLimitExceeded},
+		{protocol.ErrCodeIncompatible, nil, ErrIncompatibleService},
+		{protocol.ErrCodeUnauthorized, nil, ErrUnauthorized},
+		{protocol.ErrCodeUnsupportedVersion, map[string]interface{}{"version": "AC1009"}, ErrUnsupportedVersion},
+		{protocol.ErrCodeCorrupt, map[string]interface{}{"section": "objects", "offset": 64}, ErrCorrupt},
+		{protocol.ErrCodeLimitExceeded, map[string]interface{}{"limit": "cpu", "max": "10s"}, ErrLimitExceeded},
+		// 未知错误码保持原样
+		{protocol.ErrCodeDefault, nil, nil},
+		{"", nil, nil},
+		{"no_such_code", nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s/%v", tt.code, tt.data != nil), func(t *testing.T) {
+			rpcErr := &api_rpc.RPCError{Code: tt.code, Message: "boom", Data: tt.data}
+			err := serviceError(fmt.Errorf("call: %w", rpcErr))
+
+			var gotRPC *api_rpc.RPCError
+			if !errors.As(err, &gotRPC) || gotRPC != rpcErr {
+				t.Errorf("errors.As(*RPCError) = %v", gotRPC)
+			}
+			for _, s := range sentinels {
+				if matched := errors.Is(err, s); matched != (s == tt.want) {
+					t.Errorf("errors.Is(%v) = %v", s, matched)
+				}
+			}
+			if tt.data == nil {
+				return
+			}
+			var matched bool
+			switch tt.want {
+			case ErrUnsupportedVersion:
+				var e *UnsupportedVersionError
+				matched = errors.As(err, &e) && e.Version == "AC1009"
+			case ErrCorrupt:
+				var e *CorruptError
+				matched = errors.As(err, &e) && e.Section == "objects" && e.Offset == 64
+			case ErrLimitExceeded:
+				var e *LimitError
+				matched = errors.As(err, &e) && e.Limit == "cpu" && e.Max == "10s"
+			}
+			if !matched {
+				t.Errorf("error_data was not decoded: %v", err)
+			}
+		})
+	}
+
+	plain := errors.New("dial failed")
+	if got := serviceError(plain); got != plain {
+		t.Errorf("serviceError(non-RPC error) = %v", got)
+	}
+}
@@ -2,4 +2,8 @@ module github.com/BlockLucky/dwg-go
 
 go 1.25.5
 
-require github.com/gorilla/mux v1.8.1 // indirect
+require (
+	github.com/goccy/go-json v0.11.2
+	github.com/gorilla/mux v1.8.1
+	github.com/gorilla/websocket v1.5.3
+)
@@ -0,0 +1,82 @@
+package dwg_go
+
+import (
+	"context"
+	"errors"
+
+	"github.com/BlockLucky/dwg-go/protocol"
+)
+
+// Object 图纸中的一个对象（实体或非图形对象）及其引用关系
+type Object = protocol.Object
+
+// ObjectRef 对象之间的一条引用
+type ObjectRef = protocol.ObjectRef
+
+// RefKind 引用的类别
+type RefKind = protocol.RefKind
+
+// 引用的类别
+const (
+	RefSoftOwner   = protocol.RefSoftOwner
+	RefHardOwner   = protocol.RefHardOwner
+	RefSoftPointer = protocol.RefSoftPointer
+	RefHardPointer = protocol.RefHardPointer
+)
+
+// SkipChildren 由 Walk 的回调返回，不再遍历当前对象的子对象
+var SkipChildren = errors.New("skip children")
+
+// ObjectByHandle 按句柄读取对象：所有者、子对象、该对象引用的对象与引用它的对象，
+// Children 与 ReferencedBy 最多各返回 1000 条，被截断时 Truncated 为 true
+func (s *Session) ObjectByHandle(ctx context.Context, h Handle) (*Object, error) {
+	obj := &Object{}
+	if err := s.client.call(ctx, protocol.MethodDocObject, &protocol.ObjectParams{Session: s.id, Handle: h}, obj); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+// NamedObjects 命名对象字典，其 Refs 中的 item 为各个字典项（Name 为键）
+func (s *Session) NamedObjects(ctx context.Context) (*Object, error) {
+	return s.ObjectByHandle(ctx, 0)
+}
+
+// ReferencesTo 引用 h 的对象，不包括以 h 为所有者的子对象；回答“哪些对象在使用这个图层/块”
+func (s *Session) ReferencesTo(ctx context.Context, h Handle) ([]*ObjectRef, error) {
+	obj, err := s.ObjectByHandle(ctx, h)
+	if err != nil {
+		return nil, err
+	}
+	return obj.ReferencedBy, nil
+}
+
+// Walk 从 root 开始按所有关系深度优先遍历，每个对象一次 RPC；fn 返回 SkipChildren 时跳过其子对象，
+// 返回其它错误时停止遍历并返回该错误
+func (s *Session) Walk(ctx context.Context, root Handle, fn func(obj *Object) error) error {
+	visited := make(map[Handle]bool)
+	var walk func(h Handle) error
+	walk = func(h Handle) error {
+		obj, err := s.ObjectByHandle(ctx, h)
+		if err != nil {
+			return err
+		}
+		if visited[obj.Handle] {
+			return nil
+		}
+		visited[obj.Handle] = true
+
+		if err = fn(obj); err == SkipChildren {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		for _, child := range obj.Children {
+			if err = walk(child); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return walk(root)
+}
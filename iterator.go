@@ -0,0 +1,113 @@
+package dwg_go
+
+import (
+	"context"
+
+	"github.com/BlockLucky/dwg-go/protocol"
+)
+
+// EntityQuery 实体分页查询条件，过滤条件之间为“且”的关系
+type EntityQuery struct {
+	Layers []string
+	Types  []string
+	// Spaces 取值 SpaceModel / SpacePaper / SpaceBlock
+	Spaces []string
+	// BBox 与包围盒相交的实体命中，没有几何范围的实体不参与范围查询
+	BBox *Bounds
+	// PageSize 每页条数，0 使用服务端默认值
+	PageSize int
+	// Cursor 从 Iterator.Cursor 返回的位置继续
+	Cursor string
+}
+
+func (q *EntityQuery) params(session, path, cursor string) *protocol.EntitiesParams {
+	return &protocol.EntitiesParams{
+		Session:  session,
+		Path:     path,
+		Cursor:   cursor,
+		PageSize: q.PageSize,
+		Filter: protocol.EntityFilter{
+			Layers: q.Layers,
+			Types:  q.Types,
+			Spaces: q.Spaces,
+			BBox:   q.BBox,
+		},
+	}
+}
+
+type entityPage = protocol.EntitiesResult
+
+// Iterator 按需逐页拉取实体：
+//
+//	it := client.Entities(ctx, "a.dwg", dwg_go.EntityQuery{Layers: []string{"WALLS"}})
+//	for it.Next() {
+//		fmt.Println(it.Entity().Handle)
+//	}
+//	if err := it.Err(); err != nil {
+//		return err
+//	}
+type Iterator struct {
+	ctx   context.Context
+	fetch func(ctx context.Context, cursor string) (*entityPage, error)
+
+	page    []*Entity
+	pos     int
+	cursor  string
+	started bool
+	current *Entity
+	err     error
+}
+
+func newIterator(ctx context.Context, cursor string, fetch func(ctx context.Context, cursor string) (*entityPage, error)) *Iterator {
+	return &Iterator{ctx: ctx, fetch: fetch, cursor: cursor}
+}
+
+// Next 前进到下一个实体，没有更多实体或出错时返回 false
+func (it *Iterator) Next() bool {
+	for it.pos >= len(it.page) {
+		if it.err != nil || (it.started && it.cursor == "") {
+			it.current = nil
+			return false
+		}
+
+		page, err := it.fetch(it.ctx, it.cursor)
+		it.started = true
+		if err != nil {
+			it.err = err
+			it.current = nil
+			return false
+		}
+		it.page, it.pos, it.cursor = page.Entities, 0, page.NextCursor
+	}
+
+	it.current = it.page[it.pos]
+	it.pos++
+	return true
+}
+
+// Entity 当前实体
+func (it *Iterator) Entity() *Entity {
+	return it.current
+}
+
+// Err 迭代中遇到的错误
+func (it *Iterator) Err() error {
+	return it.err
+}
+
+// Cursor 下一页的游标，当前页消费完后可用于在新的 Iterator 中继续
+func (it *Iterator) Cursor() string {
+	return it.cursor
+}
+
+// Entities 分页读取文件中的实体，dwg_service 在页之间缓存解析结果，文件被修改后游标失效；
+// 多次查询同一图纸时使用 Open 得到的 Session
+func (c *Client) Entities(ctx context.Context, path string, q EntityQuery) *Iterator {
+	return newIterator(ctx, q.Cursor, func(ctx context.Context, cursor string) (*entityPage, error) {
+		page := &entityPage{}
+		if err := c.call(ctx, protocol.MethodEntities, q.params("", path, cursor), page); err != nil {
+			return nil, err
+		}
+		return page, nil
+	})
+}
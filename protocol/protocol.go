@@ -0,0 +1,281 @@
+// Package protocol dwg-go 与 dwg_service 之间的传输格式（BSD 许可，客户端与服务端共用）。
+//
+// 每一帧由头部和正文组成，头部与 LSP 相同：
+//
+//	Content-Length: 123\r\n
+//	Content-Type: application/json\r\n
+//	\r\n
+//	{"jsonrpc":"2.0",...}
+//
+// Content-Type 省略时正文为 JSON-RPC 消息。二进制数据（DWG 文件内容、转换结果）
+// 以 application/octet-stream 帧原样传输，不做 base64 编码：
+//
+//	Content-Length: 1048576\r\n
+//	Content-Type: application/octet-stream\r\n
+//	Request-ID: 7\r\n
+//	Blob-Name: input\r\n
+//	\r\n
+//	<1048576 字节>
+//
+// 二进制帧总在它所属的请求或响应（id 等于 Request-ID）之前发送。超过 BlobChunkSize 的
+// 二进制数据拆分为多个 Request-ID、Blob-Name 相同的帧依次发送，接收方按顺序拼接。
+package protocol
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 帧头部
+const (
+	HeaderContentLength = "Content-Length"
+	HeaderContentType   = "Content-Type"
+	HeaderRequestID     = "Request-ID"
+	HeaderBlobName      = "Blob-Name"
+)
+
+// 帧类型
+const (
+	ContentTypeJSON = "application/json"
+	ContentTypeBlob = "application/octet-stream"
+)
+
+const (
+	// MaxFrameSize 单帧正文的最大长度
+	MaxFrameSize = 1 << 30
+	// BlobChunkSize 二进制数据每帧的最大长度
+	BlobChunkSize = 16 << 20
+	// MaxBlobSize 一段二进制数据拼接后的最大长度
+	MaxBlobSize = 4 << 30
+)
+
+// Assembler 暂存的二进制数据：最多 maxPendingRequests 个请求，超过 pendingBlobTTL 没有
+// 收到新帧也没有被取走的数据被丢弃
+const (
+	maxPendingRequests = 64
+	pendingBlobTTL     = 5 * time.Minute
+)
+
+var ErrFrameTooLarge = errors.New("protocol: frame too large")
+
+// Frame 一帧数据；RequestID/BlobName 只用于二进制帧
+type Frame struct {
+	ContentType string
+	RequestID   string
+	BlobName    string
+	Body        []byte
+}
+
+// IsBlob 是否为二进制帧
+func (f *Frame) IsBlob() bool {
+	return f.ContentType == ContentTypeBlob
+}
+
+// Reader 从字节流中逐帧读取
+type Reader struct {
+	r *textproto.Reader
+}
+
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: textproto.NewReader(bufio.NewReaderSize(r, 64<<10))}
+}
+
+// Read 读取下一帧，流在帧边界结束时返回 io.EOF
+func (fr *Reader) Read() (*Frame, error) {
+	header, err := fr.r.ReadMIMEHeader()
+	if err != nil {
+		if err == io.EOF && len(header) == 0 {
+			return nil, io.EOF
+		}
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, fmt.Errorf("protocol: read header: %w", err)
+	}
+
+	length, err := strconv.ParseInt(header.Get(HeaderContentLength), 10, 64)
+	if err != nil || length < 0 {
+		return nil, fmt.Errorf("protocol: invalid %s %q", HeaderContentLength, header.Get(HeaderContentLength))
+	}
+	if length > MaxFrameSize {
+		return nil, ErrFrameTooLarge
+	}
+
+	f := &Frame{
+		ContentType: header.Get(HeaderContentType),
+		RequestID:   header.Get(HeaderRequestID),
+		BlobName:    header.Get(HeaderBlobName),
+	}
+	if f.ContentType == "" {
+		f.ContentType = ContentTypeJSON
+	}
+	if f.IsBlob() && length > BlobChunkSize {
+		return nil, ErrFrameTooLarge
+	}
+	if f.Body, err = readBody(fr.r.R, length); err != nil {
+		return nil, fmt.Errorf("protocol: read body: %w", err)
+	}
+	return f, nil
+}
+
+// readBody 读取 length 字节的正文；缓冲区随实际读到的数据增长，不会按头部声明的长度预先分配
+func readBody(r io.Reader, length int64) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.Grow(int(min(length, 64<<10)))
+	n, err := io.CopyN(&buf, r, length)
+	if n < length {
+		if err == nil || err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Writer 逐条写出消息，可以被多个 goroutine 同时使用
+type Writer struct {
+	lock sync.Mutex
+	w    *bufio.Writer
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: bufio.NewWriterSize(w, 64<<10)}
+}
+
+// WriteMessage 写出一条 JSON-RPC 消息；blobs 非空时先以 requestID 写出其中的二进制帧，
+// 超过 BlobChunkSize 的数据拆分为多个帧，二进制帧与消息之间不会插入其他帧
+func (fw *Writer) WriteMessage(requestID string, blobs map[string][]byte, v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if len(body) > MaxFrameSize {
+		return ErrFrameTooLarge
+	}
+	for name, data := range blobs {
+		if int64(len(data)) > MaxBlobSize {
+			return fmt.Errorf("%w: blob %s", ErrFrameTooLarge, name)
+		}
+		if !validToken(requestID) || !validToken(name) {
+			return fmt.Errorf("protocol: invalid blob name %q", name)
+		}
+	}
+
+	fw.lock.Lock()
+	defer fw.lock.Unlock()
+	for name, data := range blobs {
+		for first := true; first || len(data) > 0; first = false {
+			chunk := data[:min(len(data), BlobChunkSize)]
+			data = data[len(chunk):]
+			fmt.Fprintf(fw.w, "%s: %d\r\n%s: %s\r\n%s: %s\r\n%s: %s\r\n\r\n",
+				HeaderContentLength, len(chunk),
+				HeaderContentType, ContentTypeBlob,
+				HeaderRequestID, requestID,
+				HeaderBlobName, name)
+			if _, err = fw.w.Write(chunk); err != nil {
+				return err
+			}
+		}
+	}
+	fmt.Fprintf(fw.w, "%s: %d\r\n\r\n", HeaderContentLength, len(body))
+	if _, err = fw.w.Write(body); err != nil {
+		return err
+	}
+	return fw.w.Flush()
+}
+
+// validToken 头部取值不能为空，也不能包含换行
+func validToken(s string) bool {
+	return s != "" && !strings.ContainsAny(s, "\r\n")
+}
+
+// Assembler 收集先于消息到达的二进制帧，按 Request-ID 归组，同名的帧按到达顺序拼接。
+// 消息迟迟不到的数据在暂存超过 pendingBlobTTL，或暂存的请求超过 maxPendingRequests 时被丢弃
+type Assembler struct {
+	pending map[string]*pendingBlobs
+	now     func() time.Time
+}
+
+type pendingBlobs struct {
+	blobs   map[string][]byte
+	err     error
+	updated time.Time
+}
+
+func NewAssembler() *Assembler {
+	return &Assembler{pending: make(map[string]*pendingBlobs), now: time.Now}
+}
+
+// Add 暂存一个二进制帧；拼接后超过 MaxBlobSize 时丢弃该请求的数据，Take 返回错误
+func (a *Assembler) Add(f *Frame) {
+	now := a.now()
+	a.expire(now)
+
+	p := a.pending[f.RequestID]
+	if p == nil {
+		if len(a.pending) >= maxPendingRequests {
+			a.dropOldest()
+		}
+		p = &pendingBlobs{blobs: make(map[string][]byte)}
+		a.pending[f.RequestID] = p
+	}
+	p.updated = now
+	if p.err != nil {
+		return
+	}
+	data := p.blobs[f.BlobName]
+	if int64(len(data))+int64(len(f.Body)) > MaxBlobSize {
+		p.blobs, p.err = nil, fmt.Errorf("%w: blob %s", ErrFrameTooLarge, f.BlobName)
+		return
+	}
+	if data == nil {
+		data = f.Body
+	} else {
+		data = append(data, f.Body...)
+	}
+	p.blobs[f.BlobName] = data
+}
+
+// Take 取出属于 requestID 的二进制数据；数据超过 MaxBlobSize 时返回错误
+func (a *Assembler) Take(requestID string) (map[string][]byte, error) {
+	a.expire(a.now())
+	p := a.pending[requestID]
+	delete(a.pending, requestID)
+	if p == nil {
+		return nil, nil
+	}
+	return p.blobs, p.err
+}
+
+// Pending 暂存数据的请求数
+func (a *Assembler) Pending() int {
+	return len(a.pending)
+}
+
+func (a *Assembler) expire(now time.Time) {
+	for id, p := range a.pending {
+		if now.Sub(p.updated) > pendingBlobTTL {
+			delete(a.pending, id)
+		}
+	}
+}
+
+func (a *Assembler) dropOldest() {
+	var oldest *pendingBlobs
+	var oldestID string
+	for id, p := range a.pending {
+		if oldest == nil || p.updated.Before(oldest.updated) {
+			oldest, oldestID = p, id
+		}
+	}
+	delete(a.pending, oldestID)
+}
@@ -0,0 +1,83 @@
+package protocol
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// SessionInfo doc.open 的结果，Warnings 为恢复模式下打开图纸时的问题，只在 doc.open 的结果中出现
+type SessionInfo struct {
+	ID       string     `json:"session"`
+	Path     string     `json:"path"`
+	Memory   int64      `json:"memory"`
+	OpenedAt time.Time  `json:"opened_at"`
+	LastUsed time.Time  `json:"last_used"`
+	ExpireAt time.Time  `json:"expire_at"`
+	Warnings []*Warning `json:"warnings,omitempty"`
+}
+
+// WorkerStats worker.stats 的结果
+type WorkerStats struct {
+	Sessions int `json:"sessions"`
+}
+
+// WorkerInfo 单个 worker 的状态
+type WorkerInfo struct {
+	Slot      int       `json:"slot"`
+	PID       int       `json:"pid"`
+	State     string    `json:"state"`
+	Requests  int64     `json:"requests"`
+	RSS       int64     `json:"rss"`
+	Sessions  int       `json:"sessions"`
+	StartedAt time.Time `json:"started_at"`
+}
+
+// PoolStats pool.stats 的结果
+type PoolStats struct {
+	Workers  []WorkerInfo `json:"workers"`
+	Waiting  int          `json:"waiting"`
+	Requests int64        `json:"requests"`
+	Recycled int64        `json:"recycled"`
+	Crashed  int64        `json:"crashed"`
+	// Killed 因超出资源限制，或调用取消后没有及时结束而被结束的 worker 数
+	Killed int64 `json:"killed"`
+}
+
+// 隔离原因，即 QuarantineEntry.Reason 的取值
+const (
+	QuarantineCrash   = "crash"
+	QuarantineTimeout = "timeout"
+	QuarantineLimit   = "limit"
+)
+
+// QuarantineEntry 隔离区中的复现包，ID 为输入文件的 sha256，同一文件再次出问题时累加 Count
+type QuarantineEntry struct {
+	ID     string `json:"id"`
+	File   string `json:"file"`
+	Size   int64  `json:"size"`
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
+	// Limit 原因为 timeout 或 limit 时超出的限制
+	Limit     string          `json:"limit,omitempty"`
+	Method    string          `json:"method"`
+	Params    json.RawMessage `json:"params,omitempty"`
+	LibreDWG  string          `json:"libredwg_commit"`
+	Signal    string          `json:"signal,omitempty"`
+	ExitState string          `json:"exit_state,omitempty"`
+	Stderr    string          `json:"stderr_tail,omitempty"`
+	Count     int             `json:"count"`
+	FirstAt   time.Time       `json:"first_at"`
+	LastAt    time.Time       `json:"last_at"`
+	// Bundle 复现包目录
+	Bundle string `json:"bundle"`
+}
+
+// QuarantineParams admin.quarantine.get/admin.quarantine.purge 参数，purge 不传 ID 时清空隔离区
+type QuarantineParams struct {
+	ID string `json:"id,omitempty"`
+}
+
+// QuarantinePurgeResult admin.quarantine.purge 的结果
+type QuarantinePurgeResult struct {
+	Purged []string `json:"purged"`
+}
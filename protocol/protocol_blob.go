@@ -0,0 +1,79 @@
+package protocol
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrNoBlobSink 当前调用不是经由帧传输发起的（例如 HTTP），无法返回二进制数据
+var ErrNoBlobSink = errors.New("protocol: binary payloads require the framed stdio transport")
+
+type blobsKey struct{}
+
+type sinkKey struct{}
+
+// WithBlobs 调用携带的二进制数据：服务端用于传入请求，客户端用于随请求发出
+func WithBlobs(ctx context.Context, blobs map[string][]byte) context.Context {
+	if len(blobs) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, blobsKey{}, blobs)
+}
+
+// Blobs 调用携带的全部二进制数据
+func Blobs(ctx context.Context) map[string][]byte {
+	blobs, _ := ctx.Value(blobsKey{}).(map[string][]byte)
+	return blobs
+}
+
+// Blob 按名称取出调用携带的二进制数据
+func Blob(ctx context.Context, name string) ([]byte, bool) {
+	data, ok := Blobs(ctx)[name]
+	return data, ok
+}
+
+// BlobSink 收集调用结果附带的二进制数据
+type BlobSink struct {
+	lock  sync.Mutex
+	blobs map[string][]byte
+}
+
+// WithBlobSink 服务端为每个请求创建，客户端需要接收响应中的二进制数据时创建
+func WithBlobSink(ctx context.Context) (context.Context, *BlobSink) {
+	sink := &BlobSink{}
+	return context.WithValue(ctx, sinkKey{}, sink), sink
+}
+
+// Add 添加一段二进制数据，同名时覆盖
+func (s *BlobSink) Add(name string, data []byte) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.blobs == nil {
+		s.blobs = make(map[string][]byte)
+	}
+	s.blobs[name] = data
+}
+
+// Blobs 已收集的二进制数据
+func (s *BlobSink) Blobs() map[string][]byte {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.blobs
+}
+
+// BlobSinkFrom 取出调用的 BlobSink，没有时返回 nil
+func BlobSinkFrom(ctx context.Context) *BlobSink {
+	sink, _ := ctx.Value(sinkKey{}).(*BlobSink)
+	return sink
+}
+
+// AttachBlob 将二进制数据附加到调用结果中
+func AttachBlob(ctx context.Context, name string, data []byte) error {
+	sink := BlobSinkFrom(ctx)
+	if sink == nil {
+		return ErrNoBlobSink
+	}
+	sink.Add(name, data)
+	return nil
+}
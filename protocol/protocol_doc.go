@@ -0,0 +1,175 @@
+package protocol
+
+// WriteParams doc.write 参数，将会话中的图纸（包括审计修复与编辑的结果）写为 DWG 或 DXF；
+// Format 为空时按 Output 扩展名推断，不是 .dxf 时写为 DWG；Release 为空时沿用图纸原来的版本
+type WriteParams struct {
+	Session string `json:"session"`
+	Output  string `json:"output"`
+	Format  string `json:"format,omitempty"`
+	Release string `json:"release,omitempty"`
+}
+
+// AuditParams dwg.audit 参数，Session 与 Path 二选一；Fix 只能用于会话，修复常驻的图纸
+type AuditParams struct {
+	Session string `json:"session,omitempty"`
+	Path    string `json:"path,omitempty"`
+	Fix     bool   `json:"fix,omitempty"`
+}
+
+// AuditKind 审计问题的类别
+type AuditKind string
+
+const (
+	// AuditBrokenOwner 所有者句柄不存在，或实体的所有者不是块
+	AuditBrokenOwner AuditKind = "broken_owner"
+	// AuditDanglingHandle 反应器或扩展字典引用了不存在的对象
+	AuditDanglingHandle AuditKind = "dangling_handle"
+	// AuditDuplicateHandle 多个对象使用同一个句柄
+	AuditDuplicateHandle AuditKind = "duplicate_handle"
+	// AuditBadHandseed $HANDSEED 不大于已使用的最大句柄
+	AuditBadHandseed AuditKind = "bad_handseed"
+	// AuditMissingTableEntry 实体引用的图层或线型不存在
+	AuditMissingTableEntry AuditKind = "missing_table_entry"
+	// AuditInvalidBlockRef 块参照引用的块定义不存在
+	AuditInvalidBlockRef AuditKind = "invalid_block_ref"
+)
+
+// AuditIssue 审计发现的问题，Handle 为出问题的对象，Ref 为它引用的句柄；Fixed 表示已修复
+type AuditIssue struct {
+	Kind    AuditKind `json:"kind"`
+	Handle  Handle    `json:"handle,omitempty"`
+	Type    string    `json:"type,omitempty"`
+	Ref     Handle    `json:"ref,omitempty"`
+	Message string    `json:"message"`
+	Fixed   bool      `json:"fixed,omitempty"`
+}
+
+// AuditResult dwg.audit 的结果
+type AuditResult struct {
+	Issues []*AuditIssue `json:"issues"`
+	Fixed  int           `json:"fixed"`
+}
+
+// PurgeType 可清理的命名对象类别
+type PurgeType string
+
+const (
+	PurgeLayers     PurgeType = "layer"
+	PurgeLinetypes  PurgeType = "ltype"
+	PurgeTextStyles PurgeType = "style"
+	PurgeDimStyles  PurgeType = "dimstyle"
+	PurgeBlocks     PurgeType = "block"
+	PurgeAppIDs     PurgeType = "appid"
+)
+
+// PurgeParams doc.purge 参数。Types 为空时清理全部类别；Keep 按类别给出不清理的名称，
+// 支持 * 与 ? 通配符，不区分大小写；DryRun 为 true 时只返回将被清理的对象，不修改图纸
+type PurgeParams struct {
+	Session string                 `json:"session"`
+	Types   []PurgeType            `json:"types,omitempty"`
+	Keep    map[PurgeType][]string `json:"keep,omitempty"`
+	DryRun  bool                   `json:"dry_run,omitempty"`
+}
+
+// PurgedObject 被清理（DryRun 时为将被清理）的命名对象
+type PurgedObject struct {
+	Type   PurgeType `json:"type"`
+	Handle Handle    `json:"handle"`
+	Name   string    `json:"name"`
+}
+
+// PurgeResult doc.purge 的结果，Objects 为删除的对象总数，包括块定义中的实体
+type PurgeResult struct {
+	Purged  []*PurgedObject `json:"purged"`
+	Objects int             `json:"objects"`
+	DryRun  bool            `json:"dry_run,omitempty"`
+}
+
+// ObjectParams doc.object 参数，Handle 为 0 时返回命名对象字典；
+// Limit 限制 Children 与 ReferencedBy 各自的条数，0 为默认的 1000
+type ObjectParams struct {
+	Session string `json:"session"`
+	Handle  Handle `json:"handle,omitempty"`
+	Limit   int    `json:"limit,omitempty"`
+}
+
+// RefKind 引用的类别，由句柄码决定
+type RefKind string
+
+const (
+	RefSoftOwner   RefKind = "soft_owner"
+	RefHardOwner   RefKind = "hard_owner"
+	RefSoftPointer RefKind = "soft_pointer"
+	RefHardPointer RefKind = "hard_pointer"
+)
+
+// ObjectRef 对象之间的一条引用。Object.Refs 中 Handle 为被引用的对象，
+// Object.ReferencedBy 中 Handle 为引用方，引用方为 0 表示头变量；Name 为字典项的键
+type ObjectRef struct {
+	Field  string  `json:"field"`
+	Kind   RefKind `json:"kind"`
+	Handle Handle  `json:"handle"`
+	Type   string  `json:"type,omitempty"`
+	Name   string  `json:"name,omitempty"`
+}
+
+// Object doc.object 的结果。Children 为所有者是该对象的对象，ReferencedBy 不再重复列出这些所有者引用；
+// Truncated 表示 Children 或 ReferencedBy 超过 Limit 被截断
+type Object struct {
+	Handle       Handle       `json:"handle"`
+	Type         string       `json:"type"`
+	Name         string       `json:"name,omitempty"`
+	Owner        Handle       `json:"owner,omitempty"`
+	Entity       *Entity      `json:"entity,omitempty"`
+	Refs         []*ObjectRef `json:"refs"`
+	Children     []Handle     `json:"children"`
+	ReferencedBy []*ObjectRef `json:"referenced_by"`
+	Truncated    bool         `json:"truncated,omitempty"`
+}
+
+// EditOpKind 编辑操作的类别
+type EditOpKind string
+
+const (
+	EditAddEntity    EditOpKind = "add_entity"
+	EditModifyEntity EditOpKind = "modify_entity"
+	EditDeleteEntity EditOpKind = "delete_entity"
+	EditAddLayer     EditOpKind = "add_layer"
+	EditModifyLayer  EditOpKind = "modify_layer"
+	EditDeleteLayer  EditOpKind = "delete_layer"
+	EditAddBlock     EditOpKind = "add_block"
+	EditDeleteBlock  EditOpKind = "delete_block"
+	EditRestore      EditOpKind = "restore"
+)
+
+// EditOp 一个编辑操作。
+//
+// add_* 按 Entity、Layer 或 Block 新建对象，Handle 非 0 时使用该句柄（不能已被使用），否则自动分配；
+// 新建实体按 Space 与 Block 放入模型空间、图纸空间或块定义，Space 为空时为模型空间；
+// 新建实体的 Color 与读出时相同，ColorByBlock 随块、ColorByLayer 随层；新建图层 Color 为 0 时为 7。
+// modify_* 用 Entity 或 Layer 整体替换 Handle 对象的属性，通常先读出再改写，实体所在的空间不变。
+// delete_* 删除 Handle 对象，仍被使用的图层与块定义不能删除；对象数据保留到会话关闭、清理或审计修复。
+// restore 原样放回本会话中被 delete_* 删除的 Handle 对象，由 EditResult.Undo 生成，只在同一会话中有效
+type EditOp struct {
+	Op     EditOpKind `json:"op"`
+	Handle Handle     `json:"handle,omitempty"`
+	Entity *Entity    `json:"entity,omitempty"`
+	Layer  *Layer     `json:"layer,omitempty"`
+	Block  *Block     `json:"block,omitempty"`
+}
+
+// EditParams doc.edit 参数，操作按顺序执行；任一操作失败时已执行的操作被撤销，图纸保持调用前的状态
+type EditParams struct {
+	Session string    `json:"session"`
+	Ops     []*EditOp `json:"ops"`
+}
+
+// EditResult doc.edit 的结果，Handles 与 Ops 一一对应，为新建、修改或删除的对象句柄；
+// HandSeed 为编辑后的 $HANDSEED。Applied 为实际执行的操作，新建操作带上分配到的句柄，
+// 在同一图纸的另一份副本上重放会得到相同的句柄；Undo 按顺序执行可撤销本次编辑
+type EditResult struct {
+	Handles  []Handle  `json:"handles"`
+	HandSeed Handle    `json:"handseed"`
+	Applied  []*EditOp `json:"applied"`
+	Undo     []*EditOp `json:"undo"`
+}
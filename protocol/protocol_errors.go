@@ -0,0 +1,116 @@
+package protocol
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// 错误类别：dwg_service 的方法返回（或包装）这些错误，响应中的 error_code 与之一一对应，
+// 客户端再按 error_code 还原，调用方用 errors.Is 判断
+var (
+	ErrUnsupportedVersion = errors.New("unsupported drawing version")
+	ErrEncrypted          = errors.New("drawing is password protected")
+	ErrCorrupt            = errors.New("drawing is corrupt")
+	ErrServiceUnavailable = errors.New("dwg_service unavailable")
+	ErrServiceCrashed     = errors.New("dwg_service crashed")
+	ErrLimitExceeded      = errors.New("limit exceeded")
+)
+
+var codeErrors = []struct {
+	code string
+	err  error
+}{
+	{ErrCodeUnsupportedVersion, ErrUnsupportedVersion},
+	{ErrCodeEncrypted, ErrEncrypted},
+	{ErrCodeCorrupt, ErrCorrupt},
+	{ErrCodeServiceUnavailable, ErrServiceUnavailable},
+	{ErrCodeServiceCrashed, ErrServiceCrashed},
+	{ErrCodeLimitExceeded, ErrLimitExceeded},
+}
+
+// ErrorCode 错误对应的 error_code，不属于任何类别时返回 ErrCodeDefault
+func ErrorCode(err error) string {
+	for _, c := range codeErrors {
+		if errors.Is(err, c.err) {
+			return c.code
+		}
+	}
+	return ErrCodeDefault
+}
+
+// CodeError error_code 对应的错误类别，没有对应类别时返回 nil
+func CodeError(code string) error {
+	for _, c := range codeErrors {
+		if c.code == code {
+			return c.err
+		}
+	}
+	return nil
+}
+
+// UnsupportedVersionError 图纸版本不受支持，作为 unsupported_version 错误的 error_data
+type UnsupportedVersionError struct {
+	Version string `json:"version"`
+}
+
+func (e *UnsupportedVersionError) Error() string {
+	return fmt.Sprintf("%v: %s", ErrUnsupportedVersion, e.Version)
+}
+
+func (e *UnsupportedVersionError) Unwrap() error {
+	return ErrUnsupportedVersion
+}
+
+// CorruptError 图纸损坏的位置，作为 corrupt 错误的 error_data；
+// Section/Offset 为空表示无法定位，ExpectedCRC/ActualCRC 只在校验和不符时有值
+type CorruptError struct {
+	Section     string `json:"section,omitempty"`
+	Offset      int64  `json:"offset,omitempty"`
+	ExpectedCRC uint32 `json:"expected_crc,omitempty"`
+	ActualCRC   uint32 `json:"actual_crc,omitempty"`
+	Detail      string `json:"detail,omitempty"`
+}
+
+// CRCMismatch 是否为校验和不符
+func (e *CorruptError) CRCMismatch() bool {
+	return e.ExpectedCRC != e.ActualCRC
+}
+
+func (e *CorruptError) Error() string {
+	var parts []string
+	if e.Section != "" {
+		parts = append(parts, "section "+e.Section)
+	}
+	if e.Offset > 0 {
+		parts = append(parts, fmt.Sprintf("offset 0x%x", e.Offset))
+	}
+	if e.CRCMismatch() {
+		parts = append(parts, fmt.Sprintf("CRC mismatch (expected 0x%04x, got 0x%04x)", e.ExpectedCRC, e.ActualCRC))
+	}
+	if e.Detail != "" {
+		parts = append(parts, e.Detail)
+	}
+	if len(parts) == 0 {
+		return ErrCorrupt.Error()
+	}
+	return ErrCorrupt.Error() + ": " + strings.Join(parts, ", ")
+}
+
+func (e *CorruptError) Unwrap() error {
+	return ErrCorrupt
+}
+
+// LimitError 调用超出资源限制，作为 limit_exceeded 错误的 error_data
+type LimitError struct {
+	Limit string `json:"limit"`
+	Max   string `json:"max"`
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s limit exceeded (max %s)", e.Limit, e.Max)
+}
+
+func (e *LimitError) Unwrap() error {
+	return ErrLimitExceeded
+}
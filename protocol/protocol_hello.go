@@ -0,0 +1,60 @@
+package protocol
+
+import (
+	"fmt"
+	"slices"
+)
+
+// HelloParams service.hello 参数，可以省略
+type HelloParams struct {
+	ClientVersion      string `json:"client_version,omitempty"`
+	ProtocolVersion    int    `json:"protocol_version,omitempty"`
+	MinProtocolVersion int    `json:"min_protocol_version,omitempty"`
+}
+
+// HelloResult service.hello 的结果。Methods 为当前连接上可以调用的方法，
+// InputFormats/OutputFormats 为 dwg.read 与 dwg.convert 支持的格式，Releases 为 dwg.convert 可写出的 DWG 版本
+type HelloResult struct {
+	ServiceVersion     string       `json:"service_version"`
+	ProtocolVersion    int          `json:"protocol_version"`
+	MinProtocolVersion int          `json:"min_protocol_version"`
+	LibreDWGVersion    string       `json:"libredwg_version"`
+	LibreDWGCommit     string       `json:"libredwg_commit"`
+	Methods            []string     `json:"methods"`
+	InputFormats       []string     `json:"input_formats"`
+	OutputFormats      []string     `json:"output_formats"`
+	Releases           []string     `json:"releases"`
+	Capabilities       []Capability `json:"capabilities"`
+}
+
+// HasMethod 服务端是否提供该方法
+func (h *HelloResult) HasMethod(method string) bool {
+	return slices.Contains(h.Methods, method)
+}
+
+// HasCapability 服务端是否具备该能力
+func (h *HelloResult) HasCapability(c Capability) bool {
+	return slices.Contains(h.Capabilities, c)
+}
+
+// VersionError 双方支持的协议版本没有交集
+type VersionError struct {
+	Local  [2]int
+	Remote [2]int
+}
+
+func (e *VersionError) Error() string {
+	return fmt.Sprintf("protocol version mismatch: local supports %d-%d, remote supports %d-%d",
+		e.Local[0], e.Local[1], e.Remote[0], e.Remote[1])
+}
+
+// CheckVersion 对端支持 [min, max] 时检查与本端是否兼容，min 为 0 时视为与 max 相同
+func CheckVersion(min, max int) error {
+	if min <= 0 {
+		min = max
+	}
+	if max < MinVersion || min > Version {
+		return &VersionError{Local: [2]int{MinVersion, Version}, Remote: [2]int{min, max}}
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package protocol
+
+import "time"
+
+// JobSubmitParams job.submit 参数，设置 callback_url 后任务结束时回调，callback_secret 用于签名
+type JobSubmitParams struct {
+	Method         string        `json:"method"`
+	Params         []interface{} `json:"params"`
+	CallbackURL    string        `json:"callback_url,omitempty"`
+	CallbackSecret string        `json:"callback_secret,omitempty"`
+}
+
+// JobParams job.get/job.deliveries/job.subscribe/job.unsubscribe 参数
+type JobParams struct {
+	JobID string `json:"job_id"`
+}
+
+type JobStatus string
+
+const (
+	JobPending   JobStatus = "pending"
+	JobRunning   JobStatus = "running"
+	JobSucceeded JobStatus = "succeeded"
+	JobFailed    JobStatus = "failed"
+)
+
+// Finished 是否为终止状态
+func (s JobStatus) Finished() bool {
+	return s == JobSucceeded || s == JobFailed
+}
+
+type JobEventType string
+
+const (
+	JobEventProgress JobEventType = "progress"
+	JobEventLog      JobEventType = "log"
+	JobEventStatus   JobEventType = "status"
+)
+
+// JobEvent 任务事件，进度/日志/状态共用；NotifyProgress/NotifyLog 通知的参数也是该结构
+type JobEvent struct {
+	JobID          string       `json:"job_id,omitempty"`
+	Seq            int64        `json:"seq,omitempty"`
+	Type           JobEventType `json:"type"`
+	Stage          string       `json:"stage,omitempty"`
+	ObjectsDecoded int64        `json:"objects_decoded,omitempty"`
+	ObjectsTotal   int64        `json:"objects_total,omitempty"`
+	Level          string       `json:"level,omitempty"`
+	Message        string       `json:"message,omitempty"`
+	Status         JobStatus    `json:"status,omitempty"`
+	Time           time.Time    `json:"time"`
+}
+
+// JobInfo job.submit/job.get 的结果，任务快照
+type JobInfo struct {
+	ID         string      `json:"id"`
+	Method     string      `json:"method"`
+	Status     JobStatus   `json:"status"`
+	Result     interface{} `json:"result,omitempty"`
+	Error      string      `json:"error,omitempty"`
+	ErrorCode  string      `json:"error_code,omitempty"`
+	Progress   *JobEvent   `json:"progress,omitempty"`
+	Callback   string      `json:"callback_url,omitempty"`
+	CreatedAt  time.Time   `json:"created_at"`
+	StartedAt  *time.Time  `json:"started_at,omitempty"`
+	FinishedAt *time.Time  `json:"finished_at,omitempty"`
+}
+
+// JobDelivery job.deliveries 结果中的一次回调投递
+type JobDelivery struct {
+	ID         string        `json:"id"`
+	JobID      string        `json:"job_id"`
+	URL        string        `json:"url"`
+	Attempt    int           `json:"attempt"`
+	StatusCode int           `json:"status_code,omitempty"`
+	Error      string        `json:"error,omitempty"`
+	Success    bool          `json:"success"`
+	Time       time.Time     `json:"time"`
+	Duration   time.Duration `json:"duration"`
+}
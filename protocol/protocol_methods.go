@@ -0,0 +1,114 @@
+package protocol
+
+// Version 协议版本：方法参数或结果发生不兼容的变化时加一，新增方法或可选字段不变。
+// MinVersion 为本端仍能兼容的最老版本，双方的 [MinVersion, Version] 有交集才能通信
+const (
+	Version    = 1
+	MinVersion = 1
+)
+
+// MethodHello 建立连接后首先调用，交换版本与能力
+const MethodHello = "service.hello"
+
+// 图纸方法，dwg.* 每次调用解析一次文件，doc.* 作用于 doc.open 打开的常驻会话
+const (
+	MethodRead        = "dwg.read"
+	MethodConvert     = "dwg.convert"
+	MethodEntities    = "dwg.entities"
+	MethodStream      = "dwg.stream"
+	MethodDocOpen     = "doc.open"
+	MethodDocClose    = "doc.close"
+	MethodDocHeader   = "doc.header"
+	MethodDocLayers   = "doc.layers"
+	MethodDocBlocks   = "doc.blocks"
+	MethodDocEntities = "doc.entities"
+	MethodDocWrite    = "doc.write"
+	MethodDocPurge    = "doc.purge"
+	MethodDocObject   = "doc.object"
+	MethodDocEdit     = "doc.edit"
+	MethodDocNew      = "doc.new"
+	MethodAudit       = "dwg.audit"
+)
+
+// 后台任务方法；job.subscribe/job.unsubscribe 只在 WebSocket 连接上可用
+const (
+	MethodJobSubmit      = "job.submit"
+	MethodJobGet         = "job.get"
+	MethodJobDeliveries  = "job.deliveries"
+	MethodJobSubscribe   = "job.subscribe"
+	MethodJobUnsubscribe = "job.unsubscribe"
+)
+
+// 运维方法；worker.stats 是 worker 提供给 supervisor 的内部方法
+const (
+	MethodPoolStats       = "pool.stats"
+	MethodWorkerStats     = "worker.stats"
+	MethodQuarantineList  = "admin.quarantine.list"
+	MethodQuarantineGet   = "admin.quarantine.get"
+	MethodQuarantinePurge = "admin.quarantine.purge"
+)
+
+// 通知名
+const (
+	// NotifyItem 流式方法逐条推送结果
+	NotifyItem = "$/item"
+	// NotifyProgress 方法执行过程中上报进度
+	NotifyProgress = "$/progress"
+	// NotifyLog 方法执行过程中上报日志
+	NotifyLog = "$/log"
+	// NotifyJobEvent 向订阅方推送任务事件
+	NotifyJobEvent = "job.event"
+	// NotifyCancel 调用方取消尚未完成的调用，params 为 [CancelParams]
+	NotifyCancel = "$/cancelRequest"
+	// NotifyWindow 调用方在请求之前发送，params 为 [CreditParams]：
+	// 对端最多先推送 Count 条该调用的通知，之后只在 NotifyCredit 归还的额度内继续推送；
+	// 没有收到 NotifyWindow 的调用不限制通知数量
+	NotifyWindow = "$/window"
+	// NotifyCredit 调用方处理完通知后归还的额度，params 为 [CreditParams]
+	NotifyCredit = "$/credit"
+)
+
+// CancelParams NotifyCancel 的参数，ID 为被取消请求的 id
+type CancelParams struct {
+	ID string `json:"id"`
+}
+
+// CreditParams NotifyWindow 与 NotifyCredit 的参数，ID 为请求的 id
+type CreditParams struct {
+	ID    string `json:"id"`
+	Count int    `json:"count"`
+}
+
+// 错误码，即 error_code 的取值，未归类的错误使用 ErrCodeDefault；
+// 与图纸和服务状态相关的错误码和 protocol_errors.go 中的错误类别一一对应
+const (
+	ErrCodeDefault            = "-1"
+	ErrCodeUnsupportedVersion = "unsupported_version"
+	ErrCodeEncrypted          = "encrypted"
+	ErrCodeCorrupt            = "corrupt"
+	ErrCodeServiceUnavailable = "service_unavailable"
+	ErrCodeServiceCrashed     = "service_crashed"
+	ErrCodeLimitExceeded      = "limit_exceeded"
+	ErrCodeIncompatible       = "incompatible_protocol"
+	ErrCodeUnauthorized       = "unauthorized"
+)
+
+// Capability 服务端可选的能力
+type Capability string
+
+const (
+	// CapBlobs 支持 input_blob/output_blob 二进制帧，只在 stdio 上可用
+	CapBlobs Capability = "blobs"
+	// CapSessions 支持 doc.* 常驻会话
+	CapSessions Capability = "sessions"
+	// CapStream 支持 dwg.stream
+	CapStream Capability = "stream"
+	// CapJobs 支持 job.* 后台任务
+	CapJobs Capability = "jobs"
+	// CapPool 方法在 worker 进程池中执行，支持 pool.stats
+	CapPool Capability = "pool"
+	// CapQuarantine 支持 admin.quarantine.*
+	CapQuarantine Capability = "quarantine"
+	// CapRecover dwg.read/doc.open 支持 recover 恢复模式
+	CapRecover Capability = "recover"
+)
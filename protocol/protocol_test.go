@@ -0,0 +1,174 @@
+package protocol
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteReadMessage(t *testing.T) {
+	big := bytes.Repeat([]byte{0xab}, 2*BlobChunkSize+5)
+	tests := []struct {
+		name  string
+		blobs map[string][]byte
+	}{
+		{"json only", nil},
+		{"empty blob", map[string][]byte{"input": {}}},
+		{"small blob", map[string][]byte{"input": []byte("AC1015\x00\r\n")}},
+		{"chunked blob", map[string][]byte{"input": big}},
+		{"several blobs", map[string][]byte{"a": []byte("1"), "b": []byte("22")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			msg := map[string]string{"jsonrpc": "2.0", "id": "7", "method": "dwg.read"}
+			if err := NewWriter(&buf).WriteMessage("7", tt.blobs, msg); err != nil {
+				t.Fatal(err)
+			}
+
+			fr := NewReader(&buf)
+			a := NewAssembler()
+			var last *Frame
+			for {
+				f, err := fr.Read()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				if f.IsBlob() {
+					if f.RequestID != "7" || len(f.Body) > BlobChunkSize {
+						t.Fatalf("blob frame %s/%s with %d bytes", f.RequestID, f.BlobName, len(f.Body))
+					}
+					a.Add(f)
+					continue
+				}
+				last = f
+			}
+			if last == nil || last.ContentType != ContentTypeJSON || !strings.Contains(string(last.Body), `"dwg.read"`) {
+				t.Fatalf("message frame = %+v", last)
+			}
+
+			got, err := a.Take("7")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.blobs) {
+				t.Fatalf("got %d blobs, want %d", len(got), len(tt.blobs))
+			}
+			for name, want := range tt.blobs {
+				if !bytes.Equal(got[name], want) {
+					t.Errorf("blob %s: got %d bytes, want %d", name, len(got[name]), len(want))
+				}
+			}
+			if a.Pending() != 0 {
+				t.Errorf("assembler still holds %d requests", a.Pending())
+			}
+		})
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  error
+	}{
+		{"empty stream", "", io.EOF},
+		{"missing length", "Content-Type: application/json\r\n\r\n{}", nil},
+		{"negative length", "Content-Length: -1\r\n\r\n", nil},
+		{"frame too large", fmt.Sprintf("Content-Length: %d\r\n\r\n", int64(MaxFrameSize)+1), ErrFrameTooLarge},
+		{"blob chunk too large", fmt.Sprintf("Content-Length: %d\r\nContent-Type: %s\r\n\r\n", BlobChunkSize+1, ContentTypeBlob), ErrFrameTooLarge},
+		{"truncated header", "Content-Length: 2\r\n", io.ErrUnexpectedEOF},
+		{"truncated body", "Content-Length: 10\r\n\r\n{}", io.ErrUnexpectedEOF},
+		// 声明 1 GiB 但只有几个字节时，应在读完已有数据后报错，而不是先分配 1 GiB
+		{"huge declared length", fmt.Sprintf("Content-Length: %d\r\n\r\n{}", MaxFrameSize), io.ErrUnexpectedEOF},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewReader(strings.NewReader(tt.input)).Read()
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteInvalidBlobName(t *testing.T) {
+	tests := []struct {
+		requestID string
+		name      string
+	}{
+		{"", "input"},
+		{"1", ""},
+		{"1", "in\r\nput"},
+		{"1\n", "input"},
+	}
+	for _, tt := range tests {
+		err := NewWriter(io.Discard).WriteMessage(tt.requestID, map[string][]byte{tt.name: {1}}, struct{}{})
+		if err == nil {
+			t.Errorf("WriteMessage(%q, %q) succeeded", tt.requestID, tt.name)
+		}
+	}
+}
+
+func blobFrame(id, name, body string) *Frame {
+	return &Frame{ContentType: ContentTypeBlob, RequestID: id, BlobName: name, Body: []byte(body)}
+}
+
+func TestAssemblerExpiry(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	a := NewAssembler()
+	a.now = func() time.Time { return now }
+
+	a.Add(blobFrame("1", "input", "old"))
+	now = now.Add(pendingBlobTTL / 2)
+	a.Add(blobFrame("2", "input", "new"))
+	now = now.Add(pendingBlobTTL/2 + time.Second)
+
+	tests := []struct {
+		id   string
+		want string
+	}{
+		{"1", ""},
+		{"2", "new"},
+		{"3", ""},
+	}
+	for _, tt := range tests {
+		got, err := a.Take(tt.id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got["input"]) != tt.want {
+			t.Errorf("Take(%s) = %q, want %q", tt.id, got["input"], tt.want)
+		}
+	}
+}
+
+func TestAssemblerCap(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	a := NewAssembler()
+	a.now = func() time.Time { return now }
+
+	for i := 0; i <= maxPendingRequests; i++ {
+		now = now.Add(time.Millisecond)
+		a.Add(blobFrame(fmt.Sprint(i), "input", "x"))
+	}
+	if a.Pending() != maxPendingRequests {
+		t.Fatalf("pending = %d, want %d", a.Pending(), maxPendingRequests)
+	}
+	if got, _ := a.Take("0"); got != nil {
+		t.Error("oldest request was not dropped")
+	}
+	if got, _ := a.Take(fmt.Sprint(maxPendingRequests)); string(got["input"]) != "x" {
+		t.Error("newest request was dropped")
+	}
+}
@@ -0,0 +1,177 @@
+package protocol
+
+// Handle 对象句柄
+type Handle uint64
+
+// 实体所在的空间，即 Entity.Space 的取值
+const (
+	SpaceModel = "model"
+	SpacePaper = "paper"
+	SpaceBlock = "block"
+)
+
+type Point struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+	Z float64 `json:"z"`
+}
+
+// Bounds 轴对齐包围盒
+type Bounds struct {
+	Min Point `json:"min"`
+	Max Point `json:"max"`
+}
+
+// Header 图纸头信息，doc.header 的结果
+type Header struct {
+	Version    string `json:"version"`
+	CodePage   int    `json:"codepage"`
+	InsUnits   int    `json:"insunits"`
+	HandSeed   Handle `json:"handseed"`
+	ExtMin     Point  `json:"extmin"`
+	ExtMax     Point  `json:"extmax"`
+	NumObjects int    `json:"num_objects"`
+}
+
+type Layer struct {
+	Handle Handle `json:"handle"`
+	Name   string `json:"name"`
+	Color  int    `json:"color"`
+	Off    bool   `json:"off,omitempty"`
+	Frozen bool   `json:"frozen,omitempty"`
+	Locked bool   `json:"locked,omitempty"`
+}
+
+// Block 块定义
+type Block struct {
+	Handle      Handle `json:"handle"`
+	Name        string `json:"name"`
+	BasePoint   Point  `json:"base_point"`
+	NumEntities int    `json:"num_entities"`
+}
+
+// 实体颜色号中表示随块与随层的取值，1-255 为索引色
+const (
+	ColorByBlock = 0
+	ColorByLayer = 256
+)
+
+// Entity 图形实体，几何字段按类型取用：
+// LINE/POINT/TEXT/MTEXT/INSERT/LWPOLYLINE 使用 Points，CIRCLE/ARC 使用 Center 与 Radius
+type Entity struct {
+	Handle     Handle  `json:"handle"`
+	Type       string  `json:"type"`
+	Layer      string  `json:"layer"`
+	Space      string  `json:"space"`
+	Block      string  `json:"block,omitempty"`
+	Owner      Handle  `json:"owner,omitempty"`
+	Color      int     `json:"color"`
+	Points     []Point `json:"points,omitempty"`
+	Center     *Point  `json:"center,omitempty"`
+	Radius     float64 `json:"radius,omitempty"`
+	StartAngle float64 `json:"start_angle,omitempty"`
+	EndAngle   float64 `json:"end_angle,omitempty"`
+	Text       string  `json:"text,omitempty"`
+	Height     float64 `json:"height,omitempty"`
+	Rotation   float64 `json:"rotation,omitempty"`
+	Scale      *Point  `json:"scale,omitempty"`
+	Name       string  `json:"name,omitempty"`
+	Closed     bool    `json:"closed,omitempty"`
+	Bounds     *Bounds `json:"bounds,omitempty"`
+}
+
+// ReadParams dwg.read 参数，Path 与 InputBlob 二选一，InputBlob 为请求附带的二进制帧名称；
+// Recover 为 true 时尽量读取损坏的图纸，无法解码的对象以 Warning 返回而不是整体失败
+type ReadParams struct {
+	Path      string `json:"path,omitempty"`
+	InputBlob string `json:"input_blob,omitempty"`
+	Recover   bool   `json:"recover,omitempty"`
+}
+
+// Warning 恢复模式下读取图纸时遇到的问题；Handle 为 0 表示不针对单个对象，
+// Section 为问题所在的节，对象解码失败时为 objects
+type Warning struct {
+	Handle  Handle `json:"handle,omitempty"`
+	Type    string `json:"type,omitempty"`
+	Section string `json:"section,omitempty"`
+	Message string `json:"message"`
+}
+
+// Document dwg.read 的结果，一次性读取的完整图纸；Warnings 只在恢复模式下出现
+type Document struct {
+	Header   *Header    `json:"header"`
+	Layers   []*Layer   `json:"layers"`
+	Blocks   []*Block   `json:"blocks"`
+	Entities []*Entity  `json:"entities"`
+	Warnings []*Warning `json:"warnings,omitempty"`
+}
+
+// ConvertParams dwg.convert 参数，Format 为空时按 Output 扩展名推断。
+// InputBlob/OutputBlob 非空时分别代替 Input/Output：输入来自请求附带的二进制帧，
+// 结果以该名称的二进制帧返回，此时 Format 必填
+type ConvertParams struct {
+	Input      string `json:"input,omitempty"`
+	Output     string `json:"output,omitempty"`
+	Format     string `json:"format,omitempty"`
+	Release    string `json:"release,omitempty"`
+	InputBlob  string `json:"input_blob,omitempty"`
+	OutputBlob string `json:"output_blob,omitempty"`
+}
+
+// ConvertResult dwg.convert 的结果，结果以二进制帧返回时 Output 为空、Blob 为帧名称
+type ConvertResult struct {
+	Output string `json:"output,omitempty"`
+	Blob   string `json:"blob,omitempty"`
+	Format string `json:"format"`
+	Size   int64  `json:"size"`
+}
+
+// EntityFilter 实体过滤条件，条件之间为“且”的关系；
+// BBox 与包围盒相交的实体命中，没有几何范围的实体不参与范围查询
+type EntityFilter struct {
+	Layers []string `json:"layers,omitempty"`
+	Types  []string `json:"types,omitempty"`
+	Spaces []string `json:"spaces,omitempty"`
+	BBox   *Bounds  `json:"bbox,omitempty"`
+}
+
+// EntitiesParams dwg.entities/doc.entities/dwg.stream 参数，Session 与 Path 二选一；
+// dwg.stream 不分页，忽略 Cursor 与 PageSize
+type EntitiesParams struct {
+	Session  string       `json:"session,omitempty"`
+	Path     string       `json:"path,omitempty"`
+	Cursor   string       `json:"cursor,omitempty"`
+	PageSize int          `json:"page_size,omitempty"`
+	Filter   EntityFilter `json:"filter"`
+}
+
+// EntitiesResult 一页实体，NextCursor 为空表示最后一页
+type EntitiesResult struct {
+	Entities   []*Entity `json:"entities"`
+	NextCursor string    `json:"next_cursor,omitempty"`
+}
+
+// StreamResult dwg.stream 的结果，实体本身以 NotifyItem 通知推送
+type StreamResult struct {
+	Count int `json:"count"`
+}
+
+// OpenParams doc.open 参数，Recover 与 ReadParams 相同
+type OpenParams struct {
+	Path    string `json:"path"`
+	Recover bool   `json:"recover,omitempty"`
+}
+
+// NewParams doc.new 参数。Template 为空时新建只含标准表的空图纸，Release 为空时为 r2000，
+// Imperial 为 true 时为英制（$INSUNITS 为英寸），否则为公制（毫米）；Template 不为空时读取 .dwt/.dwg
+// 模板作为新图纸的内容，模板文件不会被修改，Release 不为空时作为写出的默认版本
+type NewParams struct {
+	Release  string `json:"release,omitempty"`
+	Template string `json:"template,omitempty"`
+	Imperial bool   `json:"imperial,omitempty"`
+}
+
+// SessionParams doc.header/doc.layers/doc.blocks/doc.close 参数
+type SessionParams struct {
+	Session string `json:"session"`
+}
@@ -0,0 +1,51 @@
+package dwg_go
+
+import (
+	"context"
+
+	"github.com/BlockLucky/dwg-go/protocol"
+)
+
+// PurgeType 可清理的命名对象类别
+type PurgeType = protocol.PurgeType
+
+// 可清理的命名对象类别
+const (
+	PurgeLayers     = protocol.PurgeLayers
+	PurgeLinetypes  = protocol.PurgeLinetypes
+	PurgeTextStyles = protocol.PurgeTextStyles
+	PurgeDimStyles  = protocol.PurgeDimStyles
+	PurgeBlocks     = protocol.PurgeBlocks
+	PurgeAppIDs     = protocol.PurgeAppIDs
+)
+
+// PurgeOptions 清理参数。Types 为空时清理全部类别；Keep 按类别给出不清理的名称，
+// 支持 * 与 ? 通配符，不区分大小写；DryRun 为 true 时只报告将被清理的对象
+type PurgeOptions struct {
+	Types  []PurgeType
+	Keep   map[PurgeType][]string
+	DryRun bool
+}
+
+// PurgeResult 清理结果
+type PurgeResult = protocol.PurgeResult
+
+// PurgedObject 被清理的命名对象
+type PurgedObject = protocol.PurgedObject
+
+// Purge 删除会话中没有被使用的图层、线型、文字样式、标注样式、块定义与注册应用，
+// 只被清理掉的对象使用的表项也一并清理；结果用 WriteDWG 保存。
+// 清理无法撤销，DryRun 以外的调用清空撤销与重做记录，并中止进行中的事务
+func (s *Session) Purge(ctx context.Context, opts PurgeOptions) (*PurgeResult, error) {
+	if !opts.DryRun {
+		s.history.lock.Lock()
+		defer s.history.lock.Unlock()
+		defer s.history.reset()
+	}
+	result := &PurgeResult{}
+	params := &protocol.PurgeParams{Session: s.id, Types: opts.Types, Keep: opts.Keep, DryRun: opts.DryRun}
+	if err := s.client.call(ctx, protocol.MethodDocPurge, params, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,137 @@
+package dwg_go
+
+import (
+	"context"
+
+	"github.com/BlockLucky/dwg-go/protocol"
+)
+
+// Session 常驻在 dwg_service 中的已解析图纸，用完须 Close
+type Session struct {
+	client   *Client
+	id       string
+	warnings []*Warning
+	history  editHistory
+}
+
+// Open 解析图纸并保持在 dwg_service 中，后续查询不再重复解析
+func (c *Client) Open(ctx context.Context, path string) (*Session, error) {
+	return c.OpenWithOptions(ctx, path, ReadOptions{})
+}
+
+// OpenWithOptions 按 opts 解析图纸并保持在 dwg_service 中
+func (c *Client) OpenWithOptions(ctx context.Context, path string, opts ReadOptions) (*Session, error) {
+	if err := c.requireRecover(protocol.MethodDocOpen, opts); err != nil {
+		return nil, err
+	}
+	info := &protocol.SessionInfo{}
+	if err := c.call(ctx, protocol.MethodDocOpen, &protocol.OpenParams{Path: path, Recover: opts.Recover}, info); err != nil {
+		return nil, err
+	}
+	return &Session{client: c, id: info.ID, warnings: info.Warnings}, nil
+}
+
+// NewOptions 新建图纸的参数。Release 为写出的版本（r13、r14 或 r2000，空时为 r2000）；
+// Imperial 为 true 时为英制图纸（$INSUNITS 为英寸），否则为公制（毫米）
+type NewOptions struct {
+	Release  string
+	Imperial bool
+}
+
+// NewDocument 在 dwg_service 中新建只含标准表的空图纸：图层 0，线型 CONTINUOUS、BYLAYER 与 BYBLOCK，
+// Standard 文字样式与标注样式，*Model_Space 与 *Paper_Space，以及命名对象字典；用完须 Close
+func (c *Client) NewDocument(ctx context.Context, release string) (*Session, error) {
+	return c.NewDocumentWithOptions(ctx, NewOptions{Release: release})
+}
+
+// NewDocumentWithOptions 按 opts 新建空图纸
+func (c *Client) NewDocumentWithOptions(ctx context.Context, opts NewOptions) (*Session, error) {
+	return c.newSession(ctx, &protocol.NewParams{Release: opts.Release, Imperial: opts.Imperial})
+}
+
+// NewFromTemplate 以 .dwt 或 .dwg 模板的内容新建图纸，模板文件不会被修改，结果用 WriteDWG 另存
+func (c *Client) NewFromTemplate(ctx context.Context, path string) (*Session, error) {
+	return c.newSession(ctx, &protocol.NewParams{Template: path})
+}
+
+func (c *Client) newSession(ctx context.Context, params *protocol.NewParams) (*Session, error) {
+	info := &protocol.SessionInfo{}
+	if err := c.call(ctx, protocol.MethodDocNew, params, info); err != nil {
+		return nil, err
+	}
+	return &Session{client: c, id: info.ID}, nil
+}
+
+// ID 会话句柄
+func (s *Session) ID() string {
+	return s.id
+}
+
+// Warnings 恢复模式下打开图纸时遇到的问题
+func (s *Session) Warnings() []*Warning {
+	return s.warnings
+}
+
+func (s *Session) params() *protocol.SessionParams {
+	return &protocol.SessionParams{Session: s.id}
+}
+
+func (s *Session) Header(ctx context.Context) (*Header, error) {
+	header := &Header{}
+	if err := s.client.call(ctx, protocol.MethodDocHeader, s.params(), header); err != nil {
+		return nil, err
+	}
+	return header, nil
+}
+
+func (s *Session) Layers(ctx context.Context) ([]*Layer, error) {
+	var layers []*Layer
+	if err := s.client.call(ctx, protocol.MethodDocLayers, s.params(), &layers); err != nil {
+		return nil, err
+	}
+	return layers, nil
+}
+
+func (s *Session) Blocks(ctx context.Context) ([]*Block, error) {
+	var blocks []*Block
+	if err := s.client.call(ctx, protocol.MethodDocBlocks, s.params(), &blocks); err != nil {
+		return nil, err
+	}
+	return blocks, nil
+}
+
+// Entities 分页读取会话中的实体
+func (s *Session) Entities(ctx context.Context, q EntityQuery) *Iterator {
+	return newIterator(ctx, q.Cursor, func(ctx context.Context, cursor string) (*entityPage, error) {
+		page := &entityPage{}
+		if err := s.client.call(ctx, protocol.MethodDocEntities, q.params(s.id, "", cursor), page); err != nil {
+			return nil, err
+		}
+		return page, nil
+	})
+}
+
+// WriteDWG 将会话中的图纸（包括修复与编辑的结果）写为 DWG，release 为空时沿用原来的版本
+func (s *Session) WriteDWG(ctx context.Context, output, release string) (*ConvertResult, error) {
+	result := &ConvertResult{}
+	params := &protocol.WriteParams{Session: s.id, Output: output, Release: release}
+	if err := s.client.call(ctx, protocol.MethodDocWrite, params, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// WriteDXF 将会话中的图纸写为 DXF
+func (s *Session) WriteDXF(ctx context.Context, output string) (*ConvertResult, error) {
+	result := &ConvertResult{}
+	params := &protocol.WriteParams{Session: s.id, Output: output, Format: "dxf"}
+	if err := s.client.call(ctx, protocol.MethodDocWrite, params, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Close 释放 dwg_service 中的会话
+func (s *Session) Close(ctx context.Context) error {
+	return s.client.call(ctx, protocol.MethodDocClose, s.params(), nil)
+}
@@ -0,0 +1,68 @@
+package dwg_go
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"iter"
+
+	"github.com/BlockLucky/dwg-go/protocol"
+)
+
+// StreamEntities 以流的方式读取实体：dwg_service 遍历图纸时逐条推送，
+// 调用方处理完一条才会读取下一条，客户端内存占用与图纸大小无关。
+// 中途 break 会停止接收，出错时最后产出一次非 nil 的 error。
+func (c *Client) StreamEntities(ctx context.Context, path string, q EntityQuery) iter.Seq2[Entity, error] {
+	return c.stream(ctx, q.params("", path, ""))
+}
+
+// StreamEntities 以流的方式读取会话中的实体
+func (s *Session) StreamEntities(ctx context.Context, q EntityQuery) iter.Seq2[Entity, error] {
+	return s.client.stream(ctx, q.params(s.id, "", ""))
+}
+
+func (c *Client) stream(ctx context.Context, params *protocol.EntitiesParams) iter.Seq2[Entity, error] {
+	return func(yield func(Entity, error) bool) {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		items := make(chan Entity)
+		done := make(chan error, 1)
+		go func() {
+			var decodeErr error
+			_, err := c.invoke(ctx, protocol.MethodStream, params, func(method string, data json.RawMessage) {
+				if method != protocol.NotifyItem || decodeErr != nil {
+					return
+				}
+				var e Entity
+				if decodeErr = json.Unmarshal(data, &e); decodeErr != nil {
+					decodeErr = fmt.Errorf("decode entity: %w", decodeErr)
+					return
+				}
+				select {
+				case items <- e:
+				case <-ctx.Done():
+				}
+			})
+			if err == nil {
+				err = decodeErr
+			}
+			done <- err
+		}()
+
+		// 响应总在全部通知之后到达，done 有值时所有实体都已经被取走
+		for {
+			select {
+			case e := <-items:
+				if !yield(e, nil) {
+					return
+				}
+			case err := <-done:
+				if err != nil {
+					yield(Entity{}, err)
+				}
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package dwg_go
+
+import (
+	"context"
+	"sync"
+
+	"github.com/BlockLucky/dwg-go/protocol"
+)
+
+// ChangeSet 一组可序列化的修改。Ops 为执行过的编辑操作，新建操作带有分配到的句柄，
+// 用 Replay 在同一图纸的另一份副本上重放会得到相同的句柄；按顺序执行 Undo 可撤销这些修改
+type ChangeSet struct {
+	Ops  []*EditOp `json:"ops"`
+	Undo []*EditOp `json:"undo"`
+}
+
+func (c *ChangeSet) add(result *protocol.EditResult) {
+	c.Ops = append(c.Ops, result.Applied...)
+	c.Undo = append(append([]*EditOp(nil), result.Undo...), c.Undo...)
+}
+
+// editHistory 会话的撤销与重做记录，tx 为进行中的事务，aborted 表示事务已被 reset 中止。
+// 修改图纸的调用在持有 lock 期间发出并记录，记录的顺序与图纸上执行的顺序一致
+type editHistory struct {
+	lock    sync.Mutex
+	tx      *ChangeSet
+	aborted bool
+	undo    []*ChangeSet
+	redo    []*ChangeSet
+}
+
+// record 记录一次成功的编辑：事务中并入事务，否则记为一步撤销并清空重做，调用方须持有 lock
+func (h *editHistory) record(result *protocol.EditResult) {
+	if h.tx != nil {
+		h.tx.add(result)
+		return
+	}
+	cs := &ChangeSet{}
+	cs.add(result)
+	h.push(cs)
+}
+
+// reset 清空撤销与重做记录并中止进行中的事务，用于撤销记录无法还原的修改，调用方须持有 lock
+func (h *editHistory) reset() {
+	h.undo, h.redo = nil, nil
+	if h.tx != nil {
+		h.aborted = true
+	}
+}
+
+// end 结束事务，事务已被中止时返回 ErrTransactionAborted
+func (h *editHistory) end() error {
+	aborted := h.aborted
+	h.tx, h.aborted = nil, false
+	if aborted {
+		return ErrTransactionAborted
+	}
+	return nil
+}
+
+func (h *editHistory) push(cs *ChangeSet) {
+	if len(cs.Ops) == 0 {
+		return
+	}
+	h.undo = append(h.undo, cs)
+	h.redo = nil
+}
+
+// Begin 开始事务，此后的编辑在 Commit 时合并为一步撤销，Rollback 时全部撤销
+func (s *Session) Begin() error {
+	s.history.lock.Lock()
+	defer s.history.lock.Unlock()
+	if s.history.tx != nil {
+		return ErrTransactionActive
+	}
+	s.history.tx = &ChangeSet{}
+	return nil
+}
+
+// Commit 结束事务，返回事务中的修改；事务被 Purge 或修复模式的 Audit 中止时返回 ErrTransactionAborted
+func (s *Session) Commit() (*ChangeSet, error) {
+	s.history.lock.Lock()
+	defer s.history.lock.Unlock()
+	cs := s.history.tx
+	if cs == nil {
+		return nil, ErrNoTransaction
+	}
+	if err := s.history.end(); err != nil {
+		return nil, err
+	}
+	s.history.push(cs)
+	return cs, nil
+}
+
+// Rollback 撤销事务中的全部修改并结束事务；撤销失败时事务保持进行中，可以再次 Rollback。
+// 事务被中止时不撤销，结束事务并返回 ErrTransactionAborted
+func (s *Session) Rollback(ctx context.Context) error {
+	s.history.lock.Lock()
+	defer s.history.lock.Unlock()
+	cs := s.history.tx
+	if cs == nil {
+		return ErrNoTransaction
+	}
+	if len(cs.Undo) > 0 && !s.history.aborted {
+		if _, err := s.edit(ctx, cs.Undo); err != nil {
+			return err
+		}
+	}
+	return s.history.end()
+}
+
+// Undo 撤销最近一步修改（一次 Edit 调用或一个事务）
+func (s *Session) Undo(ctx context.Context) error {
+	s.history.lock.Lock()
+	defer s.history.lock.Unlock()
+	if s.history.tx != nil {
+		return ErrTransactionActive
+	}
+	n := len(s.history.undo)
+	if n == 0 {
+		return ErrNothingToUndo
+	}
+	cs := s.history.undo[n-1]
+	if _, err := s.edit(ctx, cs.Undo); err != nil {
+		return err
+	}
+	s.history.undo = s.history.undo[:n-1]
+	s.history.redo = append(s.history.redo, cs)
+	return nil
+}
+
+// Redo 重做最近一步被撤销的修改，新建的对象使用原来的句柄
+func (s *Session) Redo(ctx context.Context) error {
+	s.history.lock.Lock()
+	defer s.history.lock.Unlock()
+	if s.history.tx != nil {
+		return ErrTransactionActive
+	}
+	n := len(s.history.redo)
+	if n == 0 {
+		return ErrNothingToUndo
+	}
+	cs := s.history.redo[n-1]
+	if _, err := s.edit(ctx, cs.Ops); err != nil {
+		return err
+	}
+	s.history.redo = s.history.redo[:n-1]
+	s.history.undo = append(s.history.undo, cs)
+	return nil
+}
+
+// CanUndo 是否有可撤销的修改
+func (s *Session) CanUndo() bool {
+	s.history.lock.Lock()
+	defer s.history.lock.Unlock()
+	return s.history.tx == nil && len(s.history.undo) > 0
+}
+
+// CanRedo 是否有可重做的修改
+func (s *Session) CanRedo() bool {
+	s.history.lock.Lock()
+	defer s.history.lock.Unlock()
+	return s.history.tx == nil && len(s.history.redo) > 0
+}
+
+// Replay 在本会话上重放 cs 中的修改，整体成功或整体不生效；重放记为一步撤销，事务中则并入事务
+func (s *Session) Replay(ctx context.Context, cs *ChangeSet) error {
+	_, err := s.Edit(ctx, cs.Ops...)
+	return err
+}
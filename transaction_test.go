@@ -0,0 +1,409 @@
+package dwg_go
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/BlockLucky/dwg-go/api/api_stdio"
+	"github.com/BlockLucky/dwg-go/protocol"
+)
+
+// fakeDoc 模拟 dwg_service 中的一份图纸，只记录存在的对象句柄；类型为 FAIL 的实体新建失败，
+// 整批不生效。doc.header 返回 insUnits，doc.layers 返回 layers，成功的 doc.edit 按批记录在 edits。
+// gate 非 nil 时 doc.edit 先发送到 entered 再等待 gate
+type fakeDoc struct {
+	lock     sync.Mutex
+	live     map[Handle]bool
+	deleted  map[Handle]bool
+	seed     Handle
+	insUnits Units
+	layers   []*Layer
+	edits    [][]*EditOp
+	entered  chan struct{}
+	gate     chan struct{}
+}
+
+func newFakeSession() (*Session, *fakeDoc) {
+	doc := &fakeDoc{live: map[Handle]bool{}, deleted: map[Handle]bool{}, seed: 0x100}
+	return &Session{client: &Client{conn: doc}, id: "s1"}, doc
+}
+
+func (f *fakeDoc) info() (*ServiceInfo, error) {
+	return &ServiceInfo{Methods: []string{protocol.MethodDocEdit, protocol.MethodDocHeader, protocol.MethodDocLayers, protocol.MethodDocPurge, protocol.MethodAudit}}, nil
+}
+
+func (f *fakeDoc) close() error { return nil }
+
+func (f *fakeDoc) call(ctx context.Context, method string, params interface{}, notify api_stdio.NotifyFunc) (json.RawMessage, error) {
+	if method == protocol.MethodDocEdit && f.gate != nil {
+		f.entered <- struct{}{}
+		<-f.gate
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	switch method {
+	case protocol.MethodDocHeader:
+		return json.Marshal(&Header{InsUnits: int(f.insUnits)})
+	case protocol.MethodDocLayers:
+		return json.Marshal(f.layers)
+	case protocol.MethodDocEdit:
+	default:
+		return json.RawMessage(`{}`), nil
+	}
+
+	// 在副本上执行，失败时丢弃
+	live, deleted, seed := f.clone()
+	result := &protocol.EditResult{}
+	for _, op := range params.(*protocol.EditParams).Ops {
+		h := op.Handle
+		var inverse *EditOp
+		switch op.Op {
+		case EditAddEntity:
+			if op.Entity.Type == "FAIL" {
+				return nil, errors.New("op failed")
+			}
+			if h == 0 {
+				h = seed
+			}
+			if live[h] {
+				return nil, errors.New("handle in use")
+			}
+			live[h], seed = true, max(seed, h+1)
+			inverse = &EditOp{Op: EditDeleteEntity, Handle: h}
+		case EditAddLayer, EditAddBlock:
+			if h == 0 {
+				h = seed
+			}
+			live[h], seed = true, max(seed, h+1)
+			inverse = &EditOp{Op: undoAdd[op.Op], Handle: h}
+		case EditDeleteEntity:
+			if !live[h] {
+				return nil, errors.New("entity not found")
+			}
+			delete(live, h)
+			deleted[h] = true
+			inverse = &EditOp{Op: EditRestore, Handle: h}
+		case EditRestore:
+			if !deleted[h] {
+				return nil, errors.New("nothing to restore")
+			}
+			delete(deleted, h)
+			live[h] = true
+			inverse = &EditOp{Op: EditDeleteEntity, Handle: h}
+		}
+		applied := *op
+		applied.Handle = h
+		result.Handles = append(result.Handles, h)
+		result.Applied = append(result.Applied, &applied)
+		result.Undo = append([]*EditOp{inverse}, result.Undo...)
+	}
+	f.live, f.deleted, f.seed = live, deleted, seed
+	f.edits = append(f.edits, params.(*protocol.EditParams).Ops)
+	result.HandSeed = seed
+	return json.Marshal(result)
+}
+
+// undoAdd 新建图层与块定义的撤销操作
+var undoAdd = map[EditOpKind]EditOpKind{EditAddLayer: EditDeleteLayer, EditAddBlock: EditDeleteBlock}
+
+func (f *fakeDoc) clone() (map[Handle]bool, map[Handle]bool, Handle) {
+	live, deleted := map[Handle]bool{}, map[Handle]bool{}
+	for h := range f.live {
+		live[h] = true
+	}
+	for h := range f.deleted {
+		deleted[h] = true
+	}
+	return live, deleted, f.seed
+}
+
+// handles 图纸中存在的实体句柄，按大小排序
+func (f *fakeDoc) handles() []Handle {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	var out []Handle
+	for h := range f.live {
+		out = append(out, h)
+	}
+	slices.Sort(out)
+	return out
+}
+
+func line() *Entity {
+	return &Entity{Type: "LINE", Points: []Point{{}, {X: 1}}}
+}
+
+func TestUndoRedo(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name     string
+		steps    []string
+		want     []Handle
+		canUndo  bool
+		canRedo  bool
+		finalErr error
+	}{
+		{"nothing to undo", []string{"undo"}, nil, false, false, ErrNothingToUndo},
+		{"nothing to redo", []string{"add", "redo"}, []Handle{0x100}, true, false, ErrNothingToUndo},
+		{"undo add", []string{"add", "add", "undo"}, []Handle{0x100}, true, true, nil},
+		{"redo keeps handle", []string{"add", "add", "undo", "redo"}, []Handle{0x100, 0x101}, true, false, nil},
+		{"undo delete", []string{"add", "delete", "undo"}, []Handle{0x100}, true, true, nil},
+		{"new edit clears redo", []string{"add", "undo", "add", "redo"}, []Handle{0x101}, true, false, ErrNothingToUndo},
+		{"failed edit is not recorded", []string{"add", "fail", "undo"}, nil, false, true, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, doc := newFakeSession()
+			var last Handle
+			var err error
+			for _, step := range tt.steps {
+				switch step {
+				case "add":
+					last, err = s.AddEntity(ctx, line())
+				case "fail":
+					_, err = s.AddEntity(ctx, &Entity{Type: "FAIL"})
+				case "delete":
+					err = s.DeleteEntity(ctx, last)
+				case "undo":
+					err = s.Undo(ctx)
+				case "redo":
+					err = s.Redo(ctx)
+				}
+			}
+			if !errors.Is(err, tt.finalErr) {
+				t.Fatalf("last step error = %v, want %v", err, tt.finalErr)
+			}
+			if got := doc.handles(); !slices.Equal(got, tt.want) {
+				t.Errorf("handles = %v, want %v", got, tt.want)
+			}
+			if s.CanUndo() != tt.canUndo || s.CanRedo() != tt.canRedo {
+				t.Errorf("CanUndo/CanRedo = %v/%v, want %v/%v", s.CanUndo(), s.CanRedo(), tt.canUndo, tt.canRedo)
+			}
+		})
+	}
+}
+
+func TestTransaction(t *testing.T) {
+	ctx := context.Background()
+	s, doc := newFakeSession()
+	if _, err := s.AddEntity(ctx, line()); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.Commit(); !errors.Is(err, ErrNoTransaction) {
+		t.Fatalf("Commit without Begin = %v", err)
+	}
+	if err := s.Begin(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Begin(); !errors.Is(err, ErrTransactionActive) {
+		t.Fatalf("nested Begin = %v", err)
+	}
+	a, _ := s.AddEntity(ctx, line())
+	_, _ = s.AddEntity(ctx, line())
+	if err := s.DeleteEntity(ctx, a); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Undo(ctx); !errors.Is(err, ErrTransactionActive) {
+		t.Fatalf("Undo in transaction = %v", err)
+	}
+	if s.CanUndo() {
+		t.Error("CanUndo in transaction")
+	}
+
+	cs, err := s.Commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cs.Ops) != 3 || len(cs.Undo) != 3 || cs.Undo[0].Op != EditRestore {
+		t.Fatalf("change set = %+v", cs)
+	}
+	if got := doc.handles(); !slices.Equal(got, []Handle{0x100, 0x102}) {
+		t.Fatalf("handles after commit = %v", got)
+	}
+
+	// 事务是一步撤销，撤销后恢复到 Begin 之前
+	if err = s.Undo(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := doc.handles(); !slices.Equal(got, []Handle{0x100}) {
+		t.Errorf("handles after undo = %v", got)
+	}
+	if err = s.Redo(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := doc.handles(); !slices.Equal(got, []Handle{0x100, 0x102}) {
+		t.Errorf("handles after redo = %v", got)
+	}
+}
+
+func TestRollback(t *testing.T) {
+	ctx := context.Background()
+	s, doc := newFakeSession()
+	first, _ := s.AddEntity(ctx, line())
+
+	if err := s.Rollback(ctx); !errors.Is(err, ErrNoTransaction) {
+		t.Fatalf("Rollback without Begin = %v", err)
+	}
+	if err := s.Begin(); err != nil {
+		t.Fatal(err)
+	}
+	_, _ = s.AddEntity(ctx, line())
+	_ = s.DeleteEntity(ctx, first)
+	if err := s.Rollback(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := doc.handles(); !slices.Equal(got, []Handle{first}) {
+		t.Errorf("handles after rollback = %v, want [%v]", got, first)
+	}
+	// 回滚的事务不是一步撤销，撤销的是事务之前的编辑
+	if err := s.Undo(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := doc.handles(); len(got) != 0 {
+		t.Errorf("handles after undo = %v", got)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	ctx := context.Background()
+	src, _ := newFakeSession()
+	_ = src.Begin()
+	a, _ := src.AddEntity(ctx, line())
+	_, _ = src.AddEntity(ctx, line())
+	_ = src.DeleteEntity(ctx, a)
+	cs, err := src.Commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := json.Marshal(cs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded ChangeSet
+	if err = json.Unmarshal(raw, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	dst, doc := newFakeSession()
+	if err = dst.Replay(ctx, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if got := doc.handles(); !slices.Equal(got, []Handle{0x101}) {
+		t.Errorf("handles after replay = %v, want [101]", got)
+	}
+	if !dst.CanUndo() {
+		t.Error("replay was not recorded as an undo step")
+	}
+}
+
+func TestPurgeAndAuditFixResetHistory(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name  string
+		call  func(s *Session) error
+		reset bool
+	}{
+		{"purge", func(s *Session) error { _, err := s.Purge(ctx, PurgeOptions{}); return err }, true},
+		{"purge dry run", func(s *Session) error { _, err := s.Purge(ctx, PurgeOptions{DryRun: true}); return err }, false},
+		{"audit fix", func(s *Session) error { _, err := s.Audit(ctx, AuditOptions{Fix: true}); return err }, true},
+		{"audit", func(s *Session) error { _, err := s.Audit(ctx, AuditOptions{}); return err }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newFakeSession()
+			a, _ := s.AddEntity(ctx, line())
+			_ = s.DeleteEntity(ctx, a)
+			_ = s.Undo(ctx)
+			if err := tt.call(s); err != nil {
+				t.Fatal(err)
+			}
+			if s.CanUndo() == tt.reset || s.CanRedo() == tt.reset {
+				t.Errorf("CanUndo/CanRedo = %v/%v, history reset want %v", s.CanUndo(), s.CanRedo(), tt.reset)
+			}
+
+			// 进行中的事务被中止：后续编辑失败，Commit 返回 ErrTransactionAborted 并结束事务
+			if err := s.Begin(); err != nil {
+				t.Fatal(err)
+			}
+			_, _ = s.AddEntity(ctx, line())
+			if err := tt.call(s); err != nil {
+				t.Fatal(err)
+			}
+			_, editErr := s.AddEntity(ctx, line())
+			_, commitErr := s.Commit()
+			if tt.reset {
+				if !errors.Is(editErr, ErrTransactionAborted) || !errors.Is(commitErr, ErrTransactionAborted) {
+					t.Fatalf("edit/commit after abort = %v/%v", editErr, commitErr)
+				}
+				if s.CanUndo() {
+					t.Error("aborted transaction was recorded")
+				}
+			} else if editErr != nil || commitErr != nil {
+				t.Fatalf("edit/commit = %v/%v", editErr, commitErr)
+			}
+			if err := s.Begin(); err != nil {
+				t.Errorf("Begin after the transaction ended: %v", err)
+			}
+		})
+	}
+}
+
+func TestRollbackAborted(t *testing.T) {
+	ctx := context.Background()
+	s, doc := newFakeSession()
+	_ = s.Begin()
+	_, _ = s.AddEntity(ctx, line())
+	if _, err := s.Purge(ctx, PurgeOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Rollback(ctx); !errors.Is(err, ErrTransactionAborted) {
+		t.Fatalf("Rollback = %v, want %v", err, ErrTransactionAborted)
+	}
+	// 中止的事务不再撤销，图纸保持清理后的状态
+	if got := doc.handles(); len(got) != 1 {
+		t.Errorf("handles = %v, want the edit to stay", got)
+	}
+}
+
+func TestEditHoldsHistoryLock(t *testing.T) {
+	ctx := context.Background()
+	s, doc := newFakeSession()
+	doc.entered, doc.gate = make(chan struct{}), make(chan struct{})
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := s.AddEntity(ctx, line())
+		done <- err
+	}()
+	<-doc.entered
+
+	begun := make(chan error, 1)
+	go func() { begun <- s.Begin() }()
+	select {
+	case err := <-begun:
+		t.Fatalf("Begin returned %v while an edit was in flight", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	doc.gate <- struct{}{}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if err := <-begun; err != nil {
+		t.Fatal(err)
+	}
+	// 编辑在 Begin 之前完成，记为独立的一步而不是并入事务
+	cs, err := s.Commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cs.Ops) != 0 || !s.CanUndo() {
+		t.Errorf("edit recorded in the transaction: %+v, CanUndo %v", cs, s.CanUndo())
+	}
+}